@@ -6,12 +6,16 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/MPoline/alert_service_yp/internal/agent/flags"
 	"github.com/MPoline/alert_service_yp/internal/agent/services"
+	"github.com/MPoline/alert_service_yp/internal/agent/status"
+	"github.com/MPoline/alert_service_yp/internal/config"
 	"github.com/MPoline/alert_service_yp/internal/logging"
 	"github.com/MPoline/alert_service_yp/internal/models"
 	"github.com/MPoline/alert_service_yp/internal/storage"
@@ -44,6 +48,54 @@ func getLocalIP() string {
 	return localAddr.IP.String()
 }
 
+// shutdownGracePeriod - время на отправку последних метрик при остановке агента
+const shutdownGracePeriod = 5 * time.Second
+
+// restartSettings - настройки агента, которые применяются только при запуске
+type restartSettings struct {
+	rateLimit            int64
+	aggregate            bool
+	aggregateP95         bool
+	statusAddr           string
+	remoteConfig         bool
+	remoteConfigInterval int64
+}
+
+func currentRestartSettings() restartSettings {
+	return restartSettings{
+		rateLimit:            flags.FlagRateLimit,
+		aggregate:            flags.FlagAggregate,
+		aggregateP95:         flags.FlagAggregateP95,
+		statusAddr:           flags.FlagStatusAddr,
+		remoteConfig:         flags.FlagRemoteConfig,
+		remoteConfigInterval: flags.FlagRemoteConfigInterval,
+	}
+}
+
+// changedFlags возвращает имена флагов, значения которых отличаются от s
+func (s restartSettings) changedFlags(other restartSettings) []string {
+	var changed []string
+	if s.rateLimit != other.rateLimit {
+		changed = append(changed, "l")
+	}
+	if s.aggregate != other.aggregate {
+		changed = append(changed, "aggregate")
+	}
+	if s.aggregateP95 != other.aggregateP95 {
+		changed = append(changed, "aggregate-p95")
+	}
+	if s.statusAddr != other.statusAddr {
+		changed = append(changed, "status-addr")
+	}
+	if s.remoteConfig != other.remoteConfig {
+		changed = append(changed, "remote-config")
+	}
+	if s.remoteConfigInterval != other.remoteConfigInterval {
+		changed = append(changed, "remote-config-interval")
+	}
+	return changed
+}
+
 func main() {
 	buildinfo.Print("Agent")
 	fmt.Println("Agent started")
@@ -69,7 +121,12 @@ func main() {
 	logger.Info("Using local IP",
 		zap.String("ip", localIP))
 
-	clientManager, err := services.NewClientManager()
+	// Настройки, которые не перечитываются по SIGHUP, читаются один раз при запуске.
+	// Остальные флаги после запуска читаются только под settingsMu.
+	startup := currentRestartSettings()
+	clientSettings := services.ClientSettingsFromFlags()
+
+	clientManager, err := services.NewClientManager(clientSettings)
 	if err != nil {
 		logger.Error("Failed to initialize client manager", zap.Error(err))
 		os.Exit(1)
@@ -81,25 +138,72 @@ func main() {
 	pollInterval := time.Duration(flags.FlagPollInterval) * time.Second
 	reportInterval := time.Duration(flags.FlagReportInterval) * time.Second
 
-	sendCh := make(chan []models.Metrics, flags.FlagRateLimit)
+	var aggregator *services.Aggregator
+	if startup.aggregate {
+		aggregator = services.NewAggregator(startup.aggregateP95)
+		logger.Info("Gauge aggregation enabled", zap.Bool("p95", startup.aggregateP95))
+	}
+
+	var collectorSet atomic.Value
+	collectorSet.Store(services.NewCollectorSet(flags.Collectors()))
+
+	collectorNames := func() []string {
+		names := collectorSet.Load().(services.CollectorSet).Names()
+		if aggregator != nil {
+			names = append(names, "aggregation")
+		}
+		return names
+	}
+
+	collectMetrics := func() []models.Metrics {
+		metrics := services.CreateMetrics(memStorage, collectorSet.Load().(services.CollectorSet))
+		if aggregator != nil {
+			metrics = append(metrics, aggregator.Flush()...)
+		}
+		return metrics
+	}
+
+	sendCh := make(chan []models.Metrics, startup.rateLimit)
 	var wg sync.WaitGroup
 
+	tracker := status.NewTracker(startup.rateLimit, func() int { return len(sendCh) })
+	tracker.SetCollectors(collectorNames())
+
+	if startup.statusAddr != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status.Serve(ctx, startup.statusAddr, tracker)
+		}()
+	}
+
 	sendCtx, cancelSend := context.WithCancel(ctx)
 	defer cancelSend()
 
+	// Контекст отправки в воркерах: после начала остановки у воркеров есть
+	// shutdownGracePeriod на отправку последних батчей, затем повторы прерываются.
+	workersCtx, cancelWorkers := context.WithCancel(context.Background())
+	defer cancelWorkers()
+	stopWorkers := context.AfterFunc(ctx, func() {
+		time.AfterFunc(shutdownGracePeriod, cancelWorkers)
+	})
+	defer stopWorkers()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
 		var workersWG sync.WaitGroup
-		workersWG.Add(int(flags.FlagRateLimit))
+		workersWG.Add(int(startup.rateLimit))
 
-		for i := 0; i < int(flags.FlagRateLimit); i++ {
+		for i := 0; i < int(startup.rateLimit); i++ {
 			go func(id int) {
 				defer workersWG.Done()
 				for metrics := range sendCh {
 					if metrics != nil {
-						clientManager.SendMetrics(memStorage, metrics, localIP)
+						start := time.Now()
+						err := clientManager.SendMetrics(workersCtx, memStorage, metrics, localIP)
+						tracker.ObserveSend(time.Since(start), err)
 					}
 				}
 				logger.Debug("Worker stopped - channel closed",
@@ -121,7 +225,9 @@ func main() {
 		for {
 			select {
 			case <-ticker.C:
-				if err := clientManager.HealthCheck(); err != nil {
+				err := clientManager.HealthCheck()
+				tracker.SetHealthCheckResult(err)
+				if err != nil {
 					logger.Warn("Health check failed",
 						zap.Error(err),
 						zap.String("agent_ip", localIP))
@@ -138,17 +244,183 @@ func main() {
 		}
 	}()
 
+	pollTicker := time.NewTicker(pollInterval)
+	defer pollTicker.Stop()
+
+	reportTicker := time.NewTicker(reportInterval)
+	defer reportTicker.Stop()
+
+	var (
+		settingsMu   sync.Mutex
+		remoteConfig *config.RemoteAgentConfig
+		activePoll   = pollInterval
+		activeReport = reportInterval
+	)
+
+	// applySettings применяет интервалы и сборщики метрик: локальные настройки
+	// с наложенными поверх настройками сервера, если они были получены.
+	// Вызывается под settingsMu.
+	applySettings := func() {
+		poll := time.Duration(flags.FlagPollInterval) * time.Second
+		report := time.Duration(flags.FlagReportInterval) * time.Second
+		collectors := flags.Collectors()
+		source, labels := "local", map[string]string(nil)
+
+		if remoteConfig != nil {
+			if remoteConfig.PollInterval != 0 {
+				poll = remoteConfig.PollInterval.ToDuration()
+			}
+			if remoteConfig.ReportInterval != 0 {
+				report = remoteConfig.ReportInterval.ToDuration()
+			}
+			if len(remoteConfig.Collectors) > 0 {
+				collectors = remoteConfig.Collectors
+			}
+			source, labels = "remote", remoteConfig.Labels
+		}
+
+		if poll != activePoll {
+			pollTicker.Reset(poll)
+			activePoll = poll
+		}
+		if report != activeReport {
+			reportTicker.Reset(report)
+			activeReport = report
+		}
+
+		newCollectorSet := services.NewCollectorSet(collectors)
+		if !newCollectorSet.Runtime {
+			services.RemoveRuntimeMetrics(memStorage, neсMetrics)
+		}
+		collectorSet.Store(newCollectorSet)
+		tracker.SetCollectors(collectorNames())
+		tracker.SetConfigSource(source, labels)
+
+		logger.Info("Agent settings applied",
+			zap.String("source", source),
+			zap.Duration("poll_interval", poll),
+			zap.Duration("report_interval", report),
+			zap.Strings("collectors", collectorNames()))
+	}
+
+	// Перечитывание конфигурации по SIGHUP
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+
+	reload := func() {
+		settingsMu.Lock()
+		defer settingsMu.Unlock()
+
+		logger.Info("Reloading configuration",
+			zap.String("config_file", flags.FlagConfigFile))
+
+		if err := flags.ReloadConfig(); err != nil {
+			logger.Error("Failed to reload configuration, keeping current settings", zap.Error(err))
+		} else {
+			applySettings()
+			logger.Info("Configuration reloaded")
+		}
+
+		if changed := startup.changedFlags(currentRestartSettings()); len(changed) > 0 {
+			logger.Warn("Some settings are applied only at startup, restart the agent to apply them",
+				zap.Strings("flags", changed))
+		}
+
+		if newSettings := services.ClientSettingsFromFlags(); newSettings != clientSettings {
+			if err := clientManager.Reload(newSettings); err != nil {
+				logger.Error("Failed to rebuild client, keeping previous client", zap.Error(err))
+				return
+			}
+			clientSettings = newSettings
+			return
+		}
+
+		// Сертификаты могли быть обновлены на диске без изменения путей
+		if err := clientManager.ReloadTLS(); err != nil {
+			logger.Error("Failed to reload TLS certificates, keeping current certificates", zap.Error(err))
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-hupCh:
+				reload()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Получение настроек с сервера
+	if startup.remoteConfig {
+		fetchRemoteConfig := func() {
+			settingsMu.Lock()
+			label := flags.FlagAgentLabel
+			settingsMu.Unlock()
+
+			newRemoteConfig, err := clientManager.FetchAgentConfig(label, localIP)
+
+			settingsMu.Lock()
+			defer settingsMu.Unlock()
+
+			// Последние полученные настройки сохраняются, пока сервер недоступен
+			if err != nil {
+				logger.Warn("Failed to fetch remote configuration, keeping current settings",
+					zap.Error(err),
+					zap.Bool("remote", remoteConfig != nil),
+					zap.String("agent_ip", localIP))
+				return
+			}
+
+			if remoteConfig != nil && reflect.DeepEqual(*remoteConfig, *newRemoteConfig) {
+				return
+			}
+
+			remoteConfig = newRemoteConfig
+			applySettings()
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			fetchRemoteConfig()
+
+			ticker := time.NewTicker(time.Duration(startup.remoteConfigInterval) * time.Second)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					fetchRemoteConfig()
+				case <-ctx.Done():
+					logger.Info("Remote configuration polling stopped",
+						zap.String("agent_ip", localIP))
+					return
+				}
+			}
+		}()
+	}
+
 	// Сбор метрик
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		ticker := time.NewTicker(pollInterval)
-		defer ticker.Stop()
 
 		for {
 			select {
-			case <-ticker.C:
-				services.GetMetrics(memStorage, neсMetrics)
+			case <-pollTicker.C:
+				if collectorSet.Load().(services.CollectorSet).Runtime {
+					services.GetMetrics(memStorage, neсMetrics)
+				}
+				if aggregator != nil {
+					aggregator.Observe(memStorage)
+				}
 			case <-ctx.Done():
 				logger.Info("Metrics collection stopped", zap.String("agent_ip", localIP))
 				return
@@ -156,52 +428,63 @@ func main() {
 		}
 	}()
 
+	// splitMetrics разбивает метрики на батчи по текущим ограничениям размера
+	splitMetrics := func(metrics []models.Metrics) [][]models.Metrics {
+		settingsMu.Lock()
+		maxMetrics, maxBytes := int(flags.FlagBatchMaxMetrics), int(flags.FlagBatchMaxBytes)
+		settingsMu.Unlock()
+
+		return services.SplitBatch(metrics, maxMetrics, maxBytes)
+	}
+
 	// Отправка метрик
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		defer close(sendCh)
 
-		ticker := time.NewTicker(reportInterval)
-		defer ticker.Stop()
-
 		for {
 			select {
-			case <-ticker.C:
-				metricStorage := services.CreateMetrics(memStorage)
-				select {
-				case sendCh <- metricStorage:
-					logger.Debug("Metrics batch sent to channel",
-						zap.Int("metrics_count", len(metricStorage)),
-						zap.String("agent_ip", localIP))
-				case <-sendCtx.Done():
-					logger.Info("Send context cancelled", zap.String("agent_ip", localIP))
-					return
-				case <-ctx.Done():
-					logger.Info("Main context cancelled", zap.String("agent_ip", localIP))
-					return
-				default:
-					logger.Warn("Channel full, skipping metrics batch",
-						zap.String("agent_ip", localIP))
+			case <-reportTicker.C:
+				batches := splitMetrics(collectMetrics())
+				for i, batch := range batches {
+					select {
+					case sendCh <- batch:
+						logger.Debug("Metrics batch sent to channel",
+							zap.Int("batch", i+1),
+							zap.Int("batches", len(batches)),
+							zap.Int("metrics_count", len(batch)),
+							zap.String("agent_ip", localIP))
+					case <-sendCtx.Done():
+						logger.Info("Send context cancelled", zap.String("agent_ip", localIP))
+						return
+					case <-ctx.Done():
+						logger.Info("Main context cancelled", zap.String("agent_ip", localIP))
+						return
+					}
 				}
 
 			case <-ctx.Done():
 				logger.Info("Shutdown initiated, sending final metrics",
 					zap.String("agent_ip", localIP))
 
-				metricStorage := services.CreateMetrics(memStorage)
-
-				select {
-				case sendCh <- metricStorage:
-					logger.Info("Last metrics sent successfully",
-						zap.Int("metrics_count", len(metricStorage)),
-						zap.String("agent_ip", localIP))
-				case <-time.After(100 * time.Millisecond):
-					logger.Warn("Failed to send last metrics - timeout",
-						zap.String("agent_ip", localIP))
-				case <-sendCtx.Done():
-					logger.Warn("Failed to send last metrics - send context cancelled",
-						zap.String("agent_ip", localIP))
+				timeout := time.After(100 * time.Millisecond)
+				batches := splitMetrics(collectMetrics())
+			finalBatches:
+				for i, batch := range batches {
+					select {
+					case sendCh <- batch:
+						logger.Info("Last metrics sent successfully",
+							zap.Int("batch", i+1),
+							zap.Int("batches", len(batches)),
+							zap.Int("metrics_count", len(batch)),
+							zap.String("agent_ip", localIP))
+					case <-timeout:
+						logger.Warn("Failed to send last metrics - timeout",
+							zap.Int("skipped_batches", len(batches)-i),
+							zap.String("agent_ip", localIP))
+						break finalBatches
+					}
 				}
 
 				cancelSend()
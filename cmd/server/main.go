@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"crypto/rsa"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
@@ -11,12 +11,20 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/MPoline/alert_service_yp/internal/crypto"
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/apitoken"
+	"github.com/MPoline/alert_service_yp/internal/audit"
+	"github.com/MPoline/alert_service_yp/internal/config"
+	"github.com/MPoline/alert_service_yp/internal/keyring"
 	"github.com/MPoline/alert_service_yp/internal/logging"
+	"github.com/MPoline/alert_service_yp/internal/netutil"
+	"github.com/MPoline/alert_service_yp/internal/ratelimit"
+	"github.com/MPoline/alert_service_yp/internal/replay"
 	"github.com/MPoline/alert_service_yp/internal/server/api"
 	"github.com/MPoline/alert_service_yp/internal/server/flags"
 	"github.com/MPoline/alert_service_yp/internal/server/services"
 	"github.com/MPoline/alert_service_yp/internal/storage"
+	"github.com/MPoline/alert_service_yp/internal/tlsutil"
 	"github.com/MPoline/alert_service_yp/pkg/buildinfo"
 	"go.uber.org/zap"
 )
@@ -42,6 +50,13 @@ func main() {
 	undo := zap.ReplaceGlobals(logger)
 	defer undo()
 
+	// Подкоманда migrate управляет схемой базы данных без запуска сервера
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		code := runMigrate(os.Args[2:])
+		logger.Sync()
+		os.Exit(code)
+	}
+
 	flags.ParseFlags()
 
 	var storageType string
@@ -86,30 +101,124 @@ func main() {
 		}
 	}
 
-	var privateKey *rsa.PrivateKey
-	if flags.FlagCryptoKey != "" {
-		logger.Info("Initializing decryption", zap.String("private_key", flags.FlagCryptoKey))
+	// Ключи из флагов -k и -crypto-key дополняются набором ключей из файла -keyring
+	keys, err := keyring.New(flags.FlagKeyringFile, flags.FlagKey, flags.FlagCryptoKey, flags.FlagHashAlg)
+	if err != nil {
+		logger.Error("Failed to load keys",
+			zap.String("keyring", flags.FlagKeyringFile),
+			zap.String("private_key", flags.FlagCryptoKey),
+			zap.Error(err))
+		os.Exit(1)
+	}
+	if keys.DecryptionEnabled() {
+		logger.Info("Decryption initialized successfully")
+	} else {
+		logger.Info("Decryption disabled - no crypto key provided")
+	}
+
+	agentConfigs, err := config.LoadAgentConfigSet(flags.FlagAgentConfigFile)
+	if err != nil {
+		logger.Error("Failed to load agent configurations",
+			zap.String("path", flags.FlagAgentConfigFile),
+			zap.Error(err))
+		os.Exit(1)
+	}
 
-		privateKey, err = crypto.LoadPrivateKey(flags.FlagCryptoKey)
+	// Журнал аудита пишется в файл и в таблицу audit_log через пул соединений
+	// хранилища; запросы к журналу выполняются к базе данных, если она используется
+	var auditSinks []audit.Sink
+	if flags.FlagAuditDB {
+		if db := storage.DBConn(metricStorage); db != nil {
+			auditSinks = append(auditSinks, audit.NewDBSink(db))
+		}
+	}
+	if flags.FlagAuditFile != "" {
+		fileSink, err := audit.NewFileSink(flags.FlagAuditFile, flags.FlagAuditMaxSize<<20, int(flags.FlagAuditMaxBackups))
 		if err != nil {
-			logger.Error("Failed to load private key",
-				zap.String("path", flags.FlagCryptoKey),
-				zap.Error(err))
+			logger.Error("Failed to open audit log file", zap.String("path", flags.FlagAuditFile), zap.Error(err))
 			os.Exit(1)
 		}
-		logger.Info("Decryption initialized successfully")
-	} else {
-		logger.Info("Decryption disabled - no crypto key provided")
+		auditSinks = append(auditSinks, fileSink)
+	}
+	auditLog := audit.New(auditSinks...)
+	defer auditLog.Close()
+	if auditLog.Enabled() {
+		logger.Info("Audit log enabled",
+			zap.String("file", flags.FlagAuditFile),
+			zap.Bool("database", flags.FlagAuditDB && flags.FlagDatabaseDSN != ""))
+	}
+
+	// Обработчики работают с хранилищем через декораторы, пишущие журнал аудита
+	// и уведомляющие подписчиков WatchMetrics; файловые операции используют
+	// исходное хранилище
+	watchedStorage := storage.NewWatchedStorage(audit.Wrap(metricStorage, auditLog))
+
+	replayGuard := replay.NewGuard(time.Duration(flags.FlagReplayWindow)*time.Second, int(flags.FlagReplayCacheSize))
+	if replayGuard.Enabled() {
+		logger.Info("Replay protection enabled",
+			zap.Int64("window_seconds", flags.FlagReplayWindow),
+			zap.Int64("cache_size", flags.FlagReplayCacheSize))
+	}
+
+	agents, err := agentkey.NewRegistry(flags.FlagAgentKeysDir)
+	if err != nil {
+		logger.Error("Failed to load agent keys",
+			zap.String("dir", flags.FlagAgentKeysDir),
+			zap.Error(err))
+		os.Exit(1)
+	}
+	if agents.Enabled() {
+		logger.Info("Agent key signatures enabled", zap.String("dir", flags.FlagAgentKeysDir))
+	}
+
+	tokens, err := apitoken.New(flags.APITokens)
+	if err != nil {
+		logger.Error("Failed to load API tokens", zap.Error(err))
+		os.Exit(1)
+	}
+	if tokens.Enabled() {
+		logger.Info("API token authentication enabled", zap.Int("tokens", len(flags.APITokens)))
 	}
 
-	serviceHandler := services.NewServiceHandler(metricStorage, privateKey, flags.FlagKey)
+	trustedSubnets, err := netutil.ParseIPSet(flags.FlagTrustedSubnet)
+	if err != nil {
+		logger.Error("Invalid trusted subnet", zap.String("trusted_subnet", flags.FlagTrustedSubnet), zap.Error(err))
+		os.Exit(1)
+	}
+	trustedProxies, err := netutil.ParseIPSet(flags.FlagTrustedProxies)
+	if err != nil {
+		logger.Error("Invalid trusted proxies", zap.String("trusted_proxies", flags.FlagTrustedProxies), zap.Error(err))
+		os.Exit(1)
+	}
 
-	apiInstance := api.NewAPI(serviceHandler)
+	limiter := ratelimit.New(flags.FlagRateLimit, int(flags.FlagRateBurst))
+	if limiter.Enabled() {
+		logger.Info("Rate limiting enabled",
+			zap.Float64("rate", flags.FlagRateLimit),
+			zap.Int64("burst", flags.FlagRateBurst),
+			zap.String("key", flags.FlagRateLimitKey))
+	}
+
+	serviceHandler := services.NewServiceHandler(watchedStorage, keys, replayGuard, agents, agentConfigs, auditLog)
+
+	apiInstance := api.NewAPI(serviceHandler, tokens, trustedSubnets, trustedProxies, limiter)
 
 	r := apiInstance.InitRouter()
 
+	var tlsReloader *tlsutil.Reloader
+	var tlsConfig *tls.Config
+	if flags.FlagTLSCert != "" {
+		tlsReloader, err = tlsutil.NewReloader(flags.FlagTLSCert, flags.FlagTLSKey, flags.FlagTLSClientCA)
+		if err != nil {
+			logger.Error("Failed to load TLS certificates", zap.Error(err))
+			os.Exit(1)
+		}
+		tlsConfig = tlsReloader.ServerConfig()
+		logger.Info("TLS enabled", zap.Bool("mutual_tls", flags.FlagTLSClientCA != ""))
+	}
+
 	if flags.FlagGRPCAddress != "" {
-		if err := services.InitGRPCServer(privateKey, flags.FlagKey, metricStorage); err != nil {
+		if err := services.InitGRPCServer(keys, replayGuard, agents, tokens, trustedSubnets, trustedProxies, limiter, watchedStorage, agentConfigs, tlsConfig); err != nil {
 			logger.Error("Failed to start gRPC server", zap.Error(err))
 			os.Exit(1)
 		}
@@ -117,16 +226,51 @@ func main() {
 	}
 
 	server := &http.Server{
-		Addr:    flags.FlagRunAddr,
-		Handler: r,
+		Addr:      flags.FlagRunAddr,
+		Handler:   r,
+		TLSConfig: tlsConfig,
 	}
 
 	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if tlsConfig != nil {
+			// Сертификаты берутся из TLSConfig
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Error("Server error", zap.Error(err))
 		}
 	}()
 
+	// Перечитывание ключей и сертификатов по SIGHUP
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+
+	go func() {
+		for {
+			select {
+			case <-hupCh:
+				logger.Info("SIGHUP received, reloading keys and certificates")
+				if err := keys.Reload(); err != nil {
+					logger.Error("Failed to reload keys, keeping current keys", zap.Error(err))
+				}
+				if err := agents.Reload(); err != nil {
+					logger.Error("Failed to reload agent keys, keeping current keys", zap.Error(err))
+				}
+				if tlsReloader != nil {
+					if err := tlsReloader.Reload(); err != nil {
+						logger.Error("Failed to reload TLS certificates, keeping current certificates", zap.Error(err))
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
 	logger.Info("Server is running", zap.String("address", flags.FlagRunAddr))
 
 	if flags.FlagGRPCAddress != "" {
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/server/database"
+	"github.com/MPoline/alert_service_yp/internal/server/flags"
+)
+
+// migrateUsage - справка по подкоманде migrate
+const migrateUsage = `usage: server migrate up|down [steps]|status [flags]
+
+  up        apply all pending migrations
+  down      revert the last applied migrations (1 by default)
+  status    show applied and pending migrations
+
+Database DSN is taken from -d, DATABASE_DSN or the configuration file.`
+
+// migrateTimeout - время на выполнение подкоманды migrate
+const migrateTimeout = 5 * time.Minute
+
+// runMigrate выполняет подкоманду migrate. Аргументы после действия (и числа шагов
+// для down) разбираются как обычные флаги сервера. Возвращает код завершения.
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	action, args := args[0], args[1:]
+
+	steps := 1
+	if action == "down" && len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			if n <= 0 {
+				fmt.Fprintln(os.Stderr, "steps must be positive")
+				return 2
+			}
+			steps, args = n, args[1:]
+		}
+	}
+
+	// Флаги сервера разбираются после действия: server migrate up -d postgres://...
+	os.Args = append([]string{os.Args[0]}, args...)
+	flags.ParseFlags()
+	if flags.FlagDatabaseDSN == "" {
+		fmt.Fprintln(os.Stderr, "database DSN is not set")
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+
+	db, err := database.OpenDBConnection()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error opening database:", err)
+		return 1
+	}
+	defer database.CloseDBConnection(db)
+
+	switch action {
+	case "up":
+		applied, err := database.MigrateUp(ctx, db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Migration failed:", err)
+			return 1
+		}
+		fmt.Printf("Applied %d migration(s)\n", applied)
+
+	case "down":
+		reverted, err := database.MigrateDown(ctx, db, steps)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Migration failed:", err)
+			return 1
+		}
+		fmt.Printf("Reverted %d migration(s)\n", reverted)
+
+	case "status":
+		statuses, err := database.MigrationsStatus(ctx, db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to read migration status:", err)
+			return 1
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
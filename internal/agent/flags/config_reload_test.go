@@ -0,0 +1,59 @@
+package flags_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MPoline/alert_service_yp/internal/agent/flags"
+)
+
+func TestReloadConfigResetsRemovedKeys(t *testing.T) {
+	defer func(args []string, commandLine *flag.FlagSet) {
+		os.Args, flag.CommandLine = args, commandLine
+	}(os.Args, flag.CommandLine)
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+
+	// Переменные окружения имеют приоритет над файлом: тест работает без них
+	for _, env := range []string{"ADDRESS", "POLL_INTERVAL", "REPORT_INTERVAL", "AGENT_LABEL", "CONFIG"} {
+		t.Setenv(env, "")
+		os.Unsetenv(env)
+	}
+
+	path := filepath.Join(t.TempDir(), "agent.json")
+	writeConfig := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig(`{"address": "metrics:9090", "label": "db", "poll_interval": "5s", "report_interval": "20s"}`)
+	os.Args = []string{os.Args[0], "-config", path, "-p", "3"}
+	flags.ParseFlags()
+
+	if flags.FlagRunAddr != "metrics:9090" || flags.FlagAgentLabel != "db" || flags.FlagReportInterval != 20 {
+		t.Fatalf("config file is not applied: address %q, label %q, report %d",
+			flags.FlagRunAddr, flags.FlagAgentLabel, flags.FlagReportInterval)
+	}
+
+	// Ключи address и label удалены: после перезагрузки действуют значения по умолчанию
+	writeConfig(`{"poll_interval": "5s", "report_interval": "30s"}`)
+	if err := flags.ReloadConfig(); err != nil {
+		t.Fatalf("ReloadConfig failed: %v", err)
+	}
+
+	if flags.FlagRunAddr != "localhost:8080" {
+		t.Errorf("removed address must fall back to the default, got %q", flags.FlagRunAddr)
+	}
+	if flags.FlagAgentLabel != "" {
+		t.Errorf("removed label must fall back to the default, got %q", flags.FlagAgentLabel)
+	}
+	if flags.FlagReportInterval != 30 {
+		t.Errorf("expected report interval 30 from the file, got %d", flags.FlagReportInterval)
+	}
+	if flags.FlagPollInterval != 3 {
+		t.Errorf("command line flag must keep priority over the file, got poll interval %d", flags.FlagPollInterval)
+	}
+}
@@ -1,17 +1,21 @@
 package flags
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/MPoline/alert_service_yp/internal/config"
+	"github.com/MPoline/alert_service_yp/internal/hasher"
 	"go.uber.org/zap"
 )
 
 // Глобальные переменные с параметрами агента
 var (
-	// FlagRunAddr - адрес и порт сервера (флаг -a, переменная ADDRESS)
+	// FlagRunAddr - адрес и порт сервера, несколько адресов перечисляются через запятую (флаг -a, переменная ADDRESS)
 	FlagRunAddr string
 
 	// FlagReportInterval - интервал отправки метрик на сервер в секундах (флаг -r, переменная REPORT_INTERVAL)
@@ -23,6 +27,23 @@ var (
 	// FlagKey - ключ для подписи данных (флаг -k, переменная KEY)
 	FlagKey string
 
+	// FlagKeyID - идентификатор ключа подписи в наборе ключей сервера (флаг -key-id, переменная KEY_ID)
+	FlagKeyID string
+
+	// FlagHashAlg - алгоритм подписи: sha256, sha512 или blake2b (флаг -hash-alg, переменная HASH_ALG)
+	FlagHashAlg string
+
+	// FlagAgentID - идентификатор агента, под которым зарегистрирован его ключ Ed25519
+	// на сервере (флаг -agent-id, переменная AGENT_ID)
+	FlagAgentID string
+
+	// FlagSigningKey - путь к приватному ключу Ed25519 агента для подписи запросов
+	// (флаг -signing-key, переменная SIGNING_KEY)
+	FlagSigningKey string
+
+	// FlagAPIToken - токен Bearer для доступа к API сервера (флаг -api-token, переменная API_TOKEN)
+	FlagAPIToken string
+
 	// FlagRateLimit - лимит одновременных запросов (флаг -l, переменная RATE_LIMIT)
 	FlagRateLimit int64
 
@@ -34,10 +55,79 @@ var (
 	// FlagGRPC - использовать gRPC вместо HTTP (флаг -grpc, переменная USE_GRPC)
 	FlagGRPC bool
 
-	// FlagGRPCAddress - адрес gRPC сервера (флаг -grpc-address, переменная GRPC_ADDRESS)
+	// FlagGRPCStream - отправлять метрики через постоянный поток StreamMetrics (флаг -grpc-stream, переменная GRPC_STREAM)
+	FlagGRPCStream bool
+
+	// FlagGRPCAddress - адрес gRPC сервера, несколько адресов перечисляются через запятую
+	// (флаг -grpc-address, переменная GRPC_ADDRESS)
 	FlagGRPCAddress string
+
+	// FlagAggregate - агрегировать gauge-метрики между отправками (флаг -aggregate, переменная AGGREGATE)
+	FlagAggregate bool
+
+	// FlagAggregateP95 - добавлять 95-й перцентиль к агрегатам (флаг -aggregate-p95, переменная AGGREGATE_P95)
+	FlagAggregateP95 bool
+
+	// FlagStatusAddr - адрес HTTP-эндпоинта статуса агента (флаг -status-addr, переменная STATUS_ADDR)
+	FlagStatusAddr string
+
+	// FlagCollectors - список включенных сборщиков метрик через запятую (флаг -collectors, переменная COLLECTORS)
+	FlagCollectors string
+
+	// FlagRemoteConfig - получать настройки агента с сервера (флаг -remote-config, переменная REMOTE_CONFIG)
+	FlagRemoteConfig bool
+
+	// FlagAgentLabel - метка агента для выбора настроек на сервере (флаг -label, переменная AGENT_LABEL)
+	FlagAgentLabel string
+
+	// FlagRemoteConfigInterval - интервал опроса настроек на сервере в секундах
+	// (флаг -remote-config-interval, переменная REMOTE_CONFIG_INTERVAL)
+	FlagRemoteConfigInterval int64
+
+	// FlagStrategy - стратегия отправки при нескольких серверах: failover, round-robin или broadcast
+	// (флаг -strategy, переменная STRATEGY)
+	FlagStrategy string
+
+	// FlagRetryAttempts - максимальное число попыток отправки батча (флаг -retry-attempts, переменная RETRY_ATTEMPTS)
+	FlagRetryAttempts int64
+
+	// FlagRetryMaxDelay - максимальная задержка между попытками в секундах (флаг -retry-max-delay, переменная RETRY_MAX_DELAY)
+	FlagRetryMaxDelay int64
+
+	// FlagBreakerThreshold - число ошибок подряд, после которого отправка на сервер приостанавливается,
+	// 0 отключает автомат защиты (флаг -breaker-threshold, переменная BREAKER_THRESHOLD)
+	FlagBreakerThreshold int64
+
+	// FlagBreakerTimeout - пауза перед пробной отправкой после срабатывания автомата защиты в секундах
+	// (флаг -breaker-timeout, переменная BREAKER_TIMEOUT)
+	FlagBreakerTimeout int64
+
+	// FlagBatchMaxMetrics - максимальное число метрик в одном запросе, 0 - без ограничения
+	// (флаг -batch-max-metrics, переменная BATCH_MAX_METRICS)
+	FlagBatchMaxMetrics int64
+
+	// FlagBatchMaxBytes - максимальный размер батча в байтах JSON до сжатия и шифрования, 0 - без ограничения
+	// (флаг -batch-max-bytes, переменная BATCH_MAX_BYTES)
+	FlagBatchMaxBytes int64
+
+	// FlagTLS - подключаться к серверу по TLS (флаг -tls, переменная TLS)
+	FlagTLS bool
+
+	// FlagTLSCA - путь к файлу CA для проверки сертификата сервера, по умолчанию системные CA
+	// (флаг -tls-ca, переменная TLS_CA)
+	FlagTLSCA string
+
+	// FlagTLSCert - путь к клиентскому сертификату для mTLS (флаг -tls-cert, переменная TLS_CERT)
+	FlagTLSCert string
+
+	// FlagTLSKey - путь к приватному ключу клиентского сертификата (флаг -tls-key, переменная TLS_KEY)
+	FlagTLSKey string
 )
 
+// explicitFlags - флаги, явно заданные в командной строке.
+// При перечитывании конфигурации их значения не переопределяются файлом.
+var explicitFlags = map[string]bool{}
+
 // ParseFlags обрабатывает аргументы командной строки и переменные окружения.
 func ParseFlags() {
 	var err error
@@ -45,15 +135,43 @@ func ParseFlags() {
 	flag.Int64Var(&FlagReportInterval, "r", 10, "frequency of sending metrics to the server")
 	flag.Int64Var(&FlagPollInterval, "p", 2, "frequency of polling metrics")
 	flag.StringVar(&FlagKey, "k", "+randomSrting+", "key hashSHA256")
+	flag.StringVar(&FlagKeyID, "key-id", "", "id of the signing key in the server keyring")
+	flag.StringVar(&FlagHashAlg, "hash-alg", hasher.DefaultAlgorithm, "signature algorithm: sha256, sha512 or blake2b")
+	flag.StringVar(&FlagAgentID, "agent-id", "", "agent id registered with its public key on the server")
+	flag.StringVar(&FlagSigningKey, "signing-key", "", "path to Ed25519 private key for signing requests")
+	flag.StringVar(&FlagAPIToken, "api-token", "", "bearer token for the server API")
 	flag.Int64Var(&FlagRateLimit, "l", 5, "rateLimit workers")
 	flag.StringVar(&FlagCryptoKey, "crypto-key", "", "path to file with public key for encryption")
 	flag.StringVar(&FlagConfigFile, "config", "", "path to configuration file")
 	flag.StringVar(&FlagConfigFile, "c", "", "path to configuration file (shorthand)")
 	flag.BoolVar(&FlagGRPC, "grpc", false, "use gRPC instead of HTTP")
+	flag.BoolVar(&FlagGRPCStream, "grpc-stream", false, "send metrics over a persistent gRPC stream")
 	flag.StringVar(&FlagGRPCAddress, "grpc-address", "localhost:3200", "gRPC server address")
+	flag.BoolVar(&FlagAggregate, "aggregate", false, "report min/max/avg/last of gauges between reports")
+	flag.BoolVar(&FlagAggregateP95, "aggregate-p95", false, "also report p95 of gauges between reports")
+	flag.StringVar(&FlagStatusAddr, "status-addr", "", "address of the agent status endpoint (disabled if empty)")
+	flag.StringVar(&FlagCollectors, "collectors", strings.Join(config.KnownCollectors, ","), "comma-separated list of enabled metric collectors")
+	flag.BoolVar(&FlagRemoteConfig, "remote-config", false, "poll agent configuration from the server")
+	flag.StringVar(&FlagAgentLabel, "label", "", "agent label used to select remote configuration")
+	flag.Int64Var(&FlagRemoteConfigInterval, "remote-config-interval", 60, "frequency of polling remote configuration")
+	flag.StringVar(&FlagStrategy, "strategy", config.StrategyFailover, "multi-server strategy: failover, round-robin or broadcast")
+	flag.Int64Var(&FlagRetryAttempts, "retry-attempts", 4, "maximum number of attempts to send a batch")
+	flag.Int64Var(&FlagRetryMaxDelay, "retry-max-delay", 10, "maximum delay between attempts in seconds")
+	flag.Int64Var(&FlagBreakerThreshold, "breaker-threshold", 5, "consecutive failures before the circuit breaker opens (0 disables)")
+	flag.Int64Var(&FlagBreakerTimeout, "breaker-timeout", 30, "seconds before a probe request after the circuit breaker opens")
+	flag.Int64Var(&FlagBatchMaxMetrics, "batch-max-metrics", 0, "maximum number of metrics per request (0 means unlimited)")
+	flag.Int64Var(&FlagBatchMaxBytes, "batch-max-bytes", 0, "maximum JSON size of a batch in bytes (0 means unlimited)")
+	flag.BoolVar(&FlagTLS, "tls", false, "connect to the server over TLS")
+	flag.StringVar(&FlagTLSCA, "tls-ca", "", "path to CA certificate for server verification (system CAs if empty)")
+	flag.StringVar(&FlagTLSCert, "tls-cert", "", "path to client certificate for mutual TLS")
+	flag.StringVar(&FlagTLSKey, "tls-key", "", "path to client certificate private key")
 
 	flag.Parse()
 
+	flag.Visit(func(f *flag.Flag) {
+		explicitFlags[f.Name] = true
+	})
+
 	if flag.NArg() > 0 {
 		zap.L().Info("Error: unknown flag(s)")
 		flag.Usage()
@@ -81,6 +199,165 @@ func ParseFlags() {
 	}
 }
 
+// ReloadConfig повторно читает файл конфигурации (-config), проверяет его
+// и применяет новые значения. Флаги, явно заданные в командной строке,
+// и переменные окружения сохраняют приоритет над файлом.
+func ReloadConfig() error {
+	if FlagConfigFile == "" {
+		return errors.New("config file is not specified")
+	}
+
+	fileConfig, err := config.LoadAgentConfig(FlagConfigFile)
+	if err != nil {
+		return err
+	}
+
+	if err := fileConfig.Validate(); err != nil {
+		return fmt.Errorf("invalid config file: %w", err)
+	}
+
+	reloadFileConfig(fileConfig)
+
+	readEnvVars()
+
+	validateAndLogFlags()
+
+	return nil
+}
+
+// Collectors возвращает список включенных сборщиков метрик
+func Collectors() []string {
+	return config.SplitList(FlagCollectors)
+}
+
+// ServerAddresses возвращает список адресов HTTP серверов
+func ServerAddresses() []string {
+	return config.SplitList(FlagRunAddr)
+}
+
+// TLSEnabled сообщает, нужно ли подключаться к серверу по TLS.
+// Указание CA или клиентского сертификата включает TLS без флага -tls.
+func TLSEnabled() bool {
+	return FlagTLS || FlagTLSCA != "" || FlagTLSCert != ""
+}
+
+// GRPCAddresses возвращает список адресов gRPC серверов
+func GRPCAddresses() []string {
+	return config.SplitList(FlagGRPCAddress)
+}
+
+// reloadableFlags - флаги, значения которых перечитываются из файла конфигурации
+// при перезагрузке (см. reloadFileConfig)
+var reloadableFlags = []string{
+	"a", "r", "p", "crypto-key", "k", "key-id", "hash-alg", "agent-id", "signing-key",
+	"api-token", "grpc", "grpc-address", "grpc-stream", "collectors", "label", "strategy",
+	"retry-attempts", "retry-max-delay", "breaker-threshold", "breaker-timeout",
+	"batch-max-metrics", "batch-max-bytes", "tls", "tls-ca", "tls-cert", "tls-key",
+}
+
+// resetReloadableFlags возвращает значения по умолчанию флагам, которые перечитываются
+// из файла и не заданы в командной строке. Ключ, удаленный из файла, после перезагрузки
+// дает то же значение, что и при запуске. Переменные окружения применяются после файла.
+func resetReloadableFlags() {
+	for _, name := range reloadableFlags {
+		if explicitFlags[name] {
+			continue
+		}
+		f := flag.Lookup(name)
+		if f == nil {
+			continue
+		}
+		if err := f.Value.Set(f.DefValue); err != nil {
+			zap.L().Error("Failed to reset flag to default", zap.String("flag", name), zap.Error(err))
+		}
+	}
+}
+
+// reloadFileConfig сбрасывает перечитываемые флаги к значениям по умолчанию
+// и применяет значения из файла
+func reloadFileConfig(config *config.AgentConfig) {
+	resetReloadableFlags()
+
+	if !explicitFlags["a"] && config.Address != "" {
+		FlagRunAddr = config.Address
+	}
+	if !explicitFlags["r"] && config.ReportInterval != 0 {
+		FlagReportInterval = int64(config.ReportInterval.ToDuration().Seconds())
+	}
+	if !explicitFlags["p"] && config.PollInterval != 0 {
+		FlagPollInterval = int64(config.PollInterval.ToDuration().Seconds())
+	}
+	if !explicitFlags["crypto-key"] && config.CryptoKey != "" {
+		FlagCryptoKey = config.CryptoKey
+	}
+	if !explicitFlags["k"] && config.Key != "" {
+		FlagKey = config.Key
+	}
+	if !explicitFlags["key-id"] && config.KeyID != "" {
+		FlagKeyID = config.KeyID
+	}
+	if !explicitFlags["hash-alg"] && config.HashAlg != "" {
+		FlagHashAlg = config.HashAlg
+	}
+	if !explicitFlags["agent-id"] && config.AgentID != "" {
+		FlagAgentID = config.AgentID
+	}
+	if !explicitFlags["signing-key"] && config.SigningKey != "" {
+		FlagSigningKey = config.SigningKey
+	}
+	if !explicitFlags["api-token"] && config.APIToken != "" {
+		FlagAPIToken = config.APIToken
+	}
+	if !explicitFlags["grpc"] {
+		FlagGRPC = config.UseGRPC
+	}
+	if !explicitFlags["grpc-address"] && config.GRPCAddress != "" {
+		FlagGRPCAddress = config.GRPCAddress
+	}
+	if !explicitFlags["grpc-stream"] {
+		FlagGRPCStream = config.GRPCStream
+	}
+	if !explicitFlags["collectors"] && len(config.Collectors) > 0 {
+		FlagCollectors = strings.Join(config.Collectors, ",")
+	}
+	if !explicitFlags["label"] && config.Label != "" {
+		FlagAgentLabel = config.Label
+	}
+	if !explicitFlags["strategy"] && config.Strategy != "" {
+		FlagStrategy = config.Strategy
+	}
+	if !explicitFlags["retry-attempts"] && config.RetryAttempts != 0 {
+		FlagRetryAttempts = int64(config.RetryAttempts)
+	}
+	if !explicitFlags["retry-max-delay"] && config.RetryMaxDelay != 0 {
+		FlagRetryMaxDelay = int64(config.RetryMaxDelay.ToDuration().Seconds())
+	}
+	if !explicitFlags["breaker-threshold"] && config.BreakerThreshold != 0 {
+		FlagBreakerThreshold = int64(config.BreakerThreshold)
+	}
+	if !explicitFlags["breaker-timeout"] && config.BreakerTimeout != 0 {
+		FlagBreakerTimeout = int64(config.BreakerTimeout.ToDuration().Seconds())
+	}
+	if !explicitFlags["batch-max-metrics"] && config.BatchMaxMetrics != 0 {
+		FlagBatchMaxMetrics = int64(config.BatchMaxMetrics)
+	}
+	if !explicitFlags["batch-max-bytes"] && config.BatchMaxBytes != 0 {
+		FlagBatchMaxBytes = int64(config.BatchMaxBytes)
+	}
+	if !explicitFlags["tls"] {
+		FlagTLS = config.TLS
+	}
+	if !explicitFlags["tls-ca"] && config.TLSCA != "" {
+		FlagTLSCA = config.TLSCA
+	}
+	if !explicitFlags["tls-cert"] && config.TLSCert != "" {
+		FlagTLSCert = config.TLSCert
+	}
+	if !explicitFlags["tls-key"] && config.TLSKey != "" {
+		FlagTLSKey = config.TLSKey
+	}
+}
+
 func applyFileConfig(config *config.AgentConfig) {
 	if FlagRunAddr == "localhost:8080" && config.Address != "" {
 		FlagRunAddr = config.Address
@@ -97,12 +374,84 @@ func applyFileConfig(config *config.AgentConfig) {
 	if FlagKey == "" && config.Key != "" {
 		FlagKey = config.Key
 	}
+	if FlagKeyID == "" && config.KeyID != "" {
+		FlagKeyID = config.KeyID
+	}
+	if FlagHashAlg == hasher.DefaultAlgorithm && config.HashAlg != "" {
+		FlagHashAlg = config.HashAlg
+	}
+	if FlagAgentID == "" && config.AgentID != "" {
+		FlagAgentID = config.AgentID
+	}
+	if FlagSigningKey == "" && config.SigningKey != "" {
+		FlagSigningKey = config.SigningKey
+	}
+	if FlagAPIToken == "" && config.APIToken != "" {
+		FlagAPIToken = config.APIToken
+	}
 	if !FlagGRPC && config.UseGRPC {
 		FlagGRPC = config.UseGRPC
 	}
 	if FlagGRPCAddress == "localhost:3200" && config.GRPCAddress != "" {
 		FlagGRPCAddress = config.GRPCAddress
 	}
+	if !FlagGRPCStream && config.GRPCStream {
+		FlagGRPCStream = config.GRPCStream
+	}
+	if !FlagAggregate && config.Aggregate {
+		FlagAggregate = config.Aggregate
+	}
+	if !FlagAggregateP95 && config.AggregateP95 {
+		FlagAggregateP95 = config.AggregateP95
+	}
+	if FlagStatusAddr == "" && config.StatusAddress != "" {
+		FlagStatusAddr = config.StatusAddress
+	}
+	if !explicitFlags["collectors"] && len(config.Collectors) > 0 {
+		FlagCollectors = strings.Join(config.Collectors, ",")
+	}
+	if !FlagRemoteConfig && config.RemoteConfig {
+		FlagRemoteConfig = config.RemoteConfig
+	}
+	if FlagAgentLabel == "" && config.Label != "" {
+		FlagAgentLabel = config.Label
+	}
+	if FlagRemoteConfigInterval == 60 && config.RemoteConfigInterval != 0 {
+		FlagRemoteConfigInterval = int64(config.RemoteConfigInterval.ToDuration().Seconds())
+	}
+	if !explicitFlags["strategy"] && config.Strategy != "" {
+		FlagStrategy = config.Strategy
+	}
+	if !explicitFlags["retry-attempts"] && config.RetryAttempts != 0 {
+		FlagRetryAttempts = int64(config.RetryAttempts)
+	}
+	if !explicitFlags["retry-max-delay"] && config.RetryMaxDelay != 0 {
+		FlagRetryMaxDelay = int64(config.RetryMaxDelay.ToDuration().Seconds())
+	}
+	if !explicitFlags["breaker-threshold"] && config.BreakerThreshold != 0 {
+		FlagBreakerThreshold = int64(config.BreakerThreshold)
+	}
+	if !explicitFlags["breaker-timeout"] && config.BreakerTimeout != 0 {
+		FlagBreakerTimeout = int64(config.BreakerTimeout.ToDuration().Seconds())
+	}
+	if !explicitFlags["batch-max-metrics"] && config.BatchMaxMetrics != 0 {
+		FlagBatchMaxMetrics = int64(config.BatchMaxMetrics)
+	}
+	if !explicitFlags["batch-max-bytes"] && config.BatchMaxBytes != 0 {
+		FlagBatchMaxBytes = int64(config.BatchMaxBytes)
+	}
+	if !FlagTLS && config.TLS {
+		FlagTLS = config.TLS
+	}
+	if FlagTLSCA == "" && config.TLSCA != "" {
+		FlagTLSCA = config.TLSCA
+	}
+	if FlagTLSCert == "" && config.TLSCert != "" {
+		FlagTLSCert = config.TLSCert
+	}
+	if FlagTLSKey == "" && config.TLSKey != "" {
+		FlagTLSKey = config.TLSKey
+	}
 }
 
 func readEnvVars() {
@@ -134,6 +483,26 @@ func readEnvVars() {
 		FlagKey = envKey
 	}
 
+	if envKeyID, exists := os.LookupEnv("KEY_ID"); exists {
+		FlagKeyID = envKeyID
+	}
+
+	if envHashAlg, exists := os.LookupEnv("HASH_ALG"); exists {
+		FlagHashAlg = envHashAlg
+	}
+
+	if envAgentID, exists := os.LookupEnv("AGENT_ID"); exists {
+		FlagAgentID = envAgentID
+	}
+
+	if envSigningKey, exists := os.LookupEnv("SIGNING_KEY"); exists {
+		FlagSigningKey = envSigningKey
+	}
+
+	if envAPIToken, exists := os.LookupEnv("API_TOKEN"); exists {
+		FlagAPIToken = envAPIToken
+	}
+
 	if envConfigFile, exists := os.LookupEnv("CONFIG"); exists {
 		FlagConfigFile = envConfigFile
 	}
@@ -149,6 +518,130 @@ func readEnvVars() {
 	if envGRPCAddress, exists := os.LookupEnv("GRPC_ADDRESS"); exists {
 		FlagGRPCAddress = envGRPCAddress
 	}
+
+	if envGRPCStream, exists := os.LookupEnv("GRPC_STREAM"); exists {
+		if grpcStream, err := strconv.ParseBool(envGRPCStream); err == nil {
+			FlagGRPCStream = grpcStream
+		} else {
+			zap.L().Error("Failed to parse GRPC_STREAM", zap.Error(err))
+		}
+	}
+
+	if envAggregate, exists := os.LookupEnv("AGGREGATE"); exists {
+		if aggregate, err := strconv.ParseBool(envAggregate); err == nil {
+			FlagAggregate = aggregate
+		} else {
+			zap.L().Error("Failed to parse AGGREGATE", zap.Error(err))
+		}
+	}
+
+	if envAggregateP95, exists := os.LookupEnv("AGGREGATE_P95"); exists {
+		if aggregateP95, err := strconv.ParseBool(envAggregateP95); err == nil {
+			FlagAggregateP95 = aggregateP95
+		} else {
+			zap.L().Error("Failed to parse AGGREGATE_P95", zap.Error(err))
+		}
+	}
+
+	if envStatusAddr, exists := os.LookupEnv("STATUS_ADDR"); exists {
+		FlagStatusAddr = envStatusAddr
+	}
+
+	if envCollectors, exists := os.LookupEnv("COLLECTORS"); exists && envCollectors != "" {
+		FlagCollectors = envCollectors
+	}
+
+	if envRemoteConfig, exists := os.LookupEnv("REMOTE_CONFIG"); exists {
+		if remoteConfig, err := strconv.ParseBool(envRemoteConfig); err == nil {
+			FlagRemoteConfig = remoteConfig
+		} else {
+			zap.L().Error("Failed to parse REMOTE_CONFIG", zap.Error(err))
+		}
+	}
+
+	if envAgentLabel, exists := os.LookupEnv("AGENT_LABEL"); exists {
+		FlagAgentLabel = envAgentLabel
+	}
+
+	if envRemoteConfigInterval, exists := os.LookupEnv("REMOTE_CONFIG_INTERVAL"); exists && envRemoteConfigInterval != "" {
+		if interval, err := strconv.ParseInt(envRemoteConfigInterval, 10, 64); err == nil {
+			FlagRemoteConfigInterval = interval
+		} else {
+			zap.L().Error("Failed to parse REMOTE_CONFIG_INTERVAL", zap.Error(err))
+		}
+	}
+
+	if envStrategy, exists := os.LookupEnv("STRATEGY"); exists && envStrategy != "" {
+		FlagStrategy = envStrategy
+	}
+
+	if envRetryAttempts, exists := os.LookupEnv("RETRY_ATTEMPTS"); exists && envRetryAttempts != "" {
+		if attempts, err := strconv.ParseInt(envRetryAttempts, 10, 64); err == nil {
+			FlagRetryAttempts = attempts
+		} else {
+			zap.L().Error("Failed to parse RETRY_ATTEMPTS", zap.Error(err))
+		}
+	}
+
+	if envRetryMaxDelay, exists := os.LookupEnv("RETRY_MAX_DELAY"); exists && envRetryMaxDelay != "" {
+		if delay, err := strconv.ParseInt(envRetryMaxDelay, 10, 64); err == nil {
+			FlagRetryMaxDelay = delay
+		} else {
+			zap.L().Error("Failed to parse RETRY_MAX_DELAY", zap.Error(err))
+		}
+	}
+
+	if envBreakerThreshold, exists := os.LookupEnv("BREAKER_THRESHOLD"); exists && envBreakerThreshold != "" {
+		if threshold, err := strconv.ParseInt(envBreakerThreshold, 10, 64); err == nil {
+			FlagBreakerThreshold = threshold
+		} else {
+			zap.L().Error("Failed to parse BREAKER_THRESHOLD", zap.Error(err))
+		}
+	}
+
+	if envBreakerTimeout, exists := os.LookupEnv("BREAKER_TIMEOUT"); exists && envBreakerTimeout != "" {
+		if timeout, err := strconv.ParseInt(envBreakerTimeout, 10, 64); err == nil {
+			FlagBreakerTimeout = timeout
+		} else {
+			zap.L().Error("Failed to parse BREAKER_TIMEOUT", zap.Error(err))
+		}
+	}
+
+	if envBatchMaxMetrics, exists := os.LookupEnv("BATCH_MAX_METRICS"); exists && envBatchMaxMetrics != "" {
+		if maxMetrics, err := strconv.ParseInt(envBatchMaxMetrics, 10, 64); err == nil {
+			FlagBatchMaxMetrics = maxMetrics
+		} else {
+			zap.L().Error("Failed to parse BATCH_MAX_METRICS", zap.Error(err))
+		}
+	}
+
+	if envBatchMaxBytes, exists := os.LookupEnv("BATCH_MAX_BYTES"); exists && envBatchMaxBytes != "" {
+		if maxBytes, err := strconv.ParseInt(envBatchMaxBytes, 10, 64); err == nil {
+			FlagBatchMaxBytes = maxBytes
+		} else {
+			zap.L().Error("Failed to parse BATCH_MAX_BYTES", zap.Error(err))
+		}
+	}
+
+	if envTLS, exists := os.LookupEnv("TLS"); exists && envTLS != "" {
+		if useTLS, err := strconv.ParseBool(envTLS); err == nil {
+			FlagTLS = useTLS
+		} else {
+			zap.L().Error("Failed to parse TLS", zap.Error(err))
+		}
+	}
+
+	if envTLSCA, exists := os.LookupEnv("TLS_CA"); exists {
+		FlagTLSCA = envTLSCA
+	}
+
+	if envTLSCert, exists := os.LookupEnv("TLS_CERT"); exists {
+		FlagTLSCert = envTLSCert
+	}
+
+	if envTLSKey, exists := os.LookupEnv("TLS_KEY"); exists {
+		FlagTLSKey = envTLSKey
+	}
 }
 
 func validateAndLogFlags() {
@@ -164,6 +657,68 @@ func validateAndLogFlags() {
 		FlagPollInterval = 2
 	}
 
+	if FlagRemoteConfigInterval <= 0 {
+		zap.L().Warn("Remote config interval must be positive, using default value",
+			zap.Int64("default", 60))
+		FlagRemoteConfigInterval = 60
+	}
+
+	if FlagRetryAttempts <= 0 {
+		zap.L().Warn("Retry attempts must be positive, using default value",
+			zap.Int64("default", 4))
+		FlagRetryAttempts = 4
+	}
+
+	if FlagRetryMaxDelay <= 0 {
+		zap.L().Warn("Retry max delay must be positive, using default value",
+			zap.Int64("default", 10))
+		FlagRetryMaxDelay = 10
+	}
+
+	if FlagBreakerThreshold < 0 {
+		zap.L().Warn("Breaker threshold must not be negative, disabling circuit breaker")
+		FlagBreakerThreshold = 0
+	}
+
+	if FlagBreakerTimeout <= 0 {
+		zap.L().Warn("Breaker timeout must be positive, using default value",
+			zap.Int64("default", 30))
+		FlagBreakerTimeout = 30
+	}
+
+	if FlagBatchMaxMetrics < 0 {
+		zap.L().Warn("Batch max metrics must not be negative, disabling limit")
+		FlagBatchMaxMetrics = 0
+	}
+
+	if FlagBatchMaxBytes < 0 {
+		zap.L().Warn("Batch max bytes must not be negative, disabling limit")
+		FlagBatchMaxBytes = 0
+	}
+
+	if (FlagTLSCert == "") != (FlagTLSKey == "") {
+		zap.L().Warn("Client certificate and key must be set together, disabling client certificate")
+		FlagTLSCert = ""
+		FlagTLSKey = ""
+	}
+
+	if !config.IsKnownStrategy(FlagStrategy) {
+		zap.L().Warn("Unknown strategy, using default value",
+			zap.String("strategy", FlagStrategy),
+			zap.String("default", config.StrategyFailover))
+		FlagStrategy = config.StrategyFailover
+	}
+
+	var collectors []string
+	for _, name := range Collectors() {
+		if !config.IsKnownCollector(name) {
+			zap.L().Warn("Unknown collector ignored", zap.String("collector", name))
+			continue
+		}
+		collectors = append(collectors, name)
+	}
+	FlagCollectors = strings.Join(collectors, ",")
+
 	zap.L().Info(
 		"Agent configuration",
 		zap.String("address", FlagRunAddr),
@@ -171,8 +726,32 @@ func validateAndLogFlags() {
 		zap.Int64("poll_interval", FlagPollInterval),
 		zap.String("crypto_key", FlagCryptoKey),
 		zap.String("key", config.MaskSensitive(FlagKey)),
+		zap.String("key_id", FlagKeyID),
+		zap.String("hash_alg", FlagHashAlg),
+		zap.String("agent_id", FlagAgentID),
+		zap.String("signing_key", FlagSigningKey),
+		zap.String("api_token", config.MaskSensitive(FlagAPIToken)),
 		zap.String("config_file", FlagConfigFile),
 		zap.Bool("use_grpc", FlagGRPC),
 		zap.String("grpc_address", FlagGRPCAddress),
+		zap.Bool("grpc_stream", FlagGRPCStream),
+		zap.Bool("aggregate", FlagAggregate),
+		zap.Bool("aggregate_p95", FlagAggregateP95),
+		zap.String("status_addr", FlagStatusAddr),
+		zap.String("collectors", FlagCollectors),
+		zap.Bool("remote_config", FlagRemoteConfig),
+		zap.String("label", FlagAgentLabel),
+		zap.Int64("remote_config_interval", FlagRemoteConfigInterval),
+		zap.String("strategy", FlagStrategy),
+		zap.Int64("retry_attempts", FlagRetryAttempts),
+		zap.Int64("retry_max_delay", FlagRetryMaxDelay),
+		zap.Int64("breaker_threshold", FlagBreakerThreshold),
+		zap.Int64("breaker_timeout", FlagBreakerTimeout),
+		zap.Int64("batch_max_metrics", FlagBatchMaxMetrics),
+		zap.Int64("batch_max_bytes", FlagBatchMaxBytes),
+		zap.Bool("tls", TLSEnabled()),
+		zap.String("tls_ca", FlagTLSCA),
+		zap.String("tls_cert", FlagTLSCert),
+		zap.String("tls_key", FlagTLSKey),
 	)
 }
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/MPoline/alert_service_yp/internal/models"
+	storage "github.com/MPoline/alert_service_yp/internal/storage"
+)
+
+// Суффиксы агрегированных gauge-метрик
+const (
+	AggregateMinSuffix  = "_min"
+	AggregateMaxSuffix  = "_max"
+	AggregateAvgSuffix  = "_avg"
+	AggregateLastSuffix = "_last"
+	AggregateP95Suffix  = "_p95"
+)
+
+// Aggregator накапливает значения gauge-метрик между отправками на сервер,
+// чтобы кратковременные пики между отчетами не терялись.
+type Aggregator struct {
+	mu      sync.Mutex
+	samples map[string][]float64
+	withP95 bool
+}
+
+// NewAggregator создает агрегатор. withP95 включает расчет 95-го перцентиля.
+func NewAggregator(withP95 bool) *Aggregator {
+	return &Aggregator{
+		samples: make(map[string][]float64),
+		withP95: withP95,
+	}
+}
+
+// Observe сохраняет текущие значения всех gauge-метрик хранилища как очередной замер
+func (a *Aggregator) Observe(s *storage.MemStorage) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for name, value := range s.Gauges {
+		a.samples[name] = append(a.samples[name], value)
+	}
+}
+
+// Flush возвращает агрегаты (min/max/avg/last и, при необходимости, p95)
+// по замерам текущего интервала отправки и сбрасывает накопленные значения.
+func (a *Aggregator) Flush() []models.Metrics {
+	a.mu.Lock()
+	samples := a.samples
+	a.samples = make(map[string][]float64)
+	a.mu.Unlock()
+
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []models.Metrics
+	for _, name := range names {
+		values := samples[name]
+		if len(values) == 0 {
+			continue
+		}
+
+		minValue, maxValue, sum := math.Inf(1), math.Inf(-1), 0.0
+		for _, v := range values {
+			minValue = math.Min(minValue, v)
+			maxValue = math.Max(maxValue, v)
+			sum += v
+		}
+
+		result = append(result,
+			newGauge(name+AggregateMinSuffix, minValue),
+			newGauge(name+AggregateMaxSuffix, maxValue),
+			newGauge(name+AggregateAvgSuffix, sum/float64(len(values))),
+			newGauge(name+AggregateLastSuffix, values[len(values)-1]),
+		)
+
+		if a.withP95 {
+			result = append(result, newGauge(name+AggregateP95Suffix, percentile(values, 0.95)))
+		}
+	}
+
+	return result
+}
+
+// percentile вычисляет перцентиль методом ближайшего ранга
+func percentile(values []float64, p float64) float64 {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func newGauge(id string, value float64) models.Metrics {
+	return models.Metrics{
+		ID:    id,
+		MType: "gauge",
+		Value: &value,
+	}
+}
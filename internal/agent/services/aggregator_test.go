@@ -0,0 +1,39 @@
+package services
+
+import (
+	"testing"
+
+	storage "github.com/MPoline/alert_service_yp/internal/storage"
+)
+
+func TestAggregator(t *testing.T) {
+	s := storage.NewMemStorage()
+	a := NewAggregator(true)
+
+	for _, v := range []float64{5, 1, 9, 3} {
+		s.SetGauge("Alloc", v)
+		a.Observe(s)
+	}
+
+	result := make(map[string]float64)
+	for _, m := range a.Flush() {
+		result[m.ID] = *m.Value
+	}
+
+	expected := map[string]float64{
+		"Alloc_min":  1,
+		"Alloc_max":  9,
+		"Alloc_avg":  4.5,
+		"Alloc_last": 3,
+		"Alloc_p95":  9,
+	}
+	for id, value := range expected {
+		if got, ok := result[id]; !ok || got != value {
+			t.Errorf("Expected %s = %v, got %v (present: %v)", id, value, got, ok)
+		}
+	}
+
+	if len(a.Flush()) != 0 {
+		t.Error("Aggregator must be empty after Flush")
+	}
+}
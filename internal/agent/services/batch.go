@@ -0,0 +1,60 @@
+package services
+
+import (
+	"encoding/json"
+
+	"github.com/MPoline/alert_service_yp/internal/models"
+)
+
+// batchEnvelopeSize - размер обертки {"metrics":[]} вокруг метрик батча
+const batchEnvelopeSize = len(`{"metrics":[]}`)
+
+// SplitBatch разбивает метрики на батчи не более maxMetrics метрик и не более
+// maxBytes байт в JSON-представлении (до сжатия и шифрования).
+// Нулевое значение ограничения означает его отсутствие.
+// Метрика, которая сама по себе больше maxBytes, отправляется отдельным батчем.
+func SplitBatch(metrics []models.Metrics, maxMetrics, maxBytes int) [][]models.Metrics {
+	if len(metrics) == 0 {
+		return nil
+	}
+	if maxMetrics <= 0 && maxBytes <= 0 {
+		return [][]models.Metrics{metrics}
+	}
+
+	var batches [][]models.Metrics
+	start, size := 0, batchEnvelopeSize
+
+	for i, m := range metrics {
+		metricSize := 0
+		if maxBytes > 0 {
+			metricSize = encodedSize(m)
+			if i > start {
+				metricSize++ // запятая между элементами
+			}
+		}
+
+		full := i > start &&
+			((maxMetrics > 0 && i-start >= maxMetrics) ||
+				(maxBytes > 0 && size+metricSize > maxBytes))
+		if full {
+			batches = append(batches, metrics[start:i])
+			start, size = i, batchEnvelopeSize
+			if maxBytes > 0 {
+				metricSize = encodedSize(m)
+			}
+		}
+
+		size += metricSize
+	}
+
+	return append(batches, metrics[start:])
+}
+
+// encodedSize возвращает размер метрики в JSON
+func encodedSize(m models.Metrics) int {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
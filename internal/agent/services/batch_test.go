@@ -0,0 +1,74 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/MPoline/alert_service_yp/internal/models"
+)
+
+func makeGauges(n int) []models.Metrics {
+	metrics := make([]models.Metrics, n)
+	for i := range metrics {
+		metrics[i] = newGauge(fmt.Sprintf("Gauge%03d", i), float64(i))
+	}
+	return metrics
+}
+
+func TestSplitBatch(t *testing.T) {
+	metrics := makeGauges(10)
+
+	t.Run("no limits", func(t *testing.T) {
+		batches := SplitBatch(metrics, 0, 0)
+		if len(batches) != 1 || len(batches[0]) != 10 {
+			t.Fatalf("expected single batch of 10, got %d batches", len(batches))
+		}
+	})
+
+	t.Run("max metrics", func(t *testing.T) {
+		batches := SplitBatch(metrics, 4, 0)
+		sizes := []int{4, 4, 2}
+		if len(batches) != len(sizes) {
+			t.Fatalf("expected %d batches, got %d", len(sizes), len(batches))
+		}
+		for i, size := range sizes {
+			if len(batches[i]) != size {
+				t.Errorf("batch %d: expected %d metrics, got %d", i, size, len(batches[i]))
+			}
+		}
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		maxBytes := 120
+		batches := SplitBatch(metrics, 0, maxBytes)
+
+		total := 0
+		for i, batch := range batches {
+			data, err := json.Marshal(models.SliceMetrics{Metrics: batch})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) > maxBytes {
+				t.Errorf("batch %d is %d bytes, limit %d", i, len(data), maxBytes)
+			}
+			total += len(batch)
+		}
+		if total != len(metrics) || len(batches) < 2 {
+			t.Errorf("expected all %d metrics in several batches, got %d in %d", len(metrics), total, len(batches))
+		}
+	})
+
+	t.Run("oversized metric", func(t *testing.T) {
+		batches := SplitBatch(metrics[:3], 0, 10)
+		if len(batches) != 3 {
+			t.Fatalf("expected each metric in its own batch, got %d batches", len(batches))
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		if batches := SplitBatch(nil, 5, 100); batches != nil {
+			t.Fatalf("expected no batches, got %v", batches)
+		}
+	})
+}
@@ -1,62 +1,264 @@
 package services
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
+	"sync"
 
 	"github.com/MPoline/alert_service_yp/internal/agent/flags"
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/config"
+	"github.com/MPoline/alert_service_yp/internal/hasher"
 	"github.com/MPoline/alert_service_yp/internal/models"
 	"github.com/MPoline/alert_service_yp/internal/storage"
+	"github.com/MPoline/alert_service_yp/internal/tlsutil"
 	"go.uber.org/zap"
 )
 
 // MetricClient интерфейс для клиентов отправки метрик
 type MetricClient interface {
-	SendMetrics(memStorage *storage.MemStorage, metrics []models.Metrics, localIP string)
+	SendMetrics(ctx context.Context, memStorage *storage.MemStorage, metrics []models.Metrics, localIP string) error
 	HealthCheck() error
+	FetchAgentConfig(label string, localIP string) (*config.RemoteAgentConfig, error)
 	Close()
 }
 
 // ClientManager управляет клиентами для отправки метрик
 type ClientManager struct {
+	mu     sync.RWMutex
 	client MetricClient
+	tls    *tlsutil.Reloader
 }
 
-func NewClientManager() (*ClientManager, error) {
-	if flags.FlagGRPC {
-		zap.L().Info("Initializing gRPC client",
-			zap.String("address", flags.FlagGRPCAddress))
+// ClientSettings - снимок настроек агента, по которым создается клиент.
+// Клиенты не читают глобальные флаги: флаги могут измениться при перечитывании
+// конфигурации, пока идет отправка метрик.
+type ClientSettings struct {
+	RunAddr          string
+	GRPCAddress      string
+	GRPC             bool
+	GRPCStream       bool
+	Strategy         string
+	Key              string
+	KeyID            string
+	HashAlg          string
+	AgentID          string
+	SigningKey       string
+	APIToken         string
+	CryptoKey        string
+	RetryAttempts    int64
+	RetryMaxDelay    int64
+	BreakerThreshold int64
+	BreakerTimeout   int64
+	TLS              bool
+	TLSCA            string
+	TLSCert          string
+	TLSKey           string
+}
+
+// ClientSettingsFromFlags возвращает снимок текущих флагов агента.
+// Вызывающий должен исключить одновременное перечитывание конфигурации.
+func ClientSettingsFromFlags() ClientSettings {
+	return ClientSettings{
+		RunAddr:          flags.FlagRunAddr,
+		GRPCAddress:      flags.FlagGRPCAddress,
+		GRPC:             flags.FlagGRPC,
+		GRPCStream:       flags.FlagGRPCStream,
+		Strategy:         flags.FlagStrategy,
+		Key:              flags.FlagKey,
+		KeyID:            flags.FlagKeyID,
+		HashAlg:          flags.FlagHashAlg,
+		AgentID:          flags.FlagAgentID,
+		SigningKey:       flags.FlagSigningKey,
+		APIToken:         flags.FlagAPIToken,
+		CryptoKey:        flags.FlagCryptoKey,
+		RetryAttempts:    flags.FlagRetryAttempts,
+		RetryMaxDelay:    flags.FlagRetryMaxDelay,
+		BreakerThreshold: flags.FlagBreakerThreshold,
+		BreakerTimeout:   flags.FlagBreakerTimeout,
+		TLS:              flags.TLSEnabled(),
+		TLSCA:            flags.FlagTLSCA,
+		TLSCert:          flags.FlagTLSCert,
+		TLSKey:           flags.FlagTLSKey,
+	}
+}
+
+// ServerAddresses возвращает список адресов HTTP серверов
+func (s ClientSettings) ServerAddresses() []string {
+	return config.SplitList(s.RunAddr)
+}
+
+// GRPCAddresses возвращает список адресов gRPC серверов
+func (s ClientSettings) GRPCAddresses() []string {
+	return config.SplitList(s.GRPCAddress)
+}
 
-		grpcClient, err := NewGRPCClient()
+func NewClientManager(settings ClientSettings) (*ClientManager, error) {
+	client, tlsReloader, err := newMetricClient(settings)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientManager{client: client, tls: tlsReloader}, nil
+}
+
+// newMetricClient создает пул клиентов в соответствии с настройками агента
+func newMetricClient(settings ClientSettings) (MetricClient, *tlsutil.Reloader, error) {
+	var endpoints []*endpoint
+
+	if _, err := hasher.Normalize(settings.HashAlg); err != nil {
+		return nil, nil, err
+	}
+
+	signer, err := agentkey.NewSigner(settings.AgentID, settings.SigningKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load agent signing key: %w", err)
+	}
+
+	var tlsReloader *tlsutil.Reloader
+	if settings.TLS {
+		var err error
+		tlsReloader, err = tlsutil.NewReloader(settings.TLSCert, settings.TLSKey, settings.TLSCA)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+			return nil, nil, fmt.Errorf("failed to load TLS certificates: %w", err)
+		}
+	}
+
+	if settings.GRPC {
+		addresses := settings.GRPCAddresses()
+		if len(addresses) == 0 {
+			addresses = settings.ServerAddresses()
+		}
+
+		for _, address := range addresses {
+			zap.L().Info("Initializing gRPC client",
+				zap.String("address", address))
+
+			grpcClient, err := NewGRPCClient(address, clientTLSConfig(tlsReloader, address), signer, settings)
+			if err != nil {
+				for _, e := range endpoints {
+					e.client.Close()
+				}
+				return nil, nil, fmt.Errorf("failed to create gRPC client for %s: %w", address, err)
+			}
+			endpoints = append(endpoints, newEndpoint(address, grpcClient))
 		}
-		return &ClientManager{client: grpcClient}, nil
 	} else {
-		zap.L().Info("Using HTTP protocol",
-			zap.String("address", flags.FlagRunAddr))
+		for _, address := range settings.ServerAddresses() {
+			zap.L().Info("Using HTTP protocol",
+				zap.String("address", address))
 
-		httpClient := NewHTTPClient()
-		return &ClientManager{client: httpClient}, nil
+			endpoints = append(endpoints, newEndpoint(address, NewHTTPClient(address, clientTLSConfig(tlsReloader, address), signer, settings)))
+		}
+	}
+
+	if len(endpoints) == 0 {
+		return nil, nil, fmt.Errorf("no server addresses configured")
 	}
+
+	pool, err := NewEndpointPool(settings.Strategy, endpoints)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pool, tlsReloader, nil
 }
 
-func (m *ClientManager) SendMetrics(memStorage *storage.MemStorage, metrics []models.Metrics, localIP string) {
+// clientTLSConfig возвращает конфигурацию TLS для сервера address
+// или nil, если TLS не используется
+func clientTLSConfig(tlsReloader *tlsutil.Reloader, address string) *tls.Config {
+	if tlsReloader == nil {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	return tlsReloader.ClientConfig(host)
+}
+
+// Reload пересоздает клиента с новыми настройками (адрес, транспорт, ключи).
+// Отправки, начатые старым клиентом, завершаются до его закрытия,
+// а батчи из очереди отправляются уже новым клиентом.
+func (m *ClientManager) Reload(settings ClientSettings) error {
+	client, tlsReloader, err := newMetricClient(settings)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	oldClient := m.client
+	m.client = client
+	m.tls = tlsReloader
+	m.mu.Unlock()
+
+	if oldClient != nil {
+		oldClient.Close()
+	}
+
+	zap.L().Info("Client manager reloaded")
+	return nil
+}
+
+// ReloadTLS перечитывает сертификаты с диска. Новые соединения
+// используют обновленные сертификаты, пересоздавать клиента не нужно.
+func (m *ClientManager) ReloadTLS() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.tls == nil {
+		return nil
+	}
+	return m.tls.Reload()
+}
+
+func (m *ClientManager) SendMetrics(ctx context.Context, memStorage *storage.MemStorage, metrics []models.Metrics, localIP string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if m.client != nil {
-		m.client.SendMetrics(memStorage, metrics, localIP)
-	} else {
-		zap.L().Error("Client not initialized")
+		return m.client.SendMetrics(ctx, memStorage, metrics, localIP)
 	}
+	zap.L().Error("Client not initialized")
+	return fmt.Errorf("client not initialized")
 }
 
 func (m *ClientManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	if m.client != nil {
 		m.client.Close()
 	}
 }
 
 func (m *ClientManager) HealthCheck() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if m.client != nil {
 		return m.client.HealthCheck()
 	}
 	return fmt.Errorf("client not initialized")
-}
\ No newline at end of file
+}
+
+// FetchAgentConfig запрашивает у сервера настройки агента
+func (m *ClientManager) FetchAgentConfig(label string, localIP string) (*config.RemoteAgentConfig, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.client == nil {
+		return nil, fmt.Errorf("client not initialized")
+	}
+
+	agentConfig, err := m.client.FetchAgentConfig(label, localIP)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := agentConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid remote agent config: %w", err)
+	}
+	return agentConfig, nil
+}
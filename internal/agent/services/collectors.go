@@ -0,0 +1,39 @@
+package services
+
+import (
+	"github.com/MPoline/alert_service_yp/internal/config"
+)
+
+// CollectorSet описывает включенные сборщики метрик агента
+type CollectorSet struct {
+	// Runtime - сбор метрик runtime.MemStats, PollCount и RandomValue
+	Runtime bool
+	// System - сбор метрик памяти и загрузки CPU из gopsutil
+	System bool
+}
+
+// NewCollectorSet создает набор сборщиков по списку имен. Неизвестные имена игнорируются.
+func NewCollectorSet(names []string) CollectorSet {
+	var set CollectorSet
+	for _, name := range names {
+		switch name {
+		case config.CollectorRuntime:
+			set.Runtime = true
+		case config.CollectorSystem:
+			set.System = true
+		}
+	}
+	return set
+}
+
+// Names возвращает имена включенных сборщиков
+func (c CollectorSet) Names() []string {
+	names := []string{}
+	if c.Runtime {
+		names = append(names, config.CollectorRuntime)
+	}
+	if c.System {
+		names = append(names, config.CollectorSystem)
+	}
+	return names
+}
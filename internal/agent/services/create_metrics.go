@@ -25,11 +25,11 @@ func addNewMetrics() (float64, float64, []float64) {
 	return totalMemoryMB, freeMemoryMB, CPUutilization
 }
 
-func CreateMetrics(s *storage.MemStorage) (metricsStorage []models.Metrics) {
+func CreateMetrics(s *storage.MemStorage, collectors CollectorSet) (metricsStorage []models.Metrics) {
 	var wg sync.WaitGroup
 	resultCh := make(chan models.Metrics, len(s.Gauges)+len(s.Counters)+3)
 
-	wg.Add(3)
+	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
@@ -61,41 +61,10 @@ func CreateMetrics(s *storage.MemStorage) (metricsStorage []models.Metrics) {
 		}
 	}()
 
-	go func() {
-		defer wg.Done()
-		totalMemory, freeMemory, cpuUtilizations := addNewMetrics()
-
-		metrics := []struct {
-			id    string
-			value interface{}
-		}{
-			{"TotalMemory", totalMemory},
-			{"FreeMemory", freeMemory},
-			{"CPUutilization1", cpuUtilizations},
-		}
-
-		for _, newMetric := range metrics {
-			var m models.Metrics
-
-			switch v := newMetric.value.(type) {
-			case float64:
-				m = models.Metrics{
-					ID:    newMetric.id,
-					MType: "gauge",
-					Value: &v,
-				}
-			case []float64:
-				m = models.Metrics{
-					ID:    newMetric.id,
-					MType: "gauge",
-					Value: &v[0],
-				}
-			default:
-				zap.L().Error("Unsupported type")
-			}
-			resultCh <- m
-		}
-	}()
+	if collectors.System {
+		wg.Add(1)
+		go collectSystemMetrics(&wg, resultCh)
+	}
 
 	wg.Wait()
 	close(resultCh)
@@ -105,3 +74,40 @@ func CreateMetrics(s *storage.MemStorage) (metricsStorage []models.Metrics) {
 	}
 	return metricsStorage
 }
+
+// collectSystemMetrics собирает метрики памяти и загрузки CPU из gopsutil
+func collectSystemMetrics(wg *sync.WaitGroup, resultCh chan<- models.Metrics) {
+	defer wg.Done()
+	totalMemory, freeMemory, cpuUtilizations := addNewMetrics()
+
+	metrics := []struct {
+		id    string
+		value interface{}
+	}{
+		{"TotalMemory", totalMemory},
+		{"FreeMemory", freeMemory},
+		{"CPUutilization1", cpuUtilizations},
+	}
+
+	for _, newMetric := range metrics {
+		var m models.Metrics
+
+		switch v := newMetric.value.(type) {
+		case float64:
+			m = models.Metrics{
+				ID:    newMetric.id,
+				MType: "gauge",
+				Value: &v,
+			}
+		case []float64:
+			m = models.Metrics{
+				ID:    newMetric.id,
+				MType: "gauge",
+				Value: &v[0],
+			}
+		default:
+			zap.L().Error("Unsupported type")
+		}
+		resultCh <- m
+	}
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/MPoline/alert_service_yp/internal/config"
+	"github.com/MPoline/alert_service_yp/internal/models"
+	"github.com/MPoline/alert_service_yp/internal/storage"
+	"go.uber.org/zap"
+)
+
+// endpoint - клиент одного сервера с признаком доступности
+type endpoint struct {
+	address string
+	client  MetricClient
+	healthy atomic.Bool
+}
+
+func newEndpoint(address string, client MetricClient) *endpoint {
+	e := &endpoint{
+		address: address,
+		client:  client,
+	}
+	e.healthy.Store(true)
+	return e
+}
+
+// EndpointPool распределяет отправку метрик между несколькими серверами.
+// Реализует интерфейс MetricClient.
+//
+// Поддерживаемые стратегии:
+//   - failover: отправка на первый доступный сервер в порядке перечисления
+//   - round-robin: поочередная отправка на доступные серверы
+//   - broadcast: отправка на все доступные серверы
+//
+// Недоступные серверы пропускаются, пока HealthCheck не подтвердит их восстановление.
+type EndpointPool struct {
+	strategy  string
+	endpoints []*endpoint
+	next      atomic.Uint64
+}
+
+// NewEndpointPool создает пул клиентов с указанной стратегией
+func NewEndpointPool(strategy string, endpoints []*endpoint) (*EndpointPool, error) {
+	if !config.IsKnownStrategy(strategy) {
+		return nil, fmt.Errorf("unknown strategy %q", strategy)
+	}
+	if len(endpoints) == 0 {
+		return nil, errors.New("endpoint pool requires at least one endpoint")
+	}
+
+	return &EndpointPool{
+		strategy:  strategy,
+		endpoints: endpoints,
+	}, nil
+}
+
+// candidates возвращает серверы в порядке обращения согласно стратегии.
+// Если доступных серверов нет, возвращаются все, чтобы не прекращать попытки отправки.
+func (p *EndpointPool) candidates() []*endpoint {
+	ordered := p.endpoints
+	if p.strategy == config.StrategyRoundRobin {
+		start := int(p.next.Add(1)-1) % len(p.endpoints)
+		ordered = append(append([]*endpoint{}, p.endpoints[start:]...), p.endpoints[:start]...)
+	}
+
+	healthy := make([]*endpoint, 0, len(ordered))
+	for _, e := range ordered {
+		if e.healthy.Load() {
+			healthy = append(healthy, e)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return ordered
+	}
+	return healthy
+}
+
+// isEndpointFailure сообщает, что ошибка вызвана недоступностью сервера,
+// а не отказом в приеме метрик: только после таких ошибок имеет смысл
+// переходить на другой сервер
+func isEndpointFailure(err error) bool {
+	return IsRetryable(err) || errors.Is(err, ErrCircuitOpen)
+}
+
+// markUnhealthy помечает сервер недоступным до следующей успешной проверки
+func (p *EndpointPool) markUnhealthy(e *endpoint, err error) {
+	if e.healthy.Swap(false) {
+		zap.L().Warn("Endpoint marked unhealthy",
+			zap.String("address", e.address),
+			zap.Error(err))
+	}
+}
+
+// SendMetrics отправляет метрики согласно стратегии пула.
+// На следующий сервер метрики отправляются только при недоступности текущего;
+// отказ сервера в приеме метрик (неверные данные, подпись) возвращается сразу.
+func (p *EndpointPool) SendMetrics(ctx context.Context, memStorage *storage.MemStorage, metrics []models.Metrics, localIP string) error {
+	if p.strategy == config.StrategyBroadcast {
+		return p.broadcast(ctx, memStorage, metrics, localIP)
+	}
+
+	var errs []error
+	for _, e := range p.candidates() {
+		err := e.client.SendMetrics(ctx, memStorage, metrics, localIP)
+		if err == nil {
+			return nil
+		}
+		if !isEndpointFailure(err) {
+			return err
+		}
+
+		p.markUnhealthy(e, err)
+		errs = append(errs, fmt.Errorf("%s: %w", e.address, err))
+	}
+
+	return fmt.Errorf("failed to send metrics to any endpoint: %w", errors.Join(errs...))
+}
+
+// broadcast отправляет метрики на все доступные серверы параллельно.
+// Ошибка возвращается, только если отправка не удалась ни на один сервер.
+func (p *EndpointPool) broadcast(ctx context.Context, memStorage *storage.MemStorage, metrics []models.Metrics, localIP string) error {
+	candidates := p.candidates()
+	errs := make([]error, len(candidates))
+
+	var wg sync.WaitGroup
+	for i, e := range candidates {
+		wg.Add(1)
+		go func(i int, e *endpoint) {
+			defer wg.Done()
+			if err := e.client.SendMetrics(ctx, memStorage, metrics, localIP); err != nil {
+				if isEndpointFailure(err) {
+					p.markUnhealthy(e, err)
+				}
+				errs[i] = fmt.Errorf("%s: %w", e.address, err)
+			}
+		}(i, e)
+	}
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	if len(failed) == len(candidates) {
+		return fmt.Errorf("failed to send metrics to any endpoint: %w", errors.Join(failed...))
+	}
+	if len(failed) > 0 {
+		zap.L().Warn("Metrics were not delivered to some endpoints",
+			zap.Int("failed", len(failed)),
+			zap.Int("total", len(candidates)),
+			zap.Error(errors.Join(failed...)))
+	}
+	return nil
+}
+
+// HealthCheck проверяет все серверы пула и обновляет их доступность.
+// Возвращает ошибку, если недоступны все серверы.
+func (p *EndpointPool) HealthCheck() error {
+	var errs []error
+	for _, e := range p.endpoints {
+		if err := e.client.HealthCheck(); err != nil {
+			p.markUnhealthy(e, err)
+			errs = append(errs, fmt.Errorf("%s: %w", e.address, err))
+			continue
+		}
+
+		if !e.healthy.Swap(true) {
+			zap.L().Info("Endpoint recovered", zap.String("address", e.address))
+		}
+	}
+
+	if len(errs) == len(p.endpoints) {
+		return fmt.Errorf("all endpoints are unhealthy: %w", errors.Join(errs...))
+	}
+	if len(errs) > 0 {
+		zap.L().Warn("Some endpoints are unhealthy", zap.Error(errors.Join(errs...)))
+	}
+	return nil
+}
+
+// FetchAgentConfig запрашивает настройки агента у первого ответившего сервера
+func (p *EndpointPool) FetchAgentConfig(label string, localIP string) (*config.RemoteAgentConfig, error) {
+	var errs []error
+	for _, e := range p.candidates() {
+		agentConfig, err := e.client.FetchAgentConfig(label, localIP)
+		if err == nil {
+			return agentConfig, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", e.address, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// Close закрывает клиентов всех серверов пула
+func (p *EndpointPool) Close() {
+	for _, e := range p.endpoints {
+		e.client.Close()
+	}
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/MPoline/alert_service_yp/internal/config"
+	"github.com/MPoline/alert_service_yp/internal/models"
+	"github.com/MPoline/alert_service_yp/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeClient struct {
+	mu      sync.Mutex
+	sendErr error
+	sent    int
+}
+
+func (c *fakeClient) SendMetrics(ctx context.Context, memStorage *storage.MemStorage, metrics []models.Metrics, localIP string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent++
+	return c.sendErr
+}
+
+func (c *fakeClient) HealthCheck() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sendErr
+}
+
+func (c *fakeClient) FetchAgentConfig(label string, localIP string) (*config.RemoteAgentConfig, error) {
+	return &config.RemoteAgentConfig{}, nil
+}
+
+func (c *fakeClient) Close() {}
+
+func (c *fakeClient) sentCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sent
+}
+
+func TestEndpointPool(t *testing.T) {
+	t.Run("Failover skips unhealthy endpoint", func(t *testing.T) {
+		primary := &fakeClient{sendErr: syscall.ECONNREFUSED}
+		secondary := &fakeClient{}
+		pool, err := NewEndpointPool(config.StrategyFailover, []*endpoint{
+			newEndpoint("primary", primary),
+			newEndpoint("secondary", secondary),
+		})
+		if err != nil {
+			t.Fatalf("NewEndpointPool failed: %v", err)
+		}
+
+		for i := 0; i < 3; i++ {
+			if err := pool.SendMetrics(context.Background(), nil, nil, ""); err != nil {
+				t.Fatalf("SendMetrics failed: %v", err)
+			}
+		}
+		if primary.sentCount() != 1 || secondary.sentCount() != 3 {
+			t.Errorf("Unexpected sends: primary=%d secondary=%d", primary.sentCount(), secondary.sentCount())
+		}
+
+		primary.sendErr = nil
+		if err := pool.HealthCheck(); err != nil {
+			t.Fatalf("HealthCheck failed: %v", err)
+		}
+		if err := pool.SendMetrics(context.Background(), nil, nil, ""); err != nil {
+			t.Fatalf("SendMetrics failed: %v", err)
+		}
+		if primary.sentCount() != 2 {
+			t.Errorf("Recovered primary endpoint must be used again")
+		}
+	})
+
+	t.Run("Failover returns rejection without switching endpoint", func(t *testing.T) {
+		rejected := &HTTPStatusError{StatusCode: http.StatusBadRequest, Body: "invalid metric"}
+		tests := []struct {
+			name string
+			err  error
+		}{
+			{name: "HTTP 4xx", err: rejected},
+			{name: "gRPC InvalidArgument", err: status.Error(codes.InvalidArgument, "invalid metric")},
+			{name: "partial rejection", err: errors.New("gRPC server rejected 1 of 3 metrics: [invalid metric]")},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				primary := &fakeClient{sendErr: tt.err}
+				secondary := &fakeClient{}
+				pool, _ := NewEndpointPool(config.StrategyFailover, []*endpoint{
+					newEndpoint("primary", primary),
+					newEndpoint("secondary", secondary),
+				})
+
+				err := pool.SendMetrics(context.Background(), nil, nil, "")
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Expected the rejection to be returned as is, got %v", err)
+				}
+				if secondary.sentCount() != 0 {
+					t.Errorf("Rejected metrics must not be sent to another endpoint")
+				}
+
+				primary.sendErr = nil
+				_ = pool.SendMetrics(context.Background(), nil, nil, "")
+				if primary.sentCount() != 2 {
+					t.Errorf("Endpoint that rejected metrics must stay healthy")
+				}
+			})
+		}
+	})
+
+	t.Run("Failover on open circuit breaker", func(t *testing.T) {
+		primary := &fakeClient{sendErr: ErrCircuitOpen}
+		secondary := &fakeClient{}
+		pool, _ := NewEndpointPool(config.StrategyFailover, []*endpoint{
+			newEndpoint("primary", primary),
+			newEndpoint("secondary", secondary),
+		})
+
+		if err := pool.SendMetrics(context.Background(), nil, nil, ""); err != nil {
+			t.Fatalf("SendMetrics failed: %v", err)
+		}
+		if secondary.sentCount() != 1 {
+			t.Errorf("Metrics must be sent to the secondary endpoint")
+		}
+	})
+
+	t.Run("Round-robin", func(t *testing.T) {
+		first, second := &fakeClient{}, &fakeClient{}
+		pool, _ := NewEndpointPool(config.StrategyRoundRobin, []*endpoint{
+			newEndpoint("first", first),
+			newEndpoint("second", second),
+		})
+
+		for i := 0; i < 4; i++ {
+			_ = pool.SendMetrics(context.Background(), nil, nil, "")
+		}
+		if first.sentCount() != 2 || second.sentCount() != 2 {
+			t.Errorf("Unexpected sends: first=%d second=%d", first.sentCount(), second.sentCount())
+		}
+	})
+
+	t.Run("Broadcast", func(t *testing.T) {
+		first, second := &fakeClient{}, &fakeClient{sendErr: status.Error(codes.Unavailable, "unavailable")}
+		pool, _ := NewEndpointPool(config.StrategyBroadcast, []*endpoint{
+			newEndpoint("first", first),
+			newEndpoint("second", second),
+		})
+
+		if err := pool.SendMetrics(context.Background(), nil, nil, ""); err != nil {
+			t.Errorf("Broadcast must succeed when at least one endpoint succeeded: %v", err)
+		}
+		if first.sentCount() != 1 || second.sentCount() != 1 {
+			t.Errorf("Unexpected sends: first=%d second=%d", first.sentCount(), second.sentCount())
+		}
+	})
+
+	t.Run("Unknown strategy", func(t *testing.T) {
+		if _, err := NewEndpointPool("random", []*endpoint{newEndpoint("a", &fakeClient{})}); err == nil {
+			t.Error("Expected error for unknown strategy")
+		}
+	})
+}
@@ -58,3 +58,15 @@ func GetMetrics(s *storage.MemStorage, neсMetrics []string) {
 	s.Counters["PollCount"]++
 	s.Gauges["RandomValue"] = rand.Float64()
 }
+
+// RemoveRuntimeMetrics удаляет из хранилища gauge-метрики, собираемые GetMetrics.
+// Используется при отключении сборщика runtime, чтобы не отправлять устаревшие значения.
+func RemoveRuntimeMetrics(s *storage.MemStorage, neсMetrics []string) {
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	for _, metricName := range neсMetrics {
+		delete(s.Gauges, metricName)
+	}
+	delete(s.Gauges, "RandomValue")
+}
@@ -3,33 +3,57 @@ package services
 import (
 	"context"
 	"crypto/rsa"
+	"crypto/tls"
+	"encoding/base64"
 	"fmt"
 	"time"
 
-	"github.com/MPoline/alert_service_yp/internal/agent/flags"
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/apitoken"
+	"github.com/MPoline/alert_service_yp/internal/config"
 	"github.com/MPoline/alert_service_yp/internal/crypto"
 	"github.com/MPoline/alert_service_yp/internal/models"
 	"github.com/MPoline/alert_service_yp/internal/proto"
+	"github.com/MPoline/alert_service_yp/internal/replay"
 	"github.com/MPoline/alert_service_yp/internal/storage"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
 )
 
 type GRPCClient struct {
 	client          proto.MetricsServiceClient
+	health          healthpb.HealthClient
 	conn            *grpc.ClientConn
 	metricProcessor *MetricProcessor
+	retryPolicy     RetryPolicy
+	breaker         *CircuitBreaker
+	stream          *MetricStream
 }
 
-func NewGRPCClient() (*GRPCClient, error) {
-	address := flags.FlagGRPCAddress
-	if address == "" {
-		address = flags.FlagRunAddr
+// NewGRPCClient создает gRPC клиента для сервера с указанным адресом.
+// Если tlsConfig не nil, соединение устанавливается по TLS.
+// Если signer не nil, запросы подписываются ключом агента.
+func NewGRPCClient(address string, tlsConfig *tls.Config, signer *agentkey.Signer, settings ClientSettings) (*GRPCClient, error) {
+	transportCreds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		transportCreds = credentials.NewTLS(tlsConfig)
 	}
 
 	conn, err := grpc.NewClient(address,
-		grpc.WithTransportCredentials(insecure.NewCredentials()))
+		grpc.WithTransportCredentials(transportCreds),
+		grpc.WithChainUnaryInterceptor(
+			tokenInterceptor(settings.APIToken),
+			signingInterceptor(settings.Key, settings.KeyID, settings.HashAlg, signer)),
+		grpc.WithChainStreamInterceptor(
+			tokenStreamInterceptor(settings.APIToken),
+			signingStreamInterceptor(settings.KeyID, settings.HashAlg, signer)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to gRPC server: %w", err)
 	}
@@ -37,20 +61,27 @@ func NewGRPCClient() (*GRPCClient, error) {
 	client := proto.NewMetricsServiceClient(conn)
 
 	var pubKey *rsa.PublicKey
-	if flags.FlagCryptoKey != "" {
-		pubKey, err = crypto.LoadPublicKey(flags.FlagCryptoKey)
+	if settings.CryptoKey != "" {
+		pubKey, err = crypto.LoadPublicKey(settings.CryptoKey)
 		if err != nil {
 			conn.Close()
 			return nil, fmt.Errorf("failed to load public key: %w", err)
 		}
 	}
 
-	metricProcessor := NewMetricProcessor(pubKey, flags.FlagKey)
+	metricProcessor := NewMetricProcessor(pubKey, settings.Key, settings.HashAlg, signer)
 
 	grpcClient := &GRPCClient{
 		client:          client,
+		health:          healthpb.NewHealthClient(conn),
 		conn:            conn,
 		metricProcessor: metricProcessor,
+		retryPolicy:     settings.retryPolicy(),
+		breaker:         settings.circuitBreaker(),
+	}
+
+	if settings.GRPCStream {
+		grpcClient.stream = NewMetricStream(client, settings.Key, settings.HashAlg, signer)
 	}
 
 	zap.L().Info("gRPC client initialized successfully",
@@ -59,6 +90,9 @@ func NewGRPCClient() (*GRPCClient, error) {
 }
 
 func (c *GRPCClient) Close() {
+	if c.stream != nil {
+		c.stream.Close()
+	}
 	if c.conn != nil {
 		if err := c.conn.Close(); err != nil {
 			zap.L().Error("Failed to close gRPC connection", zap.Error(err))
@@ -69,47 +103,289 @@ func (c *GRPCClient) Close() {
 }
 
 // SendMetrics отправляет метрики на сервер через gRPC
-func (c *GRPCClient) SendMetrics(memStorage *storage.MemStorage, metrics []models.Metrics, localIP string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
+func (c *GRPCClient) SendMetrics(ctx context.Context, memStorage *storage.MemStorage, metrics []models.Metrics, localIP string) error {
 	protoMetrics := c.metricProcessor.ProcessMetrics(metrics)
 
 	if len(protoMetrics) == 0 {
 		zap.L().Warn("No valid metrics to send via gRPC")
-		return
+		return nil
 	}
 
-	req := &proto.UpdateMetricsRequest{Metrics: protoMetrics}
-	resp, err := c.client.UpdateMetrics(ctx, req)
+	if c.stream != nil {
+		return c.sendMetricsStream(ctx, protoMetrics, localIP)
+	}
+
+	// Повторно отправляются только метрики, отклоненные с повторяемым статусом
+	pending := protoMetrics
+	var rejected []string
+	err := c.retryPolicy.Do(ctx, c.breaker, func(ctx context.Context) error {
+		attemptCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		attemptCtx = metadata.AppendToOutgoingContext(attemptCtx, proto.MetadataRealIP, localIP)
+		resp, err := c.client.UpdateMetrics(attemptCtx, &proto.UpdateMetricsRequest{Metrics: pending})
+		if err != nil {
+			if detailed := responseFromStatus(err); detailed != nil {
+				pending, rejected = splitResults(pending, detailed.Results, rejected)
+			}
+			return err
+		}
+
+		// Сервер без результатов по метрикам сообщает об ошибках только текстом
+		if len(resp.Results) == 0 {
+			if resp.Error != "" {
+				return fmt.Errorf("gRPC server returned error: %s", resp.Error)
+			}
+			return nil
+		}
+
+		pending, rejected = splitResults(pending, resp.Results, rejected)
+		if len(pending) > 0 {
+			return status.Errorf(codes.Unavailable, "%d metrics failed with retryable errors", len(pending))
+		}
+		return nil
+	})
 	if err != nil {
 		zap.L().Error("Failed to send metrics via gRPC",
 			zap.Error(err),
 			zap.String("agent_ip", localIP),
-			zap.Int("metrics_count", len(protoMetrics)))
-		return
+			zap.Int("metrics_count", len(protoMetrics)),
+			zap.Int("pending_count", len(pending)))
+		return fmt.Errorf("failed to send metrics via gRPC: %w", err)
 	}
 
-	if resp.Error != "" {
-		zap.L().Error("gRPC server returned error",
-			zap.String("error", resp.Error),
+	if len(rejected) > 0 {
+		zap.L().Error("gRPC server rejected metrics",
+			zap.Strings("reasons", rejected),
 			zap.String("agent_ip", localIP))
-		return
+		return fmt.Errorf("gRPC server rejected %d of %d metrics: %v", len(rejected), len(protoMetrics), rejected)
 	}
 
 	zap.L().Info("Metrics sent successfully via gRPC",
 		zap.Int("metrics_count", len(protoMetrics)),
 		zap.String("agent_ip", localIP))
+	return nil
+}
+
+// tokenInterceptor передает токен API в метаданных authorization всех запросов.
+// Пустой токен не передается.
+func tokenInterceptor(token string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, apitoken.MetadataAuthorization, apitoken.Bearer(token))
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// tokenStreamInterceptor передает токен API в метаданных authorization при открытии потока
+func tokenStreamInterceptor(token string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, apitoken.MetadataAuthorization, apitoken.Bearer(token))
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// signingInterceptor подписывает изменяющие запросы ключом key алгоритмом hashAlg и передает
+// подпись в метаданных hashsha256, алгоритм - в x-hash-alg, а идентификатор ключа keyID - в x-key-id.
+// Если задан signer, запрос дополнительно подписывается ключом агента (x-agent-id, x-signature).
+// Время и nonce подписи передаются в x-timestamp и x-nonce и обновляются
+// при каждой попытке отправки. Без ключа и signer запросы не подписываются.
+func signingInterceptor(key, keyID, hashAlg string, signer *agentkey.Signer) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		msg, ok := req.(protobuf.Message)
+		if (key != "" || signer != nil) && ok && (method == proto.MetricsService_UpdateMetrics_FullMethodName ||
+			method == proto.MetricsService_UpdateMetric_FullMethodName) {
+			timestamp := replay.Timestamp(time.Now())
+			nonce := replay.NewNonce()
+			ctx = metadata.AppendToOutgoingContext(ctx,
+				replay.MetadataTimestamp, timestamp,
+				replay.MetadataNonce, nonce)
+
+			if key != "" {
+				signature, err := proto.RequestSignature(msg, key, hashAlg, timestamp, nonce)
+				if err != nil {
+					return fmt.Errorf("failed to sign request: %w", err)
+				}
+				ctx = metadata.AppendToOutgoingContext(ctx,
+					proto.MetadataHash, signature,
+					proto.MetadataHashAlg, hashAlg)
+				if keyID != "" {
+					ctx = metadata.AppendToOutgoingContext(ctx, proto.MetadataKeyID, keyID)
+				}
+			}
+
+			if signer != nil {
+				data, err := proto.SignatureData(msg)
+				if err != nil {
+					return fmt.Errorf("failed to sign request: %w", err)
+				}
+				ctx = metadata.AppendToOutgoingContext(ctx,
+					agentkey.MetadataAgentID, signer.AgentID(),
+					agentkey.MetadataSignature, base64.StdEncoding.EncodeToString(signer.Sign(replay.SignedData(timestamp, nonce, data))))
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// signingStreamInterceptor передает идентификатор ключа подписи, алгоритм и идентификатор
+// агента при открытии потока, по ним сервер проверяет подписи батчей и метрик в потоке
+func signingStreamInterceptor(keyID, hashAlg string, signer *agentkey.Signer) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if keyID != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, proto.MetadataKeyID, keyID)
+		}
+		if hashAlg != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, proto.MetadataHashAlg, hashAlg)
+		}
+		if signer != nil {
+			ctx = metadata.AppendToOutgoingContext(ctx, agentkey.MetadataAgentID, signer.AgentID())
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// responseFromStatus извлекает результаты по метрикам из деталей статуса ошибки
+func responseFromStatus(err error) *proto.UpdateMetricsResponse {
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil
+	}
+	for _, detail := range st.Details() {
+		if resp, ok := detail.(*proto.UpdateMetricsResponse); ok {
+			return resp
+		}
+	}
+	return nil
+}
+
+// splitResults разделяет неудачные метрики на повторяемые, которые возвращаются
+// для повторной отправки, и отклоненные окончательно, причины которых добавляются к rejected
+func splitResults(sent []*proto.Metric, results []*proto.MetricResult, rejected []string) ([]*proto.Metric, []string) {
+	var retry []*proto.Metric
+	for _, r := range results {
+		code := codes.Code(r.Status)
+		if code == codes.OK {
+			continue
+		}
+		if r.Index < 0 || int(r.Index) >= len(sent) {
+			rejected = append(rejected, r.Reason)
+			continue
+		}
+		if IsRetryable(status.Error(code, r.Reason)) {
+			retry = append(retry, sent[r.Index])
+		} else {
+			rejected = append(rejected, r.Reason)
+		}
+	}
+	return retry, rejected
+}
+
+// sendMetricsStream отправляет батч через постоянный поток StreamMetrics
+// и ожидает подтверждения сервером. Если сервер применил батч частично,
+// повторно отправляются только метрики, отклоненные с повторяемым статусом.
+func (c *GRPCClient) sendMetricsStream(ctx context.Context, protoMetrics []*proto.Metric, localIP string) error {
+	pending := protoMetrics
+	var rejected []string
+	err := c.retryPolicy.Do(ctx, c.breaker, func(ctx context.Context) error {
+		attemptCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+
+		ack, err := c.stream.Send(attemptCtx, pending, localIP)
+		if err != nil {
+			return err
+		}
+		if ack.Applied {
+			return nil
+		}
+
+		// Батч отклонен целиком (подпись, повтор, пустой батч)
+		if len(ack.Results) == 0 {
+			return fmt.Errorf("gRPC server rejected batch %d: %s", ack.Seq, ack.Error)
+		}
+
+		pending, rejected = splitResults(pending, ack.Results, rejected)
+		if len(pending) > 0 {
+			return status.Errorf(codes.Unavailable, "%d metrics of batch %d failed with retryable errors", len(pending), ack.Seq)
+		}
+		return nil
+	})
+	if err != nil {
+		zap.L().Error("Failed to send metrics via gRPC stream",
+			zap.Error(err),
+			zap.String("agent_ip", localIP),
+			zap.Int("metrics_count", len(protoMetrics)),
+			zap.Int("pending_count", len(pending)))
+		return fmt.Errorf("failed to send metrics via gRPC stream: %w", err)
+	}
+
+	if len(rejected) > 0 {
+		zap.L().Error("gRPC server rejected metrics",
+			zap.Strings("reasons", rejected),
+			zap.String("agent_ip", localIP))
+		return fmt.Errorf("gRPC server rejected %d of %d metrics: %v", len(rejected), len(protoMetrics), rejected)
+	}
+
+	zap.L().Info("Metrics batch acknowledged via gRPC stream",
+		zap.Int("metrics_count", len(protoMetrics)),
+		zap.String("agent_ip", localIP))
+	return nil
 }
 
+// HealthCheck проверяет готовность сервера через grpc.health.v1.Health.
+// Если сервер не поддерживает стандартный сервис проверки, используется Ping.
 func (c *GRPCClient) HealthCheck() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := c.client.Ping(ctx, &proto.PingRequest{})
-	if err != nil {
+	resp, err := c.health.Check(ctx, &healthpb.HealthCheckRequest{
+		Service: proto.MetricsService_ServiceDesc.ServiceName,
+	})
+	switch {
+	case err == nil:
+		if resp.Status != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("gRPC health check failed: server status %s", resp.Status)
+		}
+		return nil
+	case status.Code(err) != codes.Unimplemented:
+		return fmt.Errorf("gRPC health check failed: %w", err)
+	}
+
+	if _, err := c.client.Ping(ctx, &proto.PingRequest{}); err != nil {
 		return fmt.Errorf("gRPC health check failed: %w", err)
 	}
 
 	return nil
 }
+
+// FetchAgentConfig запрашивает настройки агента через gRPC
+func (c *GRPCClient) FetchAgentConfig(label string, localIP string) (*config.RemoteAgentConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Адрес учитывается сервером, только если агент подключен через доверенный прокси
+	ctx = metadata.AppendToOutgoingContext(ctx, proto.MetadataRealIP, localIP)
+	resp, err := c.client.GetAgentConfig(ctx, &proto.AgentConfigRequest{Label: label})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch agent config via gRPC: %w", err)
+	}
+
+	return &config.RemoteAgentConfig{
+		PollInterval:   config.Duration(agentConfigInterval(resp.PollIntervalMs, resp.PollIntervalSeconds)),
+		ReportInterval: config.Duration(agentConfigInterval(resp.ReportIntervalMs, resp.ReportIntervalSeconds)),
+		Collectors:     resp.Collectors,
+		Labels:         resp.Labels,
+	}, nil
+}
+
+// agentConfigInterval возвращает интервал из ответа сервера. Серверы,
+// не заполняющие поля в миллисекундах, передают интервал в целых секундах.
+func agentConfigInterval(ms, seconds int64) time.Duration {
+	if ms != 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return time.Duration(seconds) * time.Second
+}
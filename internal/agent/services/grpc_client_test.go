@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/models"
+	"github.com/MPoline/alert_service_yp/internal/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// resultServer отвечает на UpdateMetrics результатами по метрикам:
+// метрики с префиксом "flaky" отклоняются один раз как Unavailable,
+// метрики с префиксом "bad" всегда отклоняются как InvalidArgument
+type resultServer struct {
+	proto.UnimplementedMetricsServiceServer
+
+	mu       sync.Mutex
+	requests [][]string
+	failed   map[string]bool
+}
+
+func (s *resultServer) UpdateMetrics(ctx context.Context, req *proto.UpdateMetricsRequest) (*proto.UpdateMetricsResponse, error) {
+	return &proto.UpdateMetricsResponse{Results: s.results(req.Metrics)}, nil
+}
+
+// StreamMetrics подтверждает батчи потока с теми же результатами по метрикам
+func (s *resultServer) StreamMetrics(stream proto.MetricsService_StreamMetricsServer) error {
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ack := &proto.BatchAck{Seq: batch.Seq, Applied: true}
+		results := s.results(batch.Metrics)
+		for _, r := range results {
+			if r.Status != uint32(codes.OK) {
+				ack.Applied = false
+				ack.Results = results
+				break
+			}
+		}
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *resultServer) results(metrics []*proto.Metric) []*proto.MetricResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+	var results []*proto.MetricResult
+	for i, m := range metrics {
+		ids = append(ids, m.Id)
+		result := &proto.MetricResult{Index: int32(i)}
+		switch {
+		case strings.HasPrefix(m.Id, "flaky") && !s.failed[m.Id]:
+			s.failed[m.Id] = true
+			result.Status = uint32(codes.Unavailable)
+			result.Reason = "storage unavailable"
+		case strings.HasPrefix(m.Id, "bad"):
+			result.Status = uint32(codes.InvalidArgument)
+			result.Reason = "invalid metric"
+		}
+		results = append(results, result)
+	}
+	s.requests = append(s.requests, ids)
+	return results
+}
+
+func TestGRPCClientRetriesOnlyFailedMetrics(t *testing.T) {
+	server := &resultServer{failed: make(map[string]bool)}
+	client := &GRPCClient{
+		client:          newBufconnClient(t, server),
+		metricProcessor: NewMetricProcessor(nil, "", "", nil),
+		retryPolicy:     fastPolicy(3),
+	}
+
+	metrics := []models.Metrics{
+		newGauge("ok", 1),
+		newGauge("flaky", 2),
+		newGauge("bad", 3),
+	}
+
+	err := client.SendMetrics(context.Background(), nil, metrics, "127.0.0.1")
+	if err == nil || !strings.Contains(err.Error(), "rejected 1 of 3") {
+		t.Fatalf("expected rejection of the invalid metric, got %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if len(server.requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d: %v", len(server.requests), server.requests)
+	}
+	if retried := server.requests[1]; len(retried) != 1 || retried[0] != "flaky" {
+		t.Errorf("expected only the flaky metric to be retried, got %v", retried)
+	}
+}
+
+func TestGRPCClientStreamRetriesOnlyFailedMetrics(t *testing.T) {
+	server := &resultServer{failed: make(map[string]bool)}
+	stream := NewMetricStream(newBufconnClient(t, server), "", "", nil)
+	t.Cleanup(stream.Close)
+	client := &GRPCClient{
+		metricProcessor: NewMetricProcessor(nil, "", "", nil),
+		retryPolicy:     fastPolicy(3),
+		stream:          stream,
+	}
+
+	metrics := []models.Metrics{
+		newGauge("ok", 1),
+		newGauge("flaky", 2),
+		newGauge("bad", 3),
+	}
+
+	err := client.SendMetrics(context.Background(), nil, metrics, "127.0.0.1")
+	if err == nil || !strings.Contains(err.Error(), "rejected 1 of 3") {
+		t.Fatalf("expected rejection of the invalid metric, got %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if len(server.requests) != 2 {
+		t.Fatalf("expected 2 batches, got %d: %v", len(server.requests), server.requests)
+	}
+	if retried := server.requests[1]; len(retried) != 1 || retried[0] != "flaky" {
+		t.Errorf("expected only the flaky metric to be resent, got %v", retried)
+	}
+}
+
+// pingServer отвечает только на Ping
+type pingServer struct {
+	proto.UnimplementedMetricsServiceServer
+}
+
+func (pingServer) Ping(ctx context.Context, req *proto.PingRequest) (*proto.PingResponse, error) {
+	return &proto.PingResponse{Status: "ok"}, nil
+}
+
+func TestGRPCClientHealthCheck(t *testing.T) {
+	t.Run("falls back to Ping", func(t *testing.T) {
+		conn := newBufconnConn(t, func(s *grpc.Server) {
+			proto.RegisterMetricsServiceServer(s, pingServer{})
+		})
+		client := &GRPCClient{client: proto.NewMetricsServiceClient(conn), health: healthpb.NewHealthClient(conn)}
+
+		if err := client.HealthCheck(); err != nil {
+			t.Fatalf("expected healthy server via Ping, got %v", err)
+		}
+	})
+
+	t.Run("uses health service", func(t *testing.T) {
+		healthServer := health.NewServer()
+		healthServer.SetServingStatus(proto.MetricsService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+
+		conn := newBufconnConn(t, func(s *grpc.Server) {
+			proto.RegisterMetricsServiceServer(s, pingServer{})
+			healthpb.RegisterHealthServer(s, healthServer)
+		})
+		client := &GRPCClient{client: proto.NewMetricsServiceClient(conn), health: healthpb.NewHealthClient(conn)}
+
+		if err := client.HealthCheck(); err == nil {
+			t.Fatal("expected NOT_SERVING status to fail the health check")
+		}
+
+		healthServer.SetServingStatus(proto.MetricsService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+		if err := client.HealthCheck(); err != nil {
+			t.Fatalf("expected healthy server, got %v", err)
+		}
+	})
+}
+
+// agentConfigServer возвращает заданный ответ на GetAgentConfig
+type agentConfigServer struct {
+	proto.UnimplementedMetricsServiceServer
+	resp *proto.AgentConfigResponse
+}
+
+func (s agentConfigServer) GetAgentConfig(ctx context.Context, req *proto.AgentConfigRequest) (*proto.AgentConfigResponse, error) {
+	return s.resp, nil
+}
+
+func TestGRPCClientFetchAgentConfigIntervals(t *testing.T) {
+	tests := []struct {
+		name   string
+		resp   *proto.AgentConfigResponse
+		poll   time.Duration
+		report time.Duration
+	}{
+		{
+			name:   "milliseconds",
+			resp:   &proto.AgentConfigResponse{PollIntervalMs: 500, ReportIntervalMs: 2500, ReportIntervalSeconds: 2},
+			poll:   500 * time.Millisecond,
+			report: 2500 * time.Millisecond,
+		},
+		{
+			name:   "seconds from older server",
+			resp:   &proto.AgentConfigResponse{PollIntervalSeconds: 1, ReportIntervalSeconds: 10},
+			poll:   time.Second,
+			report: 10 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &GRPCClient{client: newBufconnClient(t, agentConfigServer{resp: tt.resp})}
+
+			agentConfig, err := client.FetchAgentConfig("", "127.0.0.1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := agentConfig.PollInterval.ToDuration(); got != tt.poll {
+				t.Errorf("poll interval: expected %v, got %v", tt.poll, got)
+			}
+			if got := agentConfig.ReportInterval.ToDuration(); got != tt.report {
+				t.Errorf("report interval: expected %v, got %v", tt.report, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/proto"
+	"github.com/MPoline/alert_service_yp/internal/replay"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ErrBatchUnacknowledged возвращается, если батч записан в поток, но подтверждение
+// не получено: истекло ожидание или поток оборвался. Сервер мог применить батч,
+// поэтому он не отправляется повторно - повтор прибавил бы дельты counter дважды.
+var ErrBatchUnacknowledged = errors.New("metrics batch was sent but not acknowledged")
+
+// streamResult - результат отправки батча через поток
+type streamResult struct {
+	ack *proto.BatchAck
+	err error
+}
+
+// streamSession - один открытый поток StreamMetrics с батчами, ожидающими подтверждения
+type streamSession struct {
+	stream proto.MetricsService_StreamMetricsClient
+	cancel context.CancelFunc
+
+	// sendMu сериализует Send: отправка в поток из нескольких горутин не допускается
+	sendMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint64]chan streamResult
+	err     error
+}
+
+// fail закрывает сессию и завершает ожидающие отправки ошибкой
+func (s *streamSession) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return
+	}
+	s.err = err
+	s.cancel()
+
+	for seq, ch := range s.pending {
+		ch <- streamResult{err: err}
+		delete(s.pending, seq)
+	}
+}
+
+// receive читает подтверждения и передает их ожидающим отправкам
+func (s *streamSession) receive() {
+	for {
+		ack, err := s.stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				err = status.Error(codes.Unavailable, "metrics stream closed by server")
+			}
+			s.fail(err)
+			return
+		}
+
+		s.mu.Lock()
+		ch, ok := s.pending[ack.Seq]
+		delete(s.pending, ack.Seq)
+		s.mu.Unlock()
+
+		if ok {
+			ch <- streamResult{ack: ack}
+		} else {
+			zap.L().Warn("Received ack for unknown batch", zap.Uint64("seq", ack.Seq))
+		}
+	}
+}
+
+// MetricStream держит открытым поток StreamMetrics и отправляет через него батчи.
+// Каждый батч получает порядковый номер, по которому сервер его подтверждает.
+// При обрыве поток открывается заново при следующей отправке.
+type MetricStream struct {
+	client  proto.MetricsServiceClient
+	key     string
+	hashAlg string
+	signer  *agentkey.Signer
+
+	mu      sync.Mutex
+	session *streamSession
+	seq     uint64
+}
+
+// NewMetricStream создает поток отправки метрик поверх gRPC клиента.
+// Непустой key включает подпись каждого батча алгоритмом hashAlg,
+// signer - подпись ключом Ed25519 агента.
+func NewMetricStream(client proto.MetricsServiceClient, key, hashAlg string, signer *agentkey.Signer) *MetricStream {
+	return &MetricStream{client: client, key: key, hashAlg: hashAlg, signer: signer}
+}
+
+// acquire возвращает текущую сессию, открывая поток при необходимости,
+// и регистрирует ожидание подтверждения для очередного батча
+func (m *MetricStream) acquire(localIP string) (*streamSession, uint64, chan streamResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session := m.session
+	if session != nil {
+		session.mu.Lock()
+		closed := session.err != nil
+		session.mu.Unlock()
+		if closed {
+			session = nil
+		}
+	}
+
+	if session == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		ctx = metadata.AppendToOutgoingContext(ctx, proto.MetadataRealIP, localIP)
+		stream, err := m.client.StreamMetrics(ctx)
+		if err != nil {
+			cancel()
+			return nil, 0, nil, err
+		}
+
+		session = &streamSession{
+			stream:  stream,
+			cancel:  cancel,
+			pending: make(map[uint64]chan streamResult),
+		}
+		m.session = session
+		go session.receive()
+
+		zap.L().Info("gRPC metrics stream opened")
+	}
+
+	m.seq++
+	ch := make(chan streamResult, 1)
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.err != nil {
+		return nil, 0, nil, session.err
+	}
+	session.pending[m.seq] = ch
+
+	return session, m.seq, ch, nil
+}
+
+// Send отправляет батч и ожидает его подтверждения сервером.
+// localIP передается серверу в метаданных при открытии потока.
+// Если батч записан в поток, но не подтвержден, возвращается ErrBatchUnacknowledged.
+func (m *MetricStream) Send(ctx context.Context, metrics []*proto.Metric, localIP string) (*proto.BatchAck, error) {
+	session, seq, ch, err := m.acquire(localIP)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := m.signedBatch(seq, metrics)
+	if err != nil {
+		session.mu.Lock()
+		delete(session.pending, seq)
+		session.mu.Unlock()
+		return nil, fmt.Errorf("failed to sign batch: %w", err)
+	}
+
+	session.sendMu.Lock()
+	err = session.stream.Send(batch)
+	session.sendMu.Unlock()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = status.Error(codes.Unavailable, "metrics stream closed")
+		}
+		session.fail(err)
+		return nil, err
+	}
+
+	select {
+	case result := <-ch:
+		if result.err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrBatchUnacknowledged, result.err)
+		}
+		return result.ack, nil
+	case <-ctx.Done():
+		session.mu.Lock()
+		delete(session.pending, seq)
+		session.mu.Unlock()
+		return nil, fmt.Errorf("%w: %w", ErrBatchUnacknowledged, ctx.Err())
+	}
+}
+
+// signedBatch создает батч с временем и nonce и подписывает его
+// общим секретом и ключом агента, если они заданы
+func (m *MetricStream) signedBatch(seq uint64, metrics []*proto.Metric) (*proto.MetricsBatch, error) {
+	batch := &proto.MetricsBatch{Seq: seq, Metrics: metrics}
+	if m.key == "" && m.signer == nil {
+		return batch, nil
+	}
+
+	batch.Timestamp = time.Now().Unix()
+	batch.Nonce = replay.NewNonce()
+
+	if m.key != "" {
+		if err := proto.SignBatch(batch, m.key, m.hashAlg); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.signer != nil {
+		data, err := proto.BatchSignatureData(batch)
+		if err != nil {
+			return nil, err
+		}
+		batch.Signature = m.signer.Sign(data)
+	}
+	return batch, nil
+}
+
+// Close закрывает поток
+func (m *MetricStream) Close() {
+	m.mu.Lock()
+	session := m.session
+	m.session = nil
+	m.mu.Unlock()
+
+	if session != nil {
+		session.sendMu.Lock()
+		_ = session.stream.CloseSend()
+		session.sendMu.Unlock()
+		session.fail(status.Error(codes.Canceled, "metrics stream closed"))
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/MPoline/alert_service_yp/internal/models"
+	"github.com/MPoline/alert_service_yp/internal/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// ackServer подтверждает каждый батч и обрывает поток после dropAfter батчей
+type ackServer struct {
+	proto.UnimplementedMetricsServiceServer
+	dropAfter int
+	streams   atomic.Int32
+}
+
+func (s *ackServer) StreamMetrics(stream proto.MetricsService_StreamMetricsServer) error {
+	s.streams.Add(1)
+	for received := 0; ; received++ {
+		if s.dropAfter > 0 && received == s.dropAfter {
+			return nil
+		}
+
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := stream.Send(&proto.BatchAck{Seq: batch.Seq, Applied: true}); err != nil {
+			return err
+		}
+	}
+}
+
+// newBufconnConn поднимает gRPC сервер поверх bufconn и возвращает соединение с ним.
+// register регистрирует сервисы на сервере.
+func newBufconnConn(t *testing.T, register func(*grpc.Server)) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	grpcSrv := grpc.NewServer()
+	register(grpcSrv)
+	go func() { _ = grpcSrv.Serve(lis) }()
+	t.Cleanup(grpcSrv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// newBufconnClient возвращает клиента MetricsService, обслуживаемого server
+func newBufconnClient(t *testing.T, server proto.MetricsServiceServer) proto.MetricsServiceClient {
+	t.Helper()
+
+	conn := newBufconnConn(t, func(s *grpc.Server) {
+		proto.RegisterMetricsServiceServer(s, server)
+	})
+	return proto.NewMetricsServiceClient(conn)
+}
+
+func newTestMetricStream(t *testing.T, server *ackServer) *MetricStream {
+	t.Helper()
+
+	stream := NewMetricStream(newBufconnClient(t, server), "", "", nil)
+	t.Cleanup(stream.Close)
+	return stream
+}
+
+func TestMetricStreamAcks(t *testing.T) {
+	stream := newTestMetricStream(t, &ackServer{})
+	metrics := []*proto.Metric{{Id: "Alloc", Mtype: "gauge", Value: 1}}
+
+	for want := uint64(1); want <= 3; want++ {
+		ack, err := stream.Send(context.Background(), metrics, "127.0.0.1")
+		if err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		if ack.Seq != want || !ack.Applied {
+			t.Fatalf("expected applied ack for batch %d, got %+v", want, ack)
+		}
+	}
+}
+
+func TestMetricStreamReopens(t *testing.T) {
+	server := &ackServer{dropAfter: 1}
+	stream := newTestMetricStream(t, server)
+	metrics := []*proto.Metric{{Id: "Alloc", Mtype: "gauge", Value: 1}}
+
+	if _, err := stream.Send(context.Background(), metrics, "127.0.0.1"); err != nil {
+		t.Fatalf("first Send failed: %v", err)
+	}
+
+	// Сервер закрыл поток: батч уходит в новый поток или, если он был записан
+	// в закрытый поток, отправка завершается ошибкой без подтверждения
+	_, err := stream.Send(context.Background(), metrics, "127.0.0.1")
+	if err != nil && !IsRetryable(err) && !errors.Is(err, ErrBatchUnacknowledged) {
+		t.Fatalf("expected retryable or unacknowledged error after stream drop, got %v", err)
+	}
+
+	err = fastPolicy(3).Do(context.Background(), nil, func(ctx context.Context) error {
+		_, err := stream.Send(ctx, metrics, "127.0.0.1")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Send after reconnect failed: %v", err)
+	}
+	if server.streams.Load() < 2 {
+		t.Errorf("expected stream to be reopened, got %d streams", server.streams.Load())
+	}
+}
+
+// dropServer принимает батч и обрывает поток, не подтвердив его
+type dropServer struct {
+	proto.UnimplementedMetricsServiceServer
+	received atomic.Int32
+}
+
+func (s *dropServer) StreamMetrics(stream proto.MetricsService_StreamMetricsServer) error {
+	if _, err := stream.Recv(); err != nil {
+		return err
+	}
+	s.received.Add(1)
+	return status.Error(codes.Unavailable, "server is shutting down")
+}
+
+func TestGRPCClientStreamDoesNotResendUnacknowledgedBatch(t *testing.T) {
+	server := &dropServer{}
+	stream := NewMetricStream(newBufconnClient(t, server), "", "", nil)
+	t.Cleanup(stream.Close)
+	client := &GRPCClient{
+		metricProcessor: NewMetricProcessor(nil, "", "", nil),
+		retryPolicy:     fastPolicy(3),
+		stream:          stream,
+	}
+
+	err := client.SendMetrics(context.Background(), nil, []models.Metrics{newGauge("Alloc", 1)}, "127.0.0.1")
+	if !errors.Is(err, ErrBatchUnacknowledged) {
+		t.Fatalf("expected unacknowledged batch error, got %v", err)
+	}
+	if got := server.received.Load(); got != 1 {
+		t.Errorf("batch that may have been applied must not be resent, server received %d batches", got)
+	}
+}
@@ -5,49 +5,77 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/rsa"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"time"
 
-	"github.com/MPoline/alert_service_yp/internal/agent/flags"
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/config"
 	"github.com/MPoline/alert_service_yp/internal/crypto"
 	"github.com/MPoline/alert_service_yp/internal/hasher"
 	"github.com/MPoline/alert_service_yp/internal/models"
+	"github.com/MPoline/alert_service_yp/internal/replay"
 	"github.com/MPoline/alert_service_yp/internal/storage"
 	"github.com/go-resty/resty/v2"
 	"go.uber.org/zap"
 )
 
 type HTTPClient struct {
+	baseURL         string
 	serverURL       string
 	metricProcessor *MetricProcessor
 	client          *resty.Client
+	keyID           string
+	hashAlg         string
+	signer          *agentkey.Signer
+	retryPolicy     RetryPolicy
+	breaker         *CircuitBreaker
 }
 
-func NewHTTPClient() *HTTPClient {
+// NewHTTPClient создает HTTP клиента для сервера с указанным адресом.
+// Если tlsConfig не nil, запросы отправляются по HTTPS.
+// Если signer не nil, запросы подписываются ключом агента.
+func NewHTTPClient(address string, tlsConfig *tls.Config, signer *agentkey.Signer, settings ClientSettings) *HTTPClient {
 	var pubKey *rsa.PublicKey
-	if flags.FlagCryptoKey != "" {
+	if settings.CryptoKey != "" {
 		var err error
-		pubKey, err = crypto.LoadPublicKey(flags.FlagCryptoKey)
+		pubKey, err = crypto.LoadPublicKey(settings.CryptoKey)
 		if err != nil {
 			zap.L().Error("Failed to load public key for HTTP client", zap.Error(err))
 		}
 	}
 
-	metricProcessor := NewMetricProcessor(pubKey, flags.FlagKey)
+	metricProcessor := NewMetricProcessor(pubKey, settings.Key, settings.HashAlg, signer)
+
+	baseURL := "http://" + address
+	client := resty.New().SetTimeout(5 * time.Second)
+	if tlsConfig != nil {
+		baseURL = "https://" + address
+		client.SetTLSClientConfig(tlsConfig)
+	}
+	if settings.APIToken != "" {
+		client.SetAuthToken(settings.APIToken)
+	}
 
 	return &HTTPClient{
-		serverURL:       "http://" + flags.FlagRunAddr + "/updates",
+		baseURL:         baseURL,
+		serverURL:       baseURL + "/updates",
 		metricProcessor: metricProcessor,
-		client:          resty.New().SetTimeout(5 * time.Second),
+		client:          client,
+		keyID:           settings.KeyID,
+		hashAlg:         settings.HashAlg,
+		signer:          signer,
+		retryPolicy:     settings.retryPolicy(),
+		breaker:         settings.circuitBreaker(),
 	}
 }
 
 func (c *HTTPClient) HealthCheck() error {
 	endpoints := []string{
-		"http://" + flags.FlagRunAddr + "/",
-		"http://" + flags.FlagRunAddr + "/ping",
+		c.baseURL + "/",
+		c.baseURL + "/ping",
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -80,45 +108,57 @@ func (c *HTTPClient) HealthCheck() error {
 	return fmt.Errorf("all HTTP health checks failed: %w", lastErr)
 }
 
+// FetchAgentConfig запрашивает настройки агента через HTTP
+func (c *HTTPClient) FetchAgentConfig(label string, localIP string) (*config.RemoteAgentConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var agentConfig config.RemoteAgentConfig
+	resp, err := c.client.R().
+		SetContext(ctx).
+		SetHeader("X-Real-IP", localIP).
+		SetQueryParam("label", label).
+		SetResult(&agentConfig).
+		Get(c.baseURL + "/api/v1/agent-config")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch agent config: %w", err)
+	}
+
+	if resp.IsError() {
+		return nil, fmt.Errorf("server returned status %d for agent config", resp.StatusCode())
+	}
+
+	return &agentConfig, nil
+}
+
 func (c *HTTPClient) Close() {
 	c.client.GetClient().CloseIdleConnections()
 	zap.L().Debug("HTTP client connections closed")
 }
 
 // SendMetrics отправляет метрики на сервер через HTTP
-func (c *HTTPClient) SendMetrics(memStorage *storage.MemStorage, metrics []models.Metrics, realIP string) {
+func (c *HTTPClient) SendMetrics(ctx context.Context, memStorage *storage.MemStorage, metrics []models.Metrics, realIP string) error {
 	zap.L().Info("Start SendMetrics", zap.String("real_ip", realIP))
 
-	intervals := []time.Duration{1 * time.Second, 3 * time.Second, 5 * time.Second}
-
 	jsonBody, err := json.Marshal(map[string][]models.Metrics{"metrics": metrics})
 	if err != nil {
 		zap.L().Error("Failed to marshal batch of metrics: ", zap.Error(err))
-		return
-	}
-
-	h := hasher.InitHasher("SHA256")
-	hash, err := h.CalculateHash(jsonBody, []byte(flags.FlagKey))
-	if err != nil {
-		zap.L().Error("Failed calculate sha256: ", zap.Error(err))
-		return
+		return fmt.Errorf("failed to marshal batch of metrics: %w", err)
 	}
-	hashStr := base64.StdEncoding.EncodeToString(hash)
-	zap.L().Info("hash request: ", zap.String("hashStr", hashStr))
 
 	var requestData []byte
 	var contentType string
 	publicKey := c.metricProcessor.pubKey
 
 	if publicKey != nil {
-		encryptedData, err := crypto.EncryptLargeData(publicKey, jsonBody)
+		encryptedData, err := crypto.EncryptEnvelope(publicKey, jsonBody)
 		if err != nil {
 			zap.L().Error("Failed to encrypt data: ", zap.Error(err))
-			return
+			return fmt.Errorf("failed to encrypt data: %w", err)
 		}
 		requestData = encryptedData
 		contentType = "application/octet-stream"
-		zap.L().Info("Data encrypted with chunk protocol",
+		zap.L().Info("Data encrypted with envelope",
 			zap.Int("original_size", len(jsonBody)),
 			zap.Int("encrypted_size", len(encryptedData)),
 			zap.Int("key_size", publicKey.Size()))
@@ -133,25 +173,28 @@ func (c *HTTPClient) SendMetrics(memStorage *storage.MemStorage, metrics []model
 	_, err = gz.Write(requestData)
 	if err != nil {
 		zap.L().Error("Failed to compress data: ", zap.Error(err))
-		return
+		return fmt.Errorf("failed to compress data: %w", err)
 	}
 	if err := gz.Close(); err != nil {
 		zap.L().Error("Failed to close gzip writer: ", zap.Error(err))
-		return
+		return fmt.Errorf("failed to close gzip writer: %w", err)
 	}
 	compressedData := buff.Bytes()
 
 	headers := map[string]string{
 		"Content-Type":     contentType,
 		"Content-Encoding": "gzip",
-		"HashSHA256":       base64.StdEncoding.EncodeToString(hash),
 		"X-Real-IP":        realIP,
 	}
 
+	if c.keyID != "" {
+		headers["X-Key-Id"] = c.keyID
+	}
+
 	if publicKey != nil {
 		headers["X-Encrypted"] = "true"
-		headers["X-Encryption-Algorithm"] = "RSA-OAEP"
-		headers["X-Encryption-Mode"] = "chunk-protocol"
+		headers["X-Encryption-Algorithm"] = "RSA-OAEP+AES-256-GCM"
+		headers["X-Encryption-Mode"] = "envelope"
 	}
 
 	zap.L().Debug("Request prepared",
@@ -161,48 +204,72 @@ func (c *HTTPClient) SendMetrics(memStorage *storage.MemStorage, metrics []model
 		zap.Bool("encrypted", publicKey != nil),
 		zap.String("real_ip", realIP))
 
-	for attempt, interval := range intervals {
-		req := c.client.R().
-			SetHeaders(headers).
-			SetBody(compressedData)
-
+	attempt := 0
+	err = c.retryPolicy.Do(ctx, c.breaker, func(ctx context.Context) error {
+		attempt++
 		zap.L().Debug("Sending request attempt",
-			zap.Int("attempt", attempt+1),
-			zap.Int("total_attempts", len(intervals)),
+			zap.Int("attempt", attempt),
 			zap.String("real_ip", realIP))
 
-		resp, err := req.Post(c.serverURL)
+		req := c.client.R().
+			SetContext(ctx).
+			SetHeaders(headers)
+
+		// Каждая попытка подписывается заново со свежими временем и nonce,
+		// чтобы повторная отправка не отклонялась защитой от повтора
+		timestamp := replay.Timestamp(time.Now())
+		nonce := replay.NewNonce()
+		signedData := replay.SignedData(timestamp, nonce, jsonBody)
+		req.SetHeader(replay.HeaderTimestamp, timestamp)
+		req.SetHeader(replay.HeaderNonce, nonce)
+
+		if c.metricProcessor.key != "" || c.signer == nil {
+			h, err := hasher.InitHasher(c.hashAlg)
+			if err != nil {
+				return err
+			}
+			hash, err := h.CalculateHash(signedData, []byte(c.metricProcessor.key))
+			if err != nil {
+				zap.L().Error("Failed calculate sha256: ", zap.Error(err))
+				return fmt.Errorf("failed to calculate hash: %w", err)
+			}
+			req.SetHeader("HashSHA256", base64.StdEncoding.EncodeToString(hash))
+			req.SetHeader(hasher.HeaderAlgorithm, c.hashAlg)
+		}
+
+		if c.signer != nil {
+			req.SetHeader(agentkey.HeaderAgentID, c.signer.AgentID())
+			req.SetHeader(agentkey.HeaderSignature, base64.StdEncoding.EncodeToString(c.signer.Sign(signedData)))
+		}
+
+		resp, err := req.
+			SetBody(compressedData).
+			Post(c.serverURL)
 		if err != nil {
-			zap.L().Warn("Sending metrics failed on attempt",
-				zap.Int("attempt", attempt+1),
-				zap.Duration("interval", interval),
-				zap.Error(err),
-				zap.Bool("encrypted", publicKey != nil))
-			time.Sleep(interval)
-			continue
+			return err
 		}
 
 		if resp.IsError() {
-			zap.L().Warn("Server returned error on attempt",
-				zap.Int("attempt", attempt+1),
-				zap.Int("status", resp.StatusCode()),
-				zap.String("response", resp.String()),
-				zap.Bool("encrypted", publicKey != nil))
-			time.Sleep(interval)
-			continue
+			return &HTTPStatusError{StatusCode: resp.StatusCode(), Body: resp.String()}
 		}
 
 		zap.L().Info("Metrics sent successfully",
-			zap.Int("attempt", attempt+1),
+			zap.Int("attempt", attempt),
 			zap.Int("metrics_count", len(metrics)),
 			zap.Int("compressed_size", len(compressedData)),
 			zap.Bool("encrypted", publicKey != nil),
 			zap.String("server_response", resp.String()),
 			zap.String("real_ip", realIP))
-		return
+		return nil
+	})
+	if err != nil {
+		zap.L().Error("Failed to send metrics",
+			zap.Int("attempts", attempt),
+			zap.Int("metrics_count", len(metrics)),
+			zap.Bool("encrypted", publicKey != nil),
+			zap.Error(err))
+		return fmt.Errorf("failed to send metrics: %w", err)
 	}
 
-	zap.L().Error("All attempts to send metrics failed",
-		zap.Int("metrics_count", len(metrics)),
-		zap.Bool("encrypted", publicKey != nil))
+	return nil
 }
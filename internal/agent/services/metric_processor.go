@@ -1,28 +1,34 @@
 package services
 
 import (
-	"crypto/hmac"
 	"crypto/rsa"
-	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"strconv"
 
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
 	"github.com/MPoline/alert_service_yp/internal/crypto"
+	"github.com/MPoline/alert_service_yp/internal/hasher"
 	"github.com/MPoline/alert_service_yp/internal/models"
 	"github.com/MPoline/alert_service_yp/internal/proto"
 	"go.uber.org/zap"
 )
 
 type MetricProcessor struct {
-	pubKey *rsa.PublicKey
-	key    string
+	pubKey  *rsa.PublicKey
+	key     string
+	hashAlg string
+	signer  *agentkey.Signer
 }
 
-func NewMetricProcessor(pubKey *rsa.PublicKey, key string) *MetricProcessor {
+// NewMetricProcessor создает обработчик метрик. Метрики шифруются ключом pubKey,
+// если он задан, подписываются ключом key алгоритмом hashAlg и ключом агента signer.
+func NewMetricProcessor(pubKey *rsa.PublicKey, key, hashAlg string, signer *agentkey.Signer) *MetricProcessor {
 	return &MetricProcessor{
-		pubKey: pubKey,
-		key:    key,
+		pubKey:  pubKey,
+		key:     key,
+		hashAlg: hashAlg,
+		signer:  signer,
 	}
 }
 
@@ -49,7 +55,18 @@ func (p *MetricProcessor) ProcessMetrics(metrics []models.Metrics) []*proto.Metr
 		}
 
 		if p.key != "" {
-			protoMetric.Hash = p.calculateMetricHash(protoMetric)
+			hash, err := p.calculateMetricHash(protoMetric)
+			if err != nil {
+				zap.L().Error("Failed to sign metric",
+					zap.String("metric_id", m.ID),
+					zap.Error(err))
+				continue
+			}
+			protoMetric.Hash = hash
+		}
+
+		if p.signer != nil {
+			protoMetric.Signature = p.signer.Sign([]byte(metricSignatureData(protoMetric)))
 		}
 
 		protoMetrics = append(protoMetrics, protoMetric)
@@ -96,7 +113,7 @@ func (p *MetricProcessor) encryptMetricValue(metric *proto.Metric) error {
 		return fmt.Errorf("unknown metric type for encryption: %s", metric.Mtype)
 	}
 
-	encryptedData, err := crypto.EncryptLargeData(p.pubKey, dataToEncrypt)
+	encryptedData, err := crypto.EncryptEnvelope(p.pubKey, dataToEncrypt)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt metric data: %w", err)
 	}
@@ -105,18 +122,28 @@ func (p *MetricProcessor) encryptMetricValue(metric *proto.Metric) error {
 	return nil
 }
 
-func (p *MetricProcessor) calculateMetricHash(metric *proto.Metric) string {
-	var data string
+func (p *MetricProcessor) calculateMetricHash(metric *proto.Metric) (string, error) {
+	data := metricSignatureData(metric)
+
+	h, err := hasher.InitHasher(p.hashAlg)
+	if err != nil {
+		return "", err
+	}
+	hash, err := h.CalculateHash([]byte(data), []byte(p.key))
+	if err != nil {
+		return "", fmt.Errorf("failed to calculate hash: %w", err)
+	}
+	return hex.EncodeToString(hash), nil
+}
+
+// metricSignatureData возвращает строку, которую агент подписывает для метрики
+func metricSignatureData(metric *proto.Metric) string {
 	switch metric.Mtype {
 	case "counter":
-		data = fmt.Sprintf("%s:counter:%d", metric.Id, metric.Delta)
+		return fmt.Sprintf("%s:counter:%d", metric.Id, metric.Delta)
 	case "gauge":
-		data = fmt.Sprintf("%s:gauge:%f", metric.Id, metric.Value)
+		return fmt.Sprintf("%s:gauge:%f", metric.Id, metric.Value)
 	default:
-		data = fmt.Sprintf("%s:%s", metric.Id, metric.Mtype)
+		return fmt.Sprintf("%s:%s", metric.Id, metric.Mtype)
 	}
-
-	h := hmac.New(sha256.New, []byte(p.key))
-	h.Write([]byte(data))
-	return hex.EncodeToString(h.Sum(nil))
-}
\ No newline at end of file
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrCircuitOpen возвращается, когда автомат защиты разомкнут и отправка не выполняется
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// HTTPStatusError - ошибка, возвращенная сервером в виде HTTP статуса
+type HTTPStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("server returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// IsRetryable определяет, имеет ли смысл повторять запрос после ошибки.
+//
+// Повторяемые ошибки:
+//   - HTTP 5xx, 408 и 429
+//   - gRPC Unavailable, DeadlineExceeded, ResourceExhausted и Aborted
+//   - сетевые ошибки и разрыв соединения
+//
+// Батч потока без подтверждения (ErrBatchUnacknowledged) не повторяется: сервер мог его применить.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrCircuitOpen) ||
+		errors.Is(err, ErrBatchUnacknowledged) {
+		return false
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError ||
+			statusErr.StatusCode == http.StatusRequestTimeout ||
+			statusErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	if s, ok := status.FromError(err); ok && s.Code() != codes.Unknown {
+		switch s.Code() {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+			return true
+		default:
+			return false
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// RetryPolicy описывает политику повторных попыток с экспоненциальной задержкой и случайным разбросом
+type RetryPolicy struct {
+	// MaxAttempts - максимальное количество попыток, включая первую
+	MaxAttempts int
+	// BaseDelay - задержка перед второй попыткой
+	BaseDelay time.Duration
+	// MaxDelay - максимальная задержка между попытками
+	MaxDelay time.Duration
+	// Multiplier - множитель задержки для каждой следующей попытки
+	Multiplier float64
+	// Jitter - доля случайного разброса задержки от 0 до 1
+	Jitter float64
+}
+
+// NewRetryPolicy создает политику повторов с указанным числом попыток и максимальной задержкой
+func NewRetryPolicy(maxAttempts int, maxDelay time.Duration) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    maxDelay,
+		Multiplier:  2,
+		Jitter:      0.5,
+	}
+}
+
+// retryPolicy создает политику повторов по настройкам агента
+func (s ClientSettings) retryPolicy() RetryPolicy {
+	return NewRetryPolicy(int(s.RetryAttempts), time.Duration(s.RetryMaxDelay)*time.Second)
+}
+
+// Backoff возвращает задержку перед попыткой с номером attempt (начиная с 1)
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := float64(p.BaseDelay) * math.Pow(p.Multiplier, float64(attempt-1))
+	if maxDelay := float64(p.MaxDelay); maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+
+	delay -= delay * p.Jitter * rand.Float64()
+	return time.Duration(delay)
+}
+
+// Do выполняет операцию с повторами, пока ошибка повторяема и не исчерпаны попытки.
+// Ожидание между попытками прерывается при отмене контекста.
+// Если передан автомат защиты, он проверяется перед каждой попыткой и учитывает ее результат.
+func (p RetryPolicy) Do(ctx context.Context, breaker *CircuitBreaker, op func(ctx context.Context) error) error {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if breaker != nil {
+			if allowErr := breaker.Allow(); allowErr != nil {
+				if err != nil {
+					return fmt.Errorf("%w (last error: %v)", allowErr, err)
+				}
+				return allowErr
+			}
+		}
+
+		err = op(ctx)
+		if breaker != nil {
+			breaker.Record(err)
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		if !IsRetryable(err) || attempt == attempts {
+			return err
+		}
+
+		delay := p.Backoff(attempt)
+		zap.L().Warn("Retryable error, retrying",
+			zap.Int("attempt", attempt),
+			zap.Int("max_attempts", attempts),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("retry aborted: %w (last error: %v)", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+
+	return err
+}
+
+// Состояния автомата защиты
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreaker прекращает отправку на недоступный сервер после серии ошибок.
+// Через openTimeout автомат пропускает одну пробную попытку: при успехе
+// он замыкается, при ошибке снова размыкается.
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	failureThreshold int
+	openTimeout      time.Duration
+	state            int
+	failures         int
+	openedAt         time.Time
+	probeInFlight    bool
+}
+
+// NewCircuitBreaker создает автомат защиты.
+// failureThreshold <= 0 отключает автомат.
+func NewCircuitBreaker(failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+	}
+}
+
+// circuitBreaker создает автомат защиты по настройкам агента
+func (s ClientSettings) circuitBreaker() *CircuitBreaker {
+	return NewCircuitBreaker(int(s.BreakerThreshold), time.Duration(s.BreakerTimeout)*time.Second)
+}
+
+// Allow проверяет, разрешена ли очередная попытка отправки
+func (b *CircuitBreaker) Allow() error {
+	if b == nil || b.failureThreshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		b.probeInFlight = true
+		zap.L().Info("Circuit breaker half-open, sending probe request")
+		return nil
+	case breakerHalfOpen:
+		if b.probeInFlight {
+			return ErrCircuitOpen
+		}
+		b.probeInFlight = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record учитывает результат попытки. Неповторяемые ошибки (например, 4xx)
+// не считаются отказом сервера.
+func (b *CircuitBreaker) Record(err error) {
+	if b == nil || b.failureThreshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probeInFlight = false
+
+	if err == nil || !IsRetryable(err) {
+		if b.state != breakerClosed {
+			zap.L().Info("Circuit breaker closed")
+		}
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.failureThreshold {
+		if b.state != breakerOpen {
+			zap.L().Warn("Circuit breaker opened",
+				zap.Int("failures", b.failures),
+				zap.Duration("open_timeout", b.openTimeout))
+		}
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
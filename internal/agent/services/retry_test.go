@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"http 500", &HTTPStatusError{StatusCode: http.StatusInternalServerError}, true},
+		{"http 503", &HTTPStatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"http 429", &HTTPStatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"http 400", &HTTPStatusError{StatusCode: http.StatusBadRequest}, false},
+		{"http 403", &HTTPStatusError{StatusCode: http.StatusForbidden}, false},
+		{"grpc unavailable", status.Error(codes.Unavailable, "down"), true},
+		{"grpc invalid argument", status.Error(codes.InvalidArgument, "bad"), false},
+		{"connection refused", syscall.ECONNREFUSED, true},
+		{"canceled", context.Canceled, false},
+		{"circuit open", ErrCircuitOpen, false},
+		{"plain error", errors.New("marshal failed"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func fastPolicy(attempts int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: attempts,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    5 * time.Millisecond,
+		Multiplier:  2,
+		Jitter:      0.5,
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	t.Run("retries retryable errors", func(t *testing.T) {
+		calls := 0
+		err := fastPolicy(3).Do(context.Background(), nil, func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return &HTTPStatusError{StatusCode: http.StatusBadGateway}
+			}
+			return nil
+		})
+		if err != nil || calls != 3 {
+			t.Fatalf("expected success after 3 calls, got err=%v calls=%d", err, calls)
+		}
+	})
+
+	t.Run("does not retry client errors", func(t *testing.T) {
+		calls := 0
+		err := fastPolicy(3).Do(context.Background(), nil, func(ctx context.Context) error {
+			calls++
+			return &HTTPStatusError{StatusCode: http.StatusBadRequest}
+		})
+		if err == nil || calls != 1 {
+			t.Fatalf("expected single failed call, got err=%v calls=%d", err, calls)
+		}
+	})
+
+	t.Run("stops on context cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		policy := fastPolicy(5)
+		policy.BaseDelay = time.Hour
+		policy.MaxDelay = time.Hour
+
+		calls := 0
+		err := policy.Do(ctx, nil, func(ctx context.Context) error {
+			calls++
+			cancel()
+			return syscall.ECONNREFUSED
+		})
+		if !errors.Is(err, context.Canceled) || calls != 1 {
+			t.Fatalf("expected cancellation after 1 call, got err=%v calls=%d", err, calls)
+		}
+	})
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2, Jitter: 0.5}
+
+	for attempt, limit := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 10: time.Second} {
+		delay := policy.Backoff(attempt)
+		if delay > limit || delay < limit/2 {
+			t.Errorf("Backoff(%d) = %v, want in [%v, %v]", attempt, delay, limit/2, limit)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreaker(2, 20*time.Millisecond)
+	unavailable := status.Error(codes.Unavailable, "down")
+
+	b.Record(&HTTPStatusError{StatusCode: http.StatusBadRequest})
+	b.Record(unavailable)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("breaker must stay closed below threshold: %v", err)
+	}
+
+	b.Record(unavailable)
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("breaker must open after threshold, got %v", err)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("breaker must allow a probe after timeout: %v", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("breaker must allow only one probe, got %v", err)
+	}
+
+	b.Record(nil)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("breaker must close after successful probe: %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+// Package status предоставляет встроенный HTTP-эндпоинт агента для интроспекции.
+//
+// Эндпоинты:
+//   - /healthz: проверка живости процесса агента
+//   - /status: текущее состояние агента в формате JSON
+//   - /metrics: собственные метрики агента в формате Prometheus
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// latencyBuckets - границы гистограммы задержки отправки в секундах
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Tracker хранит состояние агента, отображаемое на эндпоинтах /status и /metrics
+type Tracker struct {
+	mu sync.RWMutex
+
+	lastSuccess     time.Time
+	lastSendError   string
+	lastHealthError string
+	collectors      []string
+	labels          map[string]string
+	configSource    string
+	workers         int64
+	queueLen        func() int
+
+	sentTotal     uint64
+	failedTotal   uint64
+	latencyCounts []uint64
+	latencySum    float64
+}
+
+// Snapshot - представление состояния агента для эндпоинта /status
+type Snapshot struct {
+	LastSuccess     *time.Time        `json:"last_success,omitempty"`
+	LastSendError   string            `json:"last_send_error,omitempty"`
+	LastHealthError string            `json:"last_health_error,omitempty"`
+	QueuedBatches   int               `json:"queued_batches"`
+	Workers         int64             `json:"workers"`
+	Collectors      []string          `json:"collectors"`
+	ConfigSource    string            `json:"config_source"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	SentBatches     uint64            `json:"sent_batches"`
+	FailedBatches   uint64            `json:"failed_batches"`
+}
+
+// NewTracker создает трекер состояния.
+//
+// Параметры:
+//   - workers: количество воркеров отправки (FlagRateLimit)
+//   - queueLen: функция, возвращающая текущее число батчей в очереди отправки
+func NewTracker(workers int64, queueLen func() int) *Tracker {
+	return &Tracker{
+		workers:       workers,
+		queueLen:      queueLen,
+		configSource:  "local",
+		latencyCounts: make([]uint64, len(latencyBuckets)),
+	}
+}
+
+// ObserveSend регистрирует результат отправки батча метрик
+func (t *Tracker) ObserveSend(duration time.Duration, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	seconds := duration.Seconds()
+	t.latencySum += seconds
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			t.latencyCounts[i]++
+		}
+	}
+
+	t.sentTotal++
+	if err != nil {
+		t.failedTotal++
+		t.lastSendError = err.Error()
+		return
+	}
+
+	t.lastSuccess = time.Now()
+	t.lastSendError = ""
+}
+
+// SetHealthCheckResult сохраняет результат последней проверки ClientManager.HealthCheck
+func (t *Tracker) SetHealthCheckResult(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err != nil {
+		t.lastHealthError = err.Error()
+	} else {
+		t.lastHealthError = ""
+	}
+}
+
+// SetCollectors задает текущий список активных сборщиков метрик
+func (t *Tracker) SetCollectors(collectors []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.collectors = append([]string(nil), collectors...)
+}
+
+// SetConfigSource задает источник текущих настроек агента ("local" или "remote") и метки агента
+func (t *Tracker) SetConfigSource(source string, labels map[string]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.configSource = source
+	t.labels = labels
+}
+
+// SetWorkers задает текущее количество воркеров отправки
+func (t *Tracker) SetWorkers(workers int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.workers = workers
+}
+
+// Snapshot возвращает копию текущего состояния агента
+func (t *Tracker) Snapshot() Snapshot {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	snapshot := Snapshot{
+		LastSendError:   t.lastSendError,
+		LastHealthError: t.lastHealthError,
+		Workers:         t.workers,
+		Collectors:      append([]string{}, t.collectors...),
+		ConfigSource:    t.configSource,
+		Labels:          t.labels,
+		SentBatches:     t.sentTotal,
+		FailedBatches:   t.failedTotal,
+	}
+	if !t.lastSuccess.IsZero() {
+		lastSuccess := t.lastSuccess
+		snapshot.LastSuccess = &lastSuccess
+	}
+	if t.queueLen != nil {
+		snapshot.QueuedBatches = t.queueLen()
+	}
+	return snapshot
+}
+
+// Handler возвращает HTTP-обработчик эндпоинтов /healthz, /status и /metrics
+func (t *Tracker) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(t.Snapshot()); err != nil {
+			zap.L().Error("Failed to encode agent status", zap.Error(err))
+		}
+	})
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write([]byte(t.prometheus()))
+	})
+
+	return mux
+}
+
+// prometheus формирует метрики агента в текстовом формате Prometheus
+func (t *Tracker) prometheus() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var sb strings.Builder
+
+	sb.WriteString("# HELP agent_send_duration_seconds Latency of sending a batch of metrics to the server.\n")
+	sb.WriteString("# TYPE agent_send_duration_seconds histogram\n")
+	for i, bound := range latencyBuckets {
+		fmt.Fprintf(&sb, "agent_send_duration_seconds_bucket{le=\"%s\"} %d\n",
+			strconv.FormatFloat(bound, 'f', -1, 64), t.latencyCounts[i])
+	}
+	fmt.Fprintf(&sb, "agent_send_duration_seconds_bucket{le=\"+Inf\"} %d\n", t.sentTotal)
+	fmt.Fprintf(&sb, "agent_send_duration_seconds_sum %s\n", strconv.FormatFloat(t.latencySum, 'f', -1, 64))
+	fmt.Fprintf(&sb, "agent_send_duration_seconds_count %d\n", t.sentTotal)
+
+	sb.WriteString("# HELP agent_send_batches_total Total number of batches the agent tried to send.\n")
+	sb.WriteString("# TYPE agent_send_batches_total counter\n")
+	fmt.Fprintf(&sb, "agent_send_batches_total %d\n", t.sentTotal)
+
+	sb.WriteString("# HELP agent_send_failures_total Total number of batches the agent failed to send.\n")
+	sb.WriteString("# TYPE agent_send_failures_total counter\n")
+	fmt.Fprintf(&sb, "agent_send_failures_total %d\n", t.failedTotal)
+
+	if !t.lastSuccess.IsZero() {
+		sb.WriteString("# HELP agent_last_success_timestamp_seconds Unix time of the last successful send.\n")
+		sb.WriteString("# TYPE agent_last_success_timestamp_seconds gauge\n")
+		fmt.Fprintf(&sb, "agent_last_success_timestamp_seconds %d\n", t.lastSuccess.Unix())
+	}
+
+	return sb.String()
+}
+
+// Serve запускает HTTP-сервер статуса и останавливает его при отмене контекста
+func Serve(ctx context.Context, addr string, t *Tracker) {
+	server := &http.Server{
+		Addr:    addr,
+		Handler: t.Handler(),
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			zap.L().Error("Status server shutdown error", zap.Error(err))
+		}
+	}()
+
+	zap.L().Info("Status server is running", zap.String("address", addr))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		zap.L().Error("Status server error", zap.Error(err))
+	}
+}
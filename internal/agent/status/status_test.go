@@ -0,0 +1,62 @@
+package status_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/agent/status"
+)
+
+func TestTracker(t *testing.T) {
+	tracker := status.NewTracker(3, func() int { return 2 })
+	tracker.SetCollectors([]string{"runtime", "system"})
+	tracker.ObserveSend(20*time.Millisecond, nil)
+	tracker.ObserveSend(time.Second, errors.New("connection refused"))
+	tracker.SetHealthCheckResult(errors.New("server unavailable"))
+
+	handler := tracker.Handler()
+
+	t.Run("Status", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+		var snapshot status.Snapshot
+		if err := json.Unmarshal(w.Body.Bytes(), &snapshot); err != nil {
+			t.Fatalf("Failed to decode status: %v", err)
+		}
+		if snapshot.QueuedBatches != 2 || snapshot.Workers != 3 {
+			t.Errorf("Unexpected queue/workers: %d/%d", snapshot.QueuedBatches, snapshot.Workers)
+		}
+		if snapshot.LastSuccess == nil {
+			t.Error("Expected last success time")
+		}
+		if snapshot.LastHealthError != "server unavailable" {
+			t.Errorf("Unexpected health error: %q", snapshot.LastHealthError)
+		}
+		if len(snapshot.Collectors) != 2 {
+			t.Errorf("Unexpected collectors: %v", snapshot.Collectors)
+		}
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		body := w.Body.String()
+		for _, line := range []string{
+			"agent_send_batches_total 2",
+			"agent_send_failures_total 1",
+			`agent_send_duration_seconds_bucket{le="0.025"} 1`,
+			`agent_send_duration_seconds_bucket{le="+Inf"} 2`,
+		} {
+			if !strings.Contains(body, line) {
+				t.Errorf("Expected %q in metrics output", line)
+			}
+		}
+	})
+}
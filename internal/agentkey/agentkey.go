@@ -0,0 +1,266 @@
+// Package agentkey реализует подпись запросов агентов собственными ключами Ed25519.
+//
+// В отличие от общего секрета HMAC, с которым любой агент может выдать себя
+// за другого, каждый агент подписывает запросы своим приватным ключом,
+// а сервер проверяет подпись открытым ключом, зарегистрированным для агента.
+//
+// Открытые ключи хранятся в каталоге сервера, по одному PEM файлу на агента.
+// Имя файла без расширения является идентификатором агента:
+//
+//	/etc/metrics/agents/web-01.pem
+//	/etc/metrics/agents/web-02.pem
+//
+// Ключи можно создать командой openssl:
+//
+//	openssl genpkey -algorithm ed25519 -out web-01.key
+//	openssl pkey -in web-01.key -pubout -out web-01.pem
+package agentkey
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Заголовки HTTP и ключи метаданных gRPC с идентификатором агента и подписью
+const (
+	HeaderAgentID     = "X-Agent-Id"
+	HeaderSignature   = "X-Signature"
+	MetadataAgentID   = "x-agent-id"
+	MetadataSignature = "x-signature"
+)
+
+var (
+	// ErrMissing - в запросе нет идентификатора агента или подписи
+	ErrMissing = errors.New("agent id or signature is missing")
+	// ErrUnknownAgent - для агента не зарегистрирован открытый ключ
+	ErrUnknownAgent = errors.New("unknown agent")
+	// ErrSignatureMismatch - подпись не соответствует ключу агента
+	ErrSignatureMismatch = errors.New("agent signature does not match")
+)
+
+// keyExtensions - расширения файлов с открытыми ключами в каталоге
+var keyExtensions = map[string]bool{".pem": true, ".pub": true}
+
+// LoadPrivateKey загружает приватный ключ Ed25519 агента из PEM файла (PKCS#8)
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %s is not an Ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+// LoadPublicKey загружает открытый ключ Ed25519 из PEM файла (PKIX)
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is not an Ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse PEM block in %s", path)
+	}
+	return block, nil
+}
+
+// Signer подписывает запросы агента его приватным ключом. Методы безопасны для nil,
+// nil означает, что агент не подписывает запросы ключом Ed25519.
+type Signer struct {
+	agentID string
+	key     ed25519.PrivateKey
+}
+
+// NewSigner загружает приватный ключ агента agentID из файла keyPath.
+// Пустой keyPath отключает подпись и возвращает nil.
+func NewSigner(agentID, keyPath string) (*Signer, error) {
+	if keyPath == "" {
+		return nil, nil
+	}
+	if agentID == "" {
+		return nil, errors.New("agent id is required for signing with an agent key")
+	}
+
+	key, err := LoadPrivateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{agentID: agentID, key: key}, nil
+}
+
+// AgentID возвращает идентификатор агента
+func (s *Signer) AgentID() string {
+	if s == nil {
+		return ""
+	}
+	return s.agentID
+}
+
+// Sign возвращает подпись данных data
+func (s *Signer) Sign(data []byte) []byte {
+	if s == nil {
+		return nil
+	}
+	return ed25519.Sign(s.key, data)
+}
+
+// Registry - открытые ключи зарегистрированных агентов. Методы безопасны для nil,
+// nil означает, что подпись ключами агентов не используется.
+type Registry struct {
+	dir string
+
+	mu   sync.RWMutex
+	keys map[string]ed25519.PublicKey
+}
+
+// NewRegistry загружает открытые ключи агентов из каталога dir.
+// Пустой dir отключает проверку и возвращает nil.
+func NewRegistry(dir string) (*Registry, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	r := &Registry{dir: dir}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload перечитывает каталог с ключами. При ошибке продолжают
+// использоваться ранее загруженные ключи.
+func (r *Registry) Reload() error {
+	if r == nil {
+		return nil
+	}
+
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read agent keys directory: %w", err)
+	}
+
+	keys := make(map[string]ed25519.PublicKey)
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || !keyExtensions[ext] {
+			continue
+		}
+
+		id := strings.TrimSuffix(entry.Name(), ext)
+		if _, exists := keys[id]; exists {
+			return fmt.Errorf("duplicate key for agent %q", id)
+		}
+
+		key, err := LoadPublicKey(filepath.Join(r.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		keys[id] = key
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.mu.Unlock()
+
+	zap.L().Info("Agent keys loaded",
+		zap.String("dir", r.dir),
+		zap.Strings("agents", sortedAgents(keys)))
+	return nil
+}
+
+// Enabled сообщает, включена ли проверка подписей агентов
+func (r *Registry) Enabled() bool {
+	return r != nil
+}
+
+// Known сообщает, зарегистрирован ли ключ агента agentID
+func (r *Registry) Known(agentID string) bool {
+	if r == nil {
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.keys[agentID]
+	return ok
+}
+
+// Verify проверяет подпись signature данных data ключом агента agentID
+func (r *Registry) Verify(agentID string, data, signature []byte) error {
+	if r == nil {
+		return nil
+	}
+	if agentID == "" || len(signature) == 0 {
+		return ErrMissing
+	}
+
+	r.mu.RLock()
+	key, ok := r.keys[agentID]
+	r.mu.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownAgent, agentID)
+	}
+	if !ed25519.Verify(key, data, signature) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+func sortedAgents(keys map[string]ed25519.PublicKey) []string {
+	ids := make([]string, 0, len(keys))
+	for id := range keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+type agentIDKey struct{}
+
+// WithAgentID возвращает контекст с идентификатором агента, подпись которого проверена
+func WithAgentID(ctx context.Context, agentID string) context.Context {
+	return context.WithValue(ctx, agentIDKey{}, agentID)
+}
+
+// AgentIDFromContext возвращает идентификатор агента, подпись которого проверена
+func AgentIDFromContext(ctx context.Context) string {
+	agentID, _ := ctx.Value(agentIDKey{}).(string)
+	return agentID
+}
@@ -0,0 +1,121 @@
+package agentkey
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeAgentKeys создает пару ключей агента: открытый ключ в каталоге dir
+// и приватный ключ рядом с ним. Возвращает путь к приватному ключу.
+func writeAgentKeys(t *testing.T, dir, agentID string) string {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, agentID+".pem"),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0600))
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	privPath := filepath.Join(t.TempDir(), agentID+".key")
+	require.NoError(t, os.WriteFile(privPath,
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600))
+	return privPath
+}
+
+func TestRegistryVerify(t *testing.T) {
+	dir := t.TempDir()
+	web01Key := writeAgentKeys(t, dir, "web-01")
+	web02Key := writeAgentKeys(t, dir, "web-02")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("not a key"), 0600))
+
+	registry, err := NewRegistry(dir)
+	require.NoError(t, err)
+	require.True(t, registry.Enabled())
+	assert.True(t, registry.Known("web-01"))
+	assert.False(t, registry.Known("web-03"))
+
+	web01, err := NewSigner("web-01", web01Key)
+	require.NoError(t, err)
+	web02, err := NewSigner("web-02", web02Key)
+	require.NoError(t, err)
+
+	data := []byte("payload")
+
+	tests := []struct {
+		name      string
+		agentID   string
+		signature []byte
+		want      error
+	}{
+		{"valid", "web-01", web01.Sign(data), nil},
+		{"signed by another agent", "web-01", web02.Sign(data), ErrSignatureMismatch},
+		{"unknown agent", "web-03", web01.Sign(data), ErrUnknownAgent},
+		{"missing signature", "web-01", nil, ErrMissing},
+		{"missing agent", "", web01.Sign(data), ErrMissing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := registry.Verify(tt.agentID, data, tt.signature)
+			if tt.want == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryReload(t *testing.T) {
+	dir := t.TempDir()
+	registry, err := NewRegistry(dir)
+	require.NoError(t, err)
+
+	signer, err := NewSigner("web-01", writeAgentKeys(t, dir, "web-01"))
+	require.NoError(t, err)
+
+	data := []byte("payload")
+	assert.ErrorIs(t, registry.Verify("web-01", data, signer.Sign(data)), ErrUnknownAgent)
+
+	require.NoError(t, registry.Reload())
+	assert.NoError(t, registry.Verify("web-01", data, signer.Sign(data)))
+
+	// Поврежденный ключ не должен сбрасывать уже загруженные
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("garbage"), 0600))
+	assert.Error(t, registry.Reload())
+	assert.NoError(t, registry.Verify("web-01", data, signer.Sign(data)))
+}
+
+func TestDisabled(t *testing.T) {
+	registry, err := NewRegistry("")
+	require.NoError(t, err)
+	assert.False(t, registry.Enabled())
+	assert.NoError(t, registry.Verify("", nil, nil))
+
+	signer, err := NewSigner("", "")
+	require.NoError(t, err)
+	assert.Nil(t, signer)
+	assert.Empty(t, signer.AgentID())
+
+	_, err = NewSigner("", writeAgentKeys(t, t.TempDir(), "web-01"))
+	assert.Error(t, err, "agent id is required with a signing key")
+}
+
+func TestAgentIDContext(t *testing.T) {
+	ctx := WithAgentID(context.Background(), "web-01")
+	assert.Equal(t, "web-01", AgentIDFromContext(ctx))
+	assert.Empty(t, AgentIDFromContext(context.Background()))
+}
@@ -0,0 +1,200 @@
+// Package apitoken реализует аутентификацию клиентов API по токенам Bearer с ролями.
+//
+// Токены задаются в файле конфигурации сервера в виде SHA-256 хеша, сам токен
+// на сервере не хранится:
+//
+//	"api_tokens": [
+//	  {"name": "grafana", "role": "read", "hash": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"},
+//	  {"name": "agents", "role": "write", "hash": "sha256:60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752"}
+//	]
+//
+// Хеш токена можно получить командой:
+//
+//	printf %s "$TOKEN" | sha256sum
+//
+// Роли упорядочены: write включает права read, admin - права write и read.
+package apitoken
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/MPoline/alert_service_yp/internal/config"
+)
+
+// Заголовок HTTP и ключ метаданных gRPC с токеном
+const (
+	HeaderAuthorization   = "Authorization"
+	MetadataAuthorization = "authorization"
+)
+
+// bearerPrefix - схема аутентификации в заголовке Authorization
+const bearerPrefix = "Bearer "
+
+// Role - роль токена
+type Role string
+
+// Роли токенов
+const (
+	// RoleRead - чтение метрик и настроек агентов
+	RoleRead Role = "read"
+	// RoleWrite - изменение метрик
+	RoleWrite Role = "write"
+	// RoleAdmin - все операции, включая административные
+	RoleAdmin Role = "admin"
+)
+
+// roleLevels - уровни ролей, роль с большим уровнем включает права меньших
+var roleLevels = map[Role]int{RoleRead: 1, RoleWrite: 2, RoleAdmin: 3}
+
+var (
+	// ErrMissing - в запросе нет токена
+	ErrMissing = errors.New("API token is missing")
+	// ErrInvalid - токен не найден среди настроенных
+	ErrInvalid = errors.New("API token is invalid")
+	// ErrForbidden - роли токена недостаточно для операции
+	ErrForbidden = errors.New("API token role does not allow this operation")
+)
+
+// ParseRole проверяет имя роли
+func ParseRole(name string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(name)))
+	if _, ok := roleLevels[role]; !ok {
+		return "", fmt.Errorf("unknown role %q", name)
+	}
+	return role, nil
+}
+
+// Allows сообщает, включает ли роль права роли required
+func (r Role) Allows(required Role) bool {
+	return roleLevels[r] >= roleLevels[required]
+}
+
+// HashToken возвращает SHA-256 хеш токена в hex, в таком виде токены задаются в конфигурации
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Identity - владелец токена, прошедшего проверку
+type Identity struct {
+	Name string
+	Role Role
+}
+
+type entry struct {
+	hash     []byte
+	identity Identity
+}
+
+// Authenticator проверяет токены запросов. Методы безопасны для nil,
+// nil означает, что аутентификация по токенам отключена.
+type Authenticator struct {
+	tokens []entry
+}
+
+// New создает проверку токенов из конфигурации. Пустой список отключает
+// аутентификацию и возвращает nil.
+func New(tokens []config.APIToken) (*Authenticator, error) {
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	a := &Authenticator{}
+	names := make(map[string]bool, len(tokens))
+	for i, token := range tokens {
+		if token.Name == "" {
+			return nil, fmt.Errorf("api token %d: name is required", i)
+		}
+		if names[token.Name] {
+			return nil, fmt.Errorf("duplicate api token %q", token.Name)
+		}
+		names[token.Name] = true
+
+		role, err := ParseRole(token.Role)
+		if err != nil {
+			return nil, fmt.Errorf("api token %q: %w", token.Name, err)
+		}
+
+		hash, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(token.Hash), "sha256:"))
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("api token %q: hash must be a hex SHA-256 digest", token.Name)
+		}
+
+		a.tokens = append(a.tokens, entry{hash: hash, identity: Identity{Name: token.Name, Role: role}})
+	}
+	return a, nil
+}
+
+// Enabled сообщает, включена ли аутентификация по токенам
+func (a *Authenticator) Enabled() bool {
+	return a != nil
+}
+
+// Authenticate находит владельца токена
+func (a *Authenticator) Authenticate(token string) (Identity, error) {
+	if token == "" {
+		return Identity{}, ErrMissing
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	// Сравниваются все токены, чтобы время проверки не зависело от позиции совпадения
+	found := -1
+	for i, e := range a.tokens {
+		if subtle.ConstantTimeCompare(sum[:], e.hash) == 1 {
+			found = i
+		}
+	}
+	if found < 0 {
+		return Identity{}, ErrInvalid
+	}
+	return a.tokens[found].identity, nil
+}
+
+// Authorize проверяет токен из значения заголовка Authorization и роль required.
+// Если аутентификация отключена, запрос разрешается с пустым Identity.
+func (a *Authenticator) Authorize(authorization string, required Role) (Identity, error) {
+	if a == nil {
+		return Identity{}, nil
+	}
+
+	identity, err := a.Authenticate(BearerToken(authorization))
+	if err != nil {
+		return Identity{}, err
+	}
+	if !identity.Role.Allows(required) {
+		return identity, fmt.Errorf("%w: %s requires %s", ErrForbidden, identity.Role, required)
+	}
+	return identity, nil
+}
+
+// BearerToken извлекает токен из значения заголовка Authorization
+func BearerToken(authorization string) string {
+	if len(authorization) < len(bearerPrefix) || !strings.EqualFold(authorization[:len(bearerPrefix)], bearerPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(authorization[len(bearerPrefix):])
+}
+
+// Bearer возвращает значение заголовка Authorization для токена
+func Bearer(token string) string {
+	return bearerPrefix + token
+}
+
+type identityKey struct{}
+
+// WithIdentity возвращает контекст с владельцем проверенного токена
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext возвращает владельца проверенного токена
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
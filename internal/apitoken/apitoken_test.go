@@ -0,0 +1,94 @@
+package apitoken
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MPoline/alert_service_yp/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTokens() []config.APIToken {
+	return []config.APIToken{
+		{Name: "grafana", Role: "read", Hash: HashToken("read-token")},
+		{Name: "agents", Role: "write", Hash: "sha256:" + HashToken("write-token")},
+		{Name: "ops", Role: "ADMIN", Hash: HashToken("admin-token")},
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	auth, err := New(testTokens())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		authorization string
+		required      Role
+		wantName      string
+		wantErr       error
+	}{
+		{"read token reads", "Bearer read-token", RoleRead, "grafana", nil},
+		{"read token cannot write", "Bearer read-token", RoleWrite, "grafana", ErrForbidden},
+		{"write token reads", "Bearer write-token", RoleRead, "agents", nil},
+		{"write token writes", "bearer write-token", RoleWrite, "agents", nil},
+		{"write token is not admin", "Bearer write-token", RoleAdmin, "agents", ErrForbidden},
+		{"admin token writes", "Bearer admin-token", RoleWrite, "ops", nil},
+		{"unknown token", "Bearer other-token", RoleRead, "", ErrInvalid},
+		{"missing token", "", RoleRead, "", ErrMissing},
+		{"other scheme", "Basic read-token", RoleRead, "", ErrMissing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := auth.Authorize(tt.authorization, tt.required)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantName, identity.Name)
+		})
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens []config.APIToken
+	}{
+		{"missing name", []config.APIToken{{Role: "read", Hash: HashToken("a")}}},
+		{"unknown role", []config.APIToken{{Name: "a", Role: "owner", Hash: HashToken("a")}}},
+		{"plain token instead of hash", []config.APIToken{{Name: "a", Role: "read", Hash: "secret"}}},
+		{"duplicate name", []config.APIToken{
+			{Name: "a", Role: "read", Hash: HashToken("a")},
+			{Name: "a", Role: "write", Hash: HashToken("b")},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.tokens)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	auth, err := New(nil)
+	require.NoError(t, err)
+	assert.False(t, auth.Enabled())
+
+	_, err = auth.Authorize("", RoleAdmin)
+	assert.NoError(t, err)
+}
+
+func TestIdentityContext(t *testing.T) {
+	_, ok := IdentityFromContext(context.Background())
+	assert.False(t, ok)
+
+	ctx := WithIdentity(context.Background(), Identity{Name: "ops", Role: RoleAdmin})
+	identity, ok := IdentityFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "ops", identity.Name)
+}
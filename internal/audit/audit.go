@@ -0,0 +1,176 @@
+// Package audit ведет журнал аудита изменений метрик только на добавление.
+//
+// Каждая запись журнала содержит время, IP адрес клиента, идентификатор агента
+// и имя токена API, если они известны, способ передачи (HTTP JSON, URL, батч, gRPC)
+// и прежние и новые значения измененных метрик. Записи сохраняются в файл JSON lines
+// с ротацией по размеру и, при наличии базы данных, в таблицу audit_log.
+//
+// Сведения о клиенте берутся из контекста запроса: адрес из netutil, агент из agentkey,
+// токен из apitoken, а способ передачи выставляет обработчик через WithTransport.
+package audit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/apitoken"
+	"github.com/MPoline/alert_service_yp/internal/netutil"
+	"go.uber.org/zap"
+)
+
+// Transport - способ, которым метрики переданы на сервер
+type Transport string
+
+// Способы передачи метрик
+const (
+	TransportHTTPJSON   Transport = "http-json"
+	TransportHTTPURL    Transport = "http-url"
+	TransportHTTPBatch  Transport = "http-batch"
+	TransportGRPC       Transport = "grpc"
+	TransportGRPCStream Transport = "grpc-stream"
+)
+
+// Change - изменение одной метрики. Пустое прежнее значение означает,
+// что метрика до записи не существовала.
+type Change struct {
+	ID       string   `json:"id"`
+	MType    string   `json:"type"`
+	OldValue *float64 `json:"old_value,omitempty"`
+	NewValue *float64 `json:"new_value,omitempty"`
+	OldDelta *int64   `json:"old_delta,omitempty"`
+	NewDelta *int64   `json:"new_delta,omitempty"`
+}
+
+// Entry - запись журнала аудита об одной успешной записи метрик
+type Entry struct {
+	Time      time.Time `json:"ts"`
+	IP        string    `json:"ip,omitempty"`
+	AgentID   string    `json:"agent_id,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	Transport Transport `json:"transport,omitempty"`
+	Metrics   []Change  `json:"metrics"`
+}
+
+// Filter - условия выборки записей журнала. Записи выбираются в интервале [From, To),
+// нулевые границы не ограничивают интервал, Limit больше нуля ограничивает число записей.
+type Filter struct {
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+// Match сообщает, попадает ли время записи в интервал фильтра
+func (f Filter) Match(t time.Time) bool {
+	if !f.From.IsZero() && t.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !t.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// ErrDisabled возвращается при запросе к выключенному журналу
+var ErrDisabled = errors.New("audit log is disabled")
+
+// Sink - хранилище записей журнала аудита
+type Sink interface {
+	// Write добавляет запись в журнал
+	Write(ctx context.Context, entry Entry) error
+	// Query возвращает записи, подходящие под фильтр, в порядке времени
+	Query(ctx context.Context, filter Filter) ([]Entry, error)
+	Close() error
+}
+
+// Logger записывает журнал аудита во все хранилища. Методы безопасны для nil,
+// nil означает, что журнал не ведется.
+type Logger struct {
+	sinks []Sink
+	now   func() time.Time
+}
+
+// New создает журнал с хранилищами sinks. Запросы выполняются к первому хранилищу.
+// Без хранилищ возвращает nil.
+func New(sinks ...Sink) *Logger {
+	var active []Sink
+	for _, sink := range sinks {
+		if sink != nil {
+			active = append(active, sink)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+	return &Logger{sinks: active, now: time.Now}
+}
+
+// Enabled сообщает, ведется ли журнал
+func (l *Logger) Enabled() bool {
+	return l != nil
+}
+
+// Record записывает изменения метрик с данными о клиенте из контекста.
+// Метрики к этому моменту уже сохранены, поэтому ошибки хранилищ журнала
+// только логируются и не отменяют запись.
+func (l *Logger) Record(ctx context.Context, changes []Change) {
+	if l == nil || len(changes) == 0 {
+		return
+	}
+
+	entry := SourceFromContext(ctx)
+	entry.Time = l.now().UTC()
+	entry.Metrics = changes
+
+	for _, sink := range l.sinks {
+		if err := sink.Write(ctx, entry); err != nil {
+			zap.L().Error("Failed to write audit log entry",
+				zap.String("transport", string(entry.Transport)),
+				zap.Int("metrics_count", len(changes)),
+				zap.Error(err))
+		}
+	}
+}
+
+// Query возвращает записи журнала, подходящие под фильтр
+func (l *Logger) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	if l == nil {
+		return nil, ErrDisabled
+	}
+	return l.sinks[0].Query(ctx, filter)
+}
+
+// Close закрывает хранилища журнала
+func (l *Logger) Close() {
+	if l == nil {
+		return
+	}
+	for _, sink := range l.sinks {
+		if err := sink.Close(); err != nil {
+			zap.L().Error("Failed to close audit log", zap.Error(err))
+		}
+	}
+}
+
+type transportKey struct{}
+
+// WithTransport возвращает контекст со способом передачи метрик
+func WithTransport(ctx context.Context, transport Transport) context.Context {
+	return context.WithValue(ctx, transportKey{}, transport)
+}
+
+// SourceFromContext возвращает запись журнала без времени и метрик,
+// заполненную данными о клиенте из контекста запроса
+func SourceFromContext(ctx context.Context) Entry {
+	var entry Entry
+	entry.Transport, _ = ctx.Value(transportKey{}).(Transport)
+	if ip := netutil.ClientIPFromContext(ctx); ip != nil {
+		entry.IP = ip.String()
+	}
+	entry.AgentID = agentkey.AgentIDFromContext(ctx)
+	if identity, ok := apitoken.IdentityFromContext(ctx); ok {
+		entry.Token = identity.Name
+	}
+	return entry
+}
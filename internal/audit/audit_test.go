@@ -0,0 +1,174 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/apitoken"
+	"github.com/MPoline/alert_service_yp/internal/models"
+	"github.com/MPoline/alert_service_yp/internal/netutil"
+	"github.com/MPoline/alert_service_yp/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gauge(id string, v float64) models.Metrics {
+	return models.Metrics{ID: id, MType: "gauge", Value: &v}
+}
+
+func counter(id string, d int64) models.Metrics {
+	return models.Metrics{ID: id, MType: "counter", Delta: &d}
+}
+
+func TestStorageRecordsChanges(t *testing.T) {
+	sink, err := NewFileSink(filepath.Join(t.TempDir(), "audit.log"), 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	log := New(sink)
+	log.now = func() time.Time { return now }
+
+	mem := storage.NewMemStorage()
+	mem.SetGauge("Alloc", 1.5)
+	mem.IncrementCounter("PollCount", 5)
+	s := Wrap(mem, log)
+
+	ctx := WithTransport(context.Background(), TransportHTTPBatch)
+	ctx = netutil.WithClientIP(ctx, net.ParseIP("10.0.0.5"))
+	ctx = agentkey.WithAgentID(ctx, "agent-1")
+	ctx = apitoken.WithIdentity(ctx, apitoken.Identity{Name: "ci", Role: apitoken.RoleWrite})
+
+	err = s.UpdateSliceOfMetrics(ctx, models.SliceMetrics{Metrics: []models.Metrics{
+		gauge("Alloc", 2.5),
+		counter("PollCount", 1),
+		counter("PollCount", 2),
+		counter("NewCounter", 7),
+	}})
+	require.NoError(t, err)
+
+	// Ошибочная запись не попадает в журнал
+	err = s.UpdateMetric(ctx, models.Metrics{ID: "Bad", MType: "gauge"})
+	require.Error(t, err)
+
+	entries, err := log.Query(context.Background(), Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	entry := entries[0]
+	assert.Equal(t, now, entry.Time)
+	assert.Equal(t, "10.0.0.5", entry.IP)
+	assert.Equal(t, "agent-1", entry.AgentID)
+	assert.Equal(t, "ci", entry.Token)
+	assert.Equal(t, TransportHTTPBatch, entry.Transport)
+
+	require.Len(t, entry.Metrics, 3)
+	alloc, poll, added := entry.Metrics[0], entry.Metrics[1], entry.Metrics[2]
+	assert.Equal(t, 1.5, *alloc.OldValue)
+	assert.Equal(t, 2.5, *alloc.NewValue)
+	assert.Equal(t, int64(5), *poll.OldDelta)
+	assert.Equal(t, int64(8), *poll.NewDelta)
+	assert.Equal(t, int64(0), *added.OldDelta)
+	assert.Equal(t, int64(7), *added.NewDelta)
+
+	current, err := mem.GetMetric(context.Background(), "counter", "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, *poll.NewDelta, *current.Delta)
+}
+
+func TestStorageRecordsConcurrentChanges(t *testing.T) {
+	sink, err := NewFileSink(filepath.Join(t.TempDir(), "audit.log"), 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	log := New(sink)
+	s := Wrap(storage.NewMemStorage(), log)
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.UpdateMetric(context.Background(), counter("PollCount", 1)))
+		}()
+	}
+	wg.Wait()
+
+	entries, err := log.Query(context.Background(), Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, writers)
+
+	// Каждая запись видит собственное прежнее значение: значения не повторяются
+	seen := make(map[int64]bool, writers)
+	for _, entry := range entries {
+		require.Len(t, entry.Metrics, 1)
+		change := entry.Metrics[0]
+		assert.Equal(t, *change.OldDelta+1, *change.NewDelta)
+		assert.False(t, seen[*change.OldDelta], "old value %d recorded twice", *change.OldDelta)
+		seen[*change.OldDelta] = true
+	}
+}
+
+func TestFileSinkRotationAndQuery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(path, 300, 2)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		entry := Entry{
+			Time:      start.Add(time.Duration(i) * time.Hour),
+			Transport: TransportGRPC,
+			Metrics:   []Change{{ID: "PollCount", MType: "counter"}},
+		}
+		require.NoError(t, sink.Write(context.Background(), entry))
+	}
+
+	for _, p := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(p)
+		require.NoError(t, err, p)
+		assert.LessOrEqual(t, info.Size(), int64(300), p)
+	}
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err), "backups above the limit are removed")
+
+	all, err := sink.Query(context.Background(), Filter{})
+	require.NoError(t, err)
+	require.NotEmpty(t, all)
+	assert.Less(t, len(all), 10, "oldest entries are rotated out")
+	assert.Equal(t, start.Add(9*time.Hour), all[len(all)-1].Time)
+	for i := 1; i < len(all); i++ {
+		assert.True(t, all[i-1].Time.Before(all[i].Time), "entries are in time order")
+	}
+
+	from := start.Add(7 * time.Hour)
+	ranged, err := sink.Query(context.Background(), Filter{From: from, To: start.Add(9 * time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, ranged, 2)
+	assert.Equal(t, from, ranged[0].Time)
+
+	limited, err := sink.Query(context.Background(), Filter{From: from, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, limited, 1)
+	assert.Equal(t, from, limited[0].Time)
+}
+
+func TestDisabledLogger(t *testing.T) {
+	var log *Logger
+	assert.False(t, log.Enabled())
+	assert.Nil(t, New())
+
+	mem := storage.NewMemStorage()
+	assert.Same(t, mem, Wrap(mem, log))
+
+	_, err := log.Query(context.Background(), Filter{})
+	assert.ErrorIs(t, err, ErrDisabled)
+}
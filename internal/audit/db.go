@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const insertAuditQuery = `INSERT INTO audit_log (ts, ip, agent_id, token, transport, metrics)
+	VALUES ($1, $2, $3, $4, $5, $6)`
+
+// DBSink пишет журнал аудита в таблицу audit_log. Записи только добавляются.
+type DBSink struct {
+	db *sql.DB
+}
+
+// NewDBSink создает журнал в таблице audit_log, которую создает миграция схемы.
+// Соединение db принадлежит вызывающему и не закрывается Close.
+func NewDBSink(db *sql.DB) *DBSink {
+	return &DBSink{db: db}
+}
+
+// Write добавляет запись в таблицу
+func (s *DBSink) Write(ctx context.Context, entry Entry) error {
+	metrics, err := json.Marshal(entry.Metrics)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, insertAuditQuery,
+		entry.Time, entry.IP, entry.AgentID, entry.Token, string(entry.Transport), string(metrics))
+	return err
+}
+
+// Query возвращает записи за интервал фильтра в порядке добавления
+func (s *DBSink) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	var conditions []string
+	var args []any
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		conditions = append(conditions, fmt.Sprintf("ts >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		conditions = append(conditions, fmt.Sprintf("ts < $%d", len(args)))
+	}
+
+	query := `SELECT ts, ip, agent_id, token, transport, metrics FROM audit_log`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY ts, id"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		var transport string
+		var metrics []byte
+		if err := rows.Scan(&entry.Time, &entry.IP, &entry.AgentID, &entry.Token, &transport, &metrics); err != nil {
+			return nil, err
+		}
+		entry.Time = entry.Time.UTC()
+		entry.Transport = Transport(transport)
+		if err := json.Unmarshal(metrics, &entry.Metrics); err != nil {
+			return nil, fmt.Errorf("malformed audit log metrics: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Close ничего не делает: соединением владеет вызывающий
+func (s *DBSink) Close() error {
+	return nil
+}
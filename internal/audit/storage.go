@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/MPoline/alert_service_yp/internal/models"
+	"github.com/MPoline/alert_service_yp/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Storage - декоратор хранилища, записывающий в журнал аудита каждую успешную запись метрик.
+// Прежние и новые значения сообщает само хранилище: они прочитаны атомарно с записью,
+// для counter новое значение - накопленное после записи.
+type Storage struct {
+	storage.Storage
+
+	updater storage.Updater
+	log     *Logger
+}
+
+// Wrap оборачивает хранилище для записи журнала аудита. Если журнал не ведется
+// или хранилище не сообщает изменения метрик, хранилище возвращается без изменений.
+func Wrap(s storage.Storage, log *Logger) storage.Storage {
+	if !log.Enabled() {
+		return s
+	}
+	updater, ok := s.(storage.Updater)
+	if !ok {
+		zap.L().Error("Audit log is not supported by the storage, audit is disabled")
+		return s
+	}
+	return &Storage{Storage: s, updater: updater, log: log}
+}
+
+// Unwrap возвращает хранилище, изменения которого записываются в журнал
+func (s *Storage) Unwrap() storage.Storage {
+	return s.Storage
+}
+
+// UpdateMetric обновляет метрику и записывает изменение в журнал
+func (s *Storage) UpdateMetric(ctx context.Context, metric models.Metrics) error {
+	return s.apply(ctx, []models.Metrics{metric})
+}
+
+// UpdateSliceOfMetrics обновляет метрики батчем и записывает изменения в журнал
+func (s *Storage) UpdateSliceOfMetrics(ctx context.Context, sliceMitrics models.SliceMetrics) error {
+	return s.apply(ctx, sliceMitrics.Metrics)
+}
+
+// apply записывает метрики и заносит в журнал изменения, которые сообщило хранилище
+func (s *Storage) apply(ctx context.Context, metrics []models.Metrics) error {
+	updates, err := s.updater.ApplyMetrics(ctx, metrics)
+	if err != nil {
+		return err
+	}
+
+	changes := make([]Change, 0, len(updates))
+	for _, update := range updates {
+		change := Change{
+			ID:       update.New.ID,
+			MType:    update.New.MType,
+			NewValue: update.New.Value,
+			NewDelta: update.New.Delta,
+		}
+		if update.Old != nil {
+			change.OldValue = update.Old.Value
+			change.OldDelta = update.Old.Delta
+		}
+		changes = append(changes, change)
+	}
+
+	s.log.Record(ctx, changes)
+	return nil
+}
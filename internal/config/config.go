@@ -6,7 +6,10 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/hasher"
 )
 
 type Duration time.Duration
@@ -19,10 +22,48 @@ type ServerConfig struct {
 	DatabaseDSN     string   `json:"database_dsn"`
 	Key             string   `json:"key"`
 	CryptoKey       string   `json:"crypto_key"`
+	KeyringFile     string   `json:"keyring_file"`
+	HashAlg         string   `json:"hash_alg"`
+	AgentKeysDir    string   `json:"agent_keys_dir"`
+	ReplayWindow    Duration `json:"replay_window"`
+	ReplayCacheSize int      `json:"replay_cache_size"`
 	ConfigFile      string   `json:"-"`
 	TrustedSubnet   string   `json:"trusted_subnet"`
+	TrustedProxies  string   `json:"trusted_proxies"`
+
+	MaxBodySize         int64   `json:"max_body_size"`
+	MaxDecompressedSize int64   `json:"max_decompressed_size"`
+	RateLimit           float64 `json:"rate_limit"`
+	RateBurst           int     `json:"rate_burst"`
+	RateLimitKey        string  `json:"rate_limit_key"`
+
+	AuditFile       string `json:"audit_file"`
+	AuditMaxSize    int    `json:"audit_max_size"`
+	AuditMaxBackups int    `json:"audit_max_backups"`
+	AuditDB         bool   `json:"audit_db"`
+
+	DBMaxConns        int      `json:"db_max_conns"`
+	DBMaxIdleConns    int      `json:"db_max_idle_conns"`
+	DBConnMaxLifetime Duration `json:"db_conn_max_lifetime"`
+	DBConnMaxIdleTime Duration `json:"db_conn_max_idle_time"`
+	DBRetryAttempts   int      `json:"db_retry_attempts"`
 	GRPCAddress     string   `json:"grpc_address"` 
 	UseGRPC         bool     `json:"use_grpc"`     
+	AgentConfigFile string   `json:"agent_config_file"`
+	GRPCReflection  bool     `json:"grpc_reflection"`
+	TLSCert         string   `json:"tls_cert"`
+	TLSKey          string   `json:"tls_key"`
+	TLSClientCA     string   `json:"tls_client_ca"`
+
+	APITokens []APIToken `json:"api_tokens"`
+}
+
+// APIToken - токен доступа к API сервера: имя владельца, роль (read, write, admin)
+// и SHA-256 хеш токена в hex
+type APIToken struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	Hash string `json:"hash"`
 }
 
 type AgentConfig struct {
@@ -31,11 +72,86 @@ type AgentConfig struct {
 	PollInterval   Duration `json:"poll_interval"`
 	CryptoKey      string   `json:"crypto_key"`
 	Key            string   `json:"key"`
+	KeyID          string   `json:"key_id"`
+	HashAlg        string   `json:"hash_alg"`
+	AgentID        string   `json:"agent_id"`
+	SigningKey     string   `json:"signing_key"`
+	APIToken       string   `json:"api_token"`
 	ConfigFile     string   `json:"-"`
 	UseGRPC        bool     `json:"use_grpc"`    
 	GRPCAddress    string   `json:"grpc_address"` 
+	Aggregate      bool     `json:"aggregate"`
+	AggregateP95   bool     `json:"aggregate_p95"`
+	StatusAddress  string   `json:"status_address"`
+	Collectors     []string `json:"collectors"`
+
+	RemoteConfig         bool     `json:"remote_config"`
+	Label                string   `json:"label"`
+	RemoteConfigInterval Duration `json:"remote_config_interval"`
+	Strategy             string   `json:"strategy"`
+
+	RetryAttempts    int      `json:"retry_attempts"`
+	RetryMaxDelay    Duration `json:"retry_max_delay"`
+	BreakerThreshold int      `json:"breaker_threshold"`
+	BreakerTimeout   Duration `json:"breaker_timeout"`
+
+	BatchMaxMetrics int `json:"batch_max_metrics"`
+	BatchMaxBytes   int `json:"batch_max_bytes"`
+
+	GRPCStream bool `json:"grpc_stream"`
+
+	TLS     bool   `json:"tls"`
+	TLSCA   string `json:"tls_ca"`
+	TLSCert string `json:"tls_cert"`
+	TLSKey  string `json:"tls_key"`
 }
 
+// RemoteAgentConfig - настройки агента, раздаваемые сервером
+type RemoteAgentConfig struct {
+	PollInterval   Duration          `json:"poll_interval,omitempty"`
+	ReportInterval Duration          `json:"report_interval,omitempty"`
+	Collectors     []string          `json:"collectors,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+}
+
+// AgentConfigRule - правило выбора настроек агента по метке или IP адресу.
+// IP может быть задан как отдельным адресом, так и подсетью в формате CIDR.
+type AgentConfigRule struct {
+	Label  string            `json:"label,omitempty"`
+	IP     string            `json:"ip,omitempty"`
+	Config RemoteAgentConfig `json:"config"`
+}
+
+// AgentConfigSet - набор настроек агентов, хранящийся на сервере
+type AgentConfigSet struct {
+	Default RemoteAgentConfig `json:"default"`
+	Rules   []AgentConfigRule `json:"rules"`
+}
+
+// Имена сборщиков метрик агента
+const (
+	// CollectorRuntime - метрики runtime.MemStats, PollCount и RandomValue
+	CollectorRuntime = "runtime"
+	// CollectorSystem - метрики памяти и загрузки CPU из gopsutil
+	CollectorSystem = "system"
+)
+
+// Стратегии распределения отправки метрик между несколькими серверами
+const (
+	// StrategyFailover - отправка на первый доступный сервер
+	StrategyFailover = "failover"
+	// StrategyRoundRobin - поочередная отправка на доступные серверы
+	StrategyRoundRobin = "round-robin"
+	// StrategyBroadcast - отправка на все доступные серверы
+	StrategyBroadcast = "broadcast"
+)
+
+// KnownStrategies - список поддерживаемых стратегий отправки
+var KnownStrategies = []string{StrategyFailover, StrategyRoundRobin, StrategyBroadcast}
+
+// KnownCollectors - список поддерживаемых агентом сборщиков метрик
+var KnownCollectors = []string{CollectorRuntime, CollectorSystem}
+
 func (d Duration) MarshalJSON() ([]byte, error) {
 	return json.Marshal(time.Duration(d).String())
 }
@@ -111,6 +227,188 @@ func LoadAgentConfig(configPath string) (*AgentConfig, error) {
 	return &config, nil
 }
 
+// Validate проверяет корректность конфигурации агента
+func (c *AgentConfig) Validate() error {
+	for name, addrs := range map[string]string{"address": c.Address, "grpc_address": c.GRPCAddress} {
+		for _, addr := range SplitList(addrs) {
+			if _, _, err := net.SplitHostPort(addr); err != nil {
+				return fmt.Errorf("invalid %s %q: %w", name, addr, err)
+			}
+		}
+	}
+
+	if c.Strategy != "" && !IsKnownStrategy(c.Strategy) {
+		return fmt.Errorf("unknown strategy %q", c.Strategy)
+	}
+
+	for name, interval := range map[string]Duration{"report_interval": c.ReportInterval, "poll_interval": c.PollInterval} {
+		if interval != 0 && interval.ToDuration() < time.Second {
+			return fmt.Errorf("%s must be at least 1s, got %s", name, interval.ToDuration())
+		}
+	}
+
+	for _, collector := range c.Collectors {
+		if !IsKnownCollector(collector) {
+			return fmt.Errorf("unknown collector %q", collector)
+		}
+	}
+
+	if c.RetryAttempts < 0 {
+		return fmt.Errorf("retry_attempts must not be negative, got %d", c.RetryAttempts)
+	}
+	if c.BreakerThreshold < 0 {
+		return fmt.Errorf("breaker_threshold must not be negative, got %d", c.BreakerThreshold)
+	}
+	if c.BatchMaxMetrics < 0 {
+		return fmt.Errorf("batch_max_metrics must not be negative, got %d", c.BatchMaxMetrics)
+	}
+	if c.BatchMaxBytes < 0 {
+		return fmt.Errorf("batch_max_bytes must not be negative, got %d", c.BatchMaxBytes)
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("tls_cert and tls_key must be set together")
+	}
+	if _, err := hasher.Normalize(c.HashAlg); err != nil {
+		return fmt.Errorf("invalid hash_alg: %w", err)
+	}
+	if c.SigningKey != "" && c.AgentID == "" {
+		return fmt.Errorf("agent_id is required with signing_key")
+	}
+
+	return nil
+}
+
+// Validate проверяет корректность настроек, полученных от сервера
+func (c *RemoteAgentConfig) Validate() error {
+	for name, interval := range map[string]Duration{"report_interval": c.ReportInterval, "poll_interval": c.PollInterval} {
+		if interval != 0 && interval.ToDuration() < time.Second {
+			return fmt.Errorf("%s must be at least 1s, got %s", name, interval.ToDuration())
+		}
+	}
+
+	for _, collector := range c.Collectors {
+		if !IsKnownCollector(collector) {
+			return fmt.Errorf("unknown collector %q", collector)
+		}
+	}
+
+	return nil
+}
+
+// LoadAgentConfigSet загружает набор настроек агентов из JSON файла
+func LoadAgentConfigSet(configPath string) (*AgentConfigSet, error) {
+	if configPath == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent config file: %w", err)
+	}
+
+	var set AgentConfigSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse agent config file: %w", err)
+	}
+
+	if err := set.Default.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid default agent config: %w", err)
+	}
+	for i, rule := range set.Rules {
+		if rule.IP != "" && net.ParseIP(rule.IP) == nil {
+			if _, _, err := net.ParseCIDR(rule.IP); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid IP or CIDR %q", i, rule.IP)
+			}
+		}
+		if err := rule.Config.Validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+
+	return &set, nil
+}
+
+// Resolve возвращает настройки для агента с указанной меткой и IP адресом.
+// Применяется первое подходящее правило поверх настроек по умолчанию.
+func (s *AgentConfigSet) Resolve(label, ip string) RemoteAgentConfig {
+	result := s.Default
+	for _, rule := range s.Rules {
+		if !rule.matches(label, ip) {
+			continue
+		}
+
+		if rule.Config.PollInterval != 0 {
+			result.PollInterval = rule.Config.PollInterval
+		}
+		if rule.Config.ReportInterval != 0 {
+			result.ReportInterval = rule.Config.ReportInterval
+		}
+		if len(rule.Config.Collectors) > 0 {
+			result.Collectors = rule.Config.Collectors
+		}
+		if len(rule.Config.Labels) > 0 {
+			labels := make(map[string]string, len(result.Labels)+len(rule.Config.Labels))
+			for k, v := range result.Labels {
+				labels[k] = v
+			}
+			for k, v := range rule.Config.Labels {
+				labels[k] = v
+			}
+			result.Labels = labels
+		}
+		break
+	}
+	return result
+}
+
+func (r AgentConfigRule) matches(label, ip string) bool {
+	if r.Label == "" && r.IP == "" {
+		return false
+	}
+	if r.Label != "" && r.Label != label {
+		return false
+	}
+	if r.IP != "" {
+		if !strings.Contains(r.IP, "/") {
+			return r.IP == ip
+		}
+		inSubnet, err := IsIPInTrustedSubnet(ip, r.IP)
+		return err == nil && inSubnet
+	}
+	return true
+}
+
+// IsKnownStrategy проверяет, поддерживается ли стратегия отправки с указанным именем
+func IsKnownStrategy(name string) bool {
+	for _, known := range KnownStrategies {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitList разбивает список значений, перечисленных через запятую
+func SplitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// IsKnownCollector проверяет, поддерживается ли сборщик с указанным именем
+func IsKnownCollector(name string) bool {
+	for _, known := range KnownCollectors {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
 func MaskSensitive(value string) string {
 	if value == "" {
 		return ""
@@ -0,0 +1,85 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/config"
+)
+
+func TestAgentConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.AgentConfig
+		wantErr bool
+	}{
+		{
+			name: "Valid config",
+			cfg: config.AgentConfig{
+				Address:        "localhost:8080",
+				ReportInterval: config.Duration(10 * time.Second),
+				PollInterval:   config.Duration(2 * time.Second),
+				Collectors:     []string{"runtime", "system"},
+			},
+		},
+		{
+			name:    "Invalid address",
+			cfg:     config.AgentConfig{Address: "localhost"},
+			wantErr: true,
+		},
+		{
+			name:    "Sub-second interval",
+			cfg:     config.AgentConfig{PollInterval: config.Duration(500 * time.Millisecond)},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown collector",
+			cfg:     config.AgentConfig{Collectors: []string{"disk"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAgentConfigSetResolve(t *testing.T) {
+	set := config.AgentConfigSet{
+		Default: config.RemoteAgentConfig{
+			PollInterval:   config.Duration(2 * time.Second),
+			ReportInterval: config.Duration(10 * time.Second),
+			Labels:         map[string]string{"env": "prod"},
+		},
+		Rules: []config.AgentConfigRule{
+			{Label: "db", Config: config.RemoteAgentConfig{PollInterval: config.Duration(time.Second)}},
+			{IP: "10.0.0.0/8", Config: config.RemoteAgentConfig{Labels: map[string]string{"dc": "internal"}}},
+		},
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		got := set.Resolve("web", "192.168.1.1")
+		if got.PollInterval != config.Duration(2*time.Second) || got.Labels["env"] != "prod" {
+			t.Errorf("Unexpected default config: %+v", got)
+		}
+	})
+
+	t.Run("By label", func(t *testing.T) {
+		got := set.Resolve("db", "192.168.1.1")
+		if got.PollInterval != config.Duration(time.Second) || got.ReportInterval != config.Duration(10*time.Second) {
+			t.Errorf("Unexpected config for label: %+v", got)
+		}
+	})
+
+	t.Run("By subnet", func(t *testing.T) {
+		got := set.Resolve("", "10.1.2.3")
+		if got.Labels["dc"] != "internal" || got.Labels["env"] != "prod" {
+			t.Errorf("Unexpected labels for subnet: %v", got.Labels)
+		}
+	})
+}
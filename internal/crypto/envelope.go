@@ -0,0 +1,186 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Формат конверта (envelope) версии 2:
+//
+//	version(1) | key_id_len(1) | key_id | wrapped_key_len(2) | wrapped_key | nonce(12) | ciphertext
+//
+// Данные шифруются случайным ключом AES-256-GCM, который в свою очередь
+// шифруется RSA-OAEP (wrapped_key). Заголовок до wrapped_key включительно
+// передается в GCM как дополнительные аутентифицируемые данные.
+const (
+	EnvelopeVersion uint8 = 2
+	EnvelopeKeySize int   = 32 // AES-256
+	envelopeNonce   int   = 12
+)
+
+// KeyID возвращает идентификатор публичного ключа: первые 8 байт SHA-256
+// от DER представления ключа в шестнадцатеричном виде
+func KeyID(publicKey *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
+
+// EncryptEnvelope шифрует данные конвертом версии 2
+func EncryptEnvelope(publicKey *rsa.PublicKey, data []byte) ([]byte, error) {
+	if publicKey == nil {
+		return data, nil
+	}
+
+	dataKey := make([]byte, EnvelopeKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, dataKey, OAEPLabel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	keyID := KeyID(publicKey)
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	headerSize := 1 + 1 + len(keyID) + 2 + len(wrappedKey)
+	out := make([]byte, headerSize, headerSize+envelopeNonce+len(data)+gcm.Overhead())
+	out[0] = EnvelopeVersion
+	out[1] = byte(len(keyID))
+	copy(out[2:], keyID)
+	binary.BigEndian.PutUint16(out[2+len(keyID):], uint16(len(wrappedKey)))
+	copy(out[4+len(keyID):], wrappedKey)
+
+	nonce := make([]byte, envelopeNonce)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	out = append(out, nonce...)
+
+	return gcm.Seal(out, nonce, data, out[:headerSize]), nil
+}
+
+// envelope - разобранный конверт версии 2
+type envelope struct {
+	keyID      string
+	wrappedKey []byte
+	nonce      []byte
+	ciphertext []byte
+	header     []byte
+}
+
+func parseEnvelope(data []byte) (*envelope, error) {
+	if len(data) < 2 || data[0] != EnvelopeVersion {
+		return nil, errors.New("not an envelope")
+	}
+
+	keyIDEnd := 2 + int(data[1])
+	if len(data) < keyIDEnd+2 {
+		return nil, errors.New("envelope too short for key id")
+	}
+
+	wrappedEnd := keyIDEnd + 2 + int(binary.BigEndian.Uint16(data[keyIDEnd:]))
+	if len(data) < wrappedEnd+envelopeNonce {
+		return nil, errors.New("envelope too short for wrapped key")
+	}
+
+	return &envelope{
+		keyID:      string(data[2:keyIDEnd]),
+		wrappedKey: data[keyIDEnd+2 : wrappedEnd],
+		nonce:      data[wrappedEnd : wrappedEnd+envelopeNonce],
+		ciphertext: data[wrappedEnd+envelopeNonce:],
+		header:     data[:wrappedEnd],
+	}, nil
+}
+
+// EnvelopeKeyID возвращает идентификатор ключа, которым зашифрован конверт
+func EnvelopeKeyID(data []byte) (string, error) {
+	env, err := parseEnvelope(data)
+	if err != nil {
+		return "", err
+	}
+	return env.keyID, nil
+}
+
+// DecryptEnvelope расшифровывает конверт версии 2
+func DecryptEnvelope(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
+	if privateKey == nil {
+		return data, nil
+	}
+
+	env, err := parseEnvelope(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse envelope: %w", err)
+	}
+
+	if keyID := KeyID(&privateKey.PublicKey); env.keyID != keyID {
+		return nil, fmt.Errorf("envelope key id %q doesn't match private key %q", env.keyID, keyID)
+	}
+
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, env.wrappedKey, OAEPLabel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, env.nonce, env.ciphertext, env.header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt envelope: %w", err)
+	}
+	return plaintext, nil
+}
+
+// IsEnvelope проверяет, что данные похожи на конверт версии 2
+func IsEnvelope(data []byte) bool {
+	_, err := parseEnvelope(data)
+	return err == nil
+}
+
+// Decrypt расшифровывает данные в любом поддерживаемом формате:
+// конверт версии 2, chunk protocol версии 1 или одиночный блок RSA-OAEP.
+func Decrypt(privateKey *rsa.PrivateKey, data []byte) ([]byte, error) {
+	if privateKey == nil {
+		return data, nil
+	}
+
+	// Одиночный блок RSA-OAEP может случайно начинаться с байта версии,
+	// но конверт всегда длиннее блока RSA
+	if len(data) != privateKey.Size() && IsEnvelope(data) {
+		return DecryptEnvelope(privateKey, data)
+	}
+	return DecryptLargeData(privateKey, data)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
+}
@@ -0,0 +1,109 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	key := generateKey(t)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "small", data: []byte("12345")},
+		{name: "large", data: bytes.Repeat([]byte(`{"id":"Alloc","type":"gauge","value":1.5}`), 1000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := EncryptEnvelope(&key.PublicKey, tt.data)
+			require.NoError(t, err)
+			assert.True(t, IsEnvelope(encrypted))
+			assert.False(t, IsChunkProtocol(encrypted))
+
+			keyID, err := EnvelopeKeyID(encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, KeyID(&key.PublicKey), keyID)
+
+			decrypted, err := Decrypt(key, encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, tt.data, decrypted)
+		})
+	}
+}
+
+func TestEnvelopeSmallerThanChunkProtocol(t *testing.T) {
+	key := generateKey(t)
+	data := bytes.Repeat([]byte("x"), 10000)
+
+	envelope, err := EncryptEnvelope(&key.PublicKey, data)
+	require.NoError(t, err)
+	chunked, err := EncryptLargeData(&key.PublicKey, data)
+	require.NoError(t, err)
+
+	assert.Less(t, len(envelope), len(chunked))
+}
+
+func TestDecryptAcceptsChunkProtocol(t *testing.T) {
+	key := generateKey(t)
+
+	for _, data := range [][]byte{
+		[]byte("42"),
+		bytes.Repeat([]byte("metric"), 200),
+	} {
+		encrypted, err := EncryptLargeData(&key.PublicKey, data)
+		require.NoError(t, err)
+
+		decrypted, err := Decrypt(key, encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, data, decrypted)
+	}
+}
+
+func TestDecryptEnvelopeErrors(t *testing.T) {
+	key := generateKey(t)
+	encrypted, err := EncryptEnvelope(&key.PublicKey, []byte("secret"))
+	require.NoError(t, err)
+
+	t.Run("tampered ciphertext", func(t *testing.T) {
+		tampered := bytes.Clone(encrypted)
+		tampered[len(tampered)-1] ^= 0xff
+
+		_, err := DecryptEnvelope(key, tampered)
+		assert.Error(t, err)
+	})
+
+	t.Run("tampered key id", func(t *testing.T) {
+		tampered := bytes.Clone(encrypted)
+		tampered[2] ^= 0x01
+
+		_, err := DecryptEnvelope(key, tampered)
+		assert.ErrorContains(t, err, "doesn't match")
+	})
+
+	t.Run("other private key", func(t *testing.T) {
+		_, err := DecryptEnvelope(generateKey(t), encrypted)
+		assert.ErrorContains(t, err, "doesn't match")
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := DecryptEnvelope(key, encrypted[:20])
+		assert.Error(t, err)
+	})
+}
@@ -1,7 +1,10 @@
 package hasher_test
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
 	"fmt"
 	"testing"
 
@@ -9,7 +12,11 @@ import (
 )
 
 func ExampleInitHasher() {
-	h := hasher.InitHasher("sha256")
+	h, err := hasher.InitHasher("sha256")
+	if err != nil {
+		fmt.Println("Unsupported algorithm:", err)
+		return
+	}
 
 	data := []byte("test data")
 	key := []byte("secret key")
@@ -62,3 +69,61 @@ func TestHasher(t *testing.T) {
 		}
 	})
 }
+
+func TestInitHasher(t *testing.T) {
+	tests := []struct {
+		method string
+		size   int
+	}{
+		{"", sha256.Size},
+		{"SHA256", sha256.Size},
+		{"hmac-sha512", sha512.Size},
+		{"blake2b", 64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			h, err := hasher.InitHasher(tt.method)
+			if err != nil {
+				t.Fatalf("InitHasher failed: %v", err)
+			}
+			hash, err := h.CalculateHash([]byte("data"), []byte("key"))
+			if err != nil {
+				t.Fatalf("CalculateHash failed: %v", err)
+			}
+			if len(hash) != tt.size {
+				t.Errorf("Expected hash length %d, got %d", tt.size, len(hash))
+			}
+		})
+	}
+
+	t.Run("Unknown algorithm", func(t *testing.T) {
+		if _, err := hasher.InitHasher("md5"); !errors.Is(err, hasher.ErrUnknownAlgorithm) {
+			t.Errorf("Expected ErrUnknownAlgorithm, got %v", err)
+		}
+	})
+
+	t.Run("Algorithms differ", func(t *testing.T) {
+		var hashes [][]byte
+		for _, method := range hasher.Algorithms() {
+			h, _ := hasher.InitHasher(method)
+			hash, err := h.CalculateHash([]byte("data"), []byte("key"))
+			if err != nil {
+				t.Fatalf("%s: %v", method, err)
+			}
+			for _, other := range hashes {
+				if bytes.Equal(hash, other) {
+					t.Errorf("%s produced the same hash as another algorithm", method)
+				}
+			}
+			hashes = append(hashes, hash)
+		}
+	})
+
+	t.Run("Blake2b key too long", func(t *testing.T) {
+		h := hasher.NewBlake2bHasher()
+		if _, err := h.CalculateHash([]byte("data"), bytes.Repeat([]byte("k"), 65)); err == nil {
+			t.Error("Expected error for blake2b key longer than 64 bytes")
+		}
+	})
+}
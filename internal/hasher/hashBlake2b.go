@@ -0,0 +1,51 @@
+package hasher
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/blake2b"
+)
+
+// blake2bHasher реализует Hasher интерфейс используя BLAKE2b-512 в режиме с ключом.
+type blake2bHasher struct{}
+
+// NewBlake2bHasher создает новый экземпляр хешера BLAKE2b с ключом.
+//
+// Возвращает:
+//   - *blake2bHasher: указатель на новый хешер
+func NewBlake2bHasher() *blake2bHasher {
+	return &blake2bHasher{}
+}
+
+// CalculateHash вычисляет BLAKE2b-512 хеш для данных с использованием ключа.
+// BLAKE2b поддерживает ключ напрямую, поэтому конструкция HMAC не нужна.
+//
+// Параметры:
+//   - data: данные для хеширования
+//   - key: секретный ключ длиной не более 64 байт
+//
+// Возвращает:
+//   - []byte: вычисленный хеш
+//   - error: ошибка если данные или ключ пустые, либо ключ длиннее 64 байт
+func (h *blake2bHasher) CalculateHash(data []byte, key []byte) (result []byte, err error) {
+	if len(data) == 0 || len(key) == 0 {
+		zap.L().Info("InputStringOrKeyIsEmpty")
+		return nil, errors.New("InputStringOrKeyIsEmpty")
+	}
+
+	mac, err := blake2b.New512(key)
+	if err != nil {
+		return nil, fmt.Errorf("blake2b key must be at most %d bytes: %w", blake2b.Size, err)
+	}
+
+	_, err = mac.Write(data)
+	if err != nil {
+		zap.L().Error("Failed to write input data: ", zap.Error(err))
+		return nil, err
+	}
+
+	result = mac.Sum(nil)
+	return result, nil
+}
@@ -0,0 +1,47 @@
+package hasher
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// sha512Hasher реализует Hasher интерфейс используя HMAC-SHA512.
+type sha512Hasher struct{}
+
+// NewSHA512Hasher создает новый экземпляр SHA-512 HMAC хешера.
+//
+// Возвращает:
+//   - *sha512Hasher: указатель на новый хешер
+func NewSHA512Hasher() *sha512Hasher {
+	return &sha512Hasher{}
+}
+
+// CalculateHash вычисляет HMAC-SHA512 хеш для данных с использованием ключа.
+//
+// Параметры:
+//   - data: данные для хеширования
+//   - key: секретный ключ
+//
+// Возвращает:
+//   - []byte: вычисленный HMAC-SHA512 хеш
+//   - error: ошибка если данные или ключ пустые, либо произошла ошибка записи данных
+func (h *sha512Hasher) CalculateHash(data []byte, key []byte) (result []byte, err error) {
+	if len(data) == 0 || len(key) == 0 {
+		zap.L().Info("InputStringOrKeyIsEmpty")
+		return nil, errors.New("InputStringOrKeyIsEmpty")
+	}
+
+	mac := hmac.New(sha512.New, key)
+
+	_, err = mac.Write(data)
+	if err != nil {
+		zap.L().Error("Failed to write input data: ", zap.Error(err))
+		return nil, err
+	}
+
+	result = mac.Sum(nil)
+	return result, nil
+}
@@ -2,10 +2,44 @@
 //
 // Пакет содержит:
 // - Интерфейс Hasher для унифицированного доступа к различным алгоритмам хеширования
-// - Реализацию SHA-256 HMAC хешера
-// - Фабричную функцию для инициализации хешера
+// - Реализации HMAC-SHA256, HMAC-SHA512 и BLAKE2b с ключом
+// - Фабричную функцию для инициализации хешера по названию алгоритма
 package hasher
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Названия поддерживаемых алгоритмов подписи
+const (
+	SHA256  = "sha256"
+	SHA512  = "sha512"
+	BLAKE2b = "blake2b"
+)
+
+// DefaultAlgorithm - алгоритм подписи, используемый, если другой не указан
+const DefaultAlgorithm = SHA256
+
+// HeaderAlgorithm - заголовок HTTP с алгоритмом подписи запроса
+const HeaderAlgorithm = "X-Hash-Alg"
+
+// ErrUnknownAlgorithm - запрошен неподдерживаемый алгоритм подписи
+var ErrUnknownAlgorithm = errors.New("unknown hash algorithm")
+
+// aliases сопоставляет допустимые написания алгоритмов их названиям
+var aliases = map[string]string{
+	"sha256":      SHA256,
+	"sha-256":     SHA256,
+	"hmac-sha256": SHA256,
+	"sha512":      SHA512,
+	"sha-512":     SHA512,
+	"hmac-sha512": SHA512,
+	"blake2b":     BLAKE2b,
+	"blake2b-512": BLAKE2b,
+}
+
 // Hasher определяет интерфейс для вычисления хеш-сумм.
 type Hasher interface {
 	// CalculateHash вычисляет хеш для данных с использованием ключа.
@@ -15,14 +49,48 @@ type Hasher interface {
 	CalculateHash(data []byte, key []byte) ([]byte, error)
 }
 
+// Algorithms возвращает названия поддерживаемых алгоритмов
+func Algorithms() []string {
+	return []string{SHA256, SHA512, BLAKE2b}
+}
+
+// Normalize приводит название алгоритма к каноническому виду без учета регистра.
+// Пустое название означает DefaultAlgorithm.
+//
+// Возвращает:
+//   - string: каноническое название алгоритма
+//   - error: ErrUnknownAlgorithm для неподдерживаемого алгоритма
+func Normalize(method string) (string, error) {
+	method = strings.ToLower(strings.TrimSpace(method))
+	if method == "" {
+		return DefaultAlgorithm, nil
+	}
+	if name, ok := aliases[method]; ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("%w %q, supported: %s", ErrUnknownAlgorithm, method, strings.Join(Algorithms(), ", "))
+}
+
 // InitHasher инициализирует хешер указанного типа.
-// В текущей реализации всегда возвращает SHA-256 HMAC хешер.
 //
 // Параметры:
-//   - method: тип хешера (в будущем может поддерживать разные алгоритмы)
+//   - method: алгоритм подписи (sha256, sha512 или blake2b), пустая строка означает sha256
 //
 // Возвращает:
 //   - Hasher: инициализированный хешер
-func InitHasher(method string) Hasher {
-	return NewSHA265Hasher()
+//   - error: ErrUnknownAlgorithm для неподдерживаемого алгоритма
+func InitHasher(method string) (Hasher, error) {
+	name, err := Normalize(method)
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case SHA512:
+		return NewSHA512Hasher(), nil
+	case BLAKE2b:
+		return NewBlake2bHasher(), nil
+	default:
+		return NewSHA265Hasher(), nil
+	}
 }
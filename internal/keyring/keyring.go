@@ -0,0 +1,290 @@
+// Package keyring хранит набор ключей сервера: приватные ключи RSA для
+// расшифровки и секреты HMAC для проверки подписей, каждый со своим идентификатором.
+//
+// Несколько одновременно действующих ключей позволяют менять их постепенно:
+// новый ключ добавляется в файл, агенты переключаются на него в своем темпе,
+// после чего старый ключ удаляется и конфигурация перечитывается по SIGHUP.
+//
+// Пример файла:
+//
+//	{
+//	  "default_hmac_key": "2025-10",
+//	  "hmac_keys": {"2025-10": "new-secret", "2025-04": "old-secret"},
+//	  "private_keys": ["/etc/metrics/2025-10.pem", "/etc/metrics/2025-04.pem"]
+//	}
+//
+// Идентификатор приватного ключа вычисляется по его публичной части (crypto.KeyID)
+// и передается агентом внутри зашифрованного конверта.
+package keyring
+
+import (
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/MPoline/alert_service_yp/internal/crypto"
+	"github.com/MPoline/alert_service_yp/internal/hasher"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultKeyID - идентификатор секрета HMAC, заданного флагом -k
+	DefaultKeyID = "default"
+	// HeaderKeyID - заголовок HTTP с идентификатором секрета HMAC агента
+	HeaderKeyID = "X-Key-Id"
+)
+
+var (
+	// ErrNoHMACKeys - проверка подписи невозможна, секреты HMAC не настроены
+	ErrNoHMACKeys = errors.New("no HMAC keys configured")
+	// ErrSignatureMismatch - подпись не совпала ни с одним подходящим секретом
+	ErrSignatureMismatch = errors.New("signature does not match")
+	// ErrNoPrivateKeys - расшифровка невозможна, приватные ключи не настроены
+	ErrNoPrivateKeys = errors.New("no private keys configured")
+)
+
+// File - содержимое файла с ключами
+type File struct {
+	DefaultHMACKey string            `json:"default_hmac_key"`
+	HMACKeys       map[string]string `json:"hmac_keys"`
+	PrivateKeys    []string          `json:"private_keys"`
+}
+
+// privateKey - приватный ключ с идентификатором
+type privateKey struct {
+	id  string
+	key *rsa.PrivateKey
+}
+
+// Keyring - набор ключей сервера. Методы безопасны для nil, пустой
+// набор означает, что подпись и шифрование не используются.
+type Keyring struct {
+	path          string
+	legacyKey     string
+	legacyKeyPath string
+	hashAlg       string
+
+	mu             sync.RWMutex
+	defaultHMACKey string
+	hmacKeys       map[string]string
+	privateKeys    []privateKey
+}
+
+// New загружает ключи из файла path и добавляет к ним ключи из флагов:
+// секрет HMAC hmacKey под идентификатором DefaultKeyID и приватный ключ из cryptoKeyPath.
+// Пустой path означает, что используются только ключи из флагов.
+// hashAlg задает алгоритм подписи для запросов, в которых он не указан.
+func New(path, hmacKey, cryptoKeyPath, hashAlg string) (*Keyring, error) {
+	alg, err := hasher.Normalize(hashAlg)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &Keyring{
+		path:          path,
+		legacyKey:     hmacKey,
+		legacyKeyPath: cryptoKeyPath,
+		hashAlg:       alg,
+	}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload перечитывает файл с ключами. При ошибке продолжает
+// использоваться ранее загруженный набор ключей.
+func (k *Keyring) Reload() error {
+	var file File
+	if k.path != "" {
+		data, err := os.ReadFile(k.path)
+		if err != nil {
+			return fmt.Errorf("failed to read keyring file: %w", err)
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("failed to parse keyring file: %w", err)
+		}
+	}
+
+	hmacKeys := make(map[string]string, len(file.HMACKeys)+1)
+	for id, secret := range file.HMACKeys {
+		if id == "" || secret == "" {
+			return errors.New("HMAC key id and secret must not be empty")
+		}
+		hmacKeys[id] = secret
+	}
+	if _, exists := hmacKeys[DefaultKeyID]; !exists && k.legacyKey != "" {
+		hmacKeys[DefaultKeyID] = k.legacyKey
+	}
+
+	defaultHMACKey := file.DefaultHMACKey
+	if defaultHMACKey == "" {
+		defaultHMACKey = DefaultKeyID
+	}
+	if _, exists := hmacKeys[defaultHMACKey]; !exists && len(hmacKeys) > 0 {
+		return fmt.Errorf("default HMAC key %q is not defined", defaultHMACKey)
+	}
+
+	var privateKeys []privateKey
+	seen := map[string]bool{}
+	for _, path := range append([]string{k.legacyKeyPath}, file.PrivateKeys...) {
+		if path == "" {
+			continue
+		}
+		key, err := crypto.LoadPrivateKey(path)
+		if err != nil {
+			return fmt.Errorf("failed to load private key %s: %w", path, err)
+		}
+		id := crypto.KeyID(&key.PublicKey)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		privateKeys = append(privateKeys, privateKey{id: id, key: key})
+	}
+
+	k.mu.Lock()
+	k.defaultHMACKey = defaultHMACKey
+	k.hmacKeys = hmacKeys
+	k.privateKeys = privateKeys
+	k.mu.Unlock()
+
+	zap.L().Info("Keyring loaded",
+		zap.String("path", k.path),
+		zap.String("hash_alg", k.hashAlg),
+		zap.String("default_hmac_key", defaultHMACKey),
+		zap.Strings("hmac_keys", sortedIDs(hmacKeys)),
+		zap.Strings("private_keys", privateKeyIDs(privateKeys)))
+	return nil
+}
+
+// HMACEnabled сообщает, настроен ли хотя бы один секрет HMAC
+func (k *Keyring) HMACEnabled() bool {
+	if k == nil {
+		return false
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.hmacKeys) > 0
+}
+
+// DecryptionEnabled сообщает, настроен ли хотя бы один приватный ключ
+func (k *Keyring) DecryptionEnabled() bool {
+	if k == nil {
+		return false
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.privateKeys) > 0
+}
+
+// VerifyHMAC проверяет подпись mac для данных data алгоритмом alg и возвращает
+// идентификатор подошедшего секрета. Пустой alg означает алгоритм, заданный при создании
+// набора, неизвестный алгоритм отклоняется с hasher.ErrUnknownAlgorithm.
+// Если keyID называет известный секрет, проверяется только он. Иначе проверяется
+// секрет по умолчанию, а затем остальные, чтобы агенты без идентификатора
+// продолжали работать во время смены ключей.
+func (k *Keyring) VerifyHMAC(keyID, alg string, data, mac []byte) (string, error) {
+	if k == nil {
+		return "", ErrNoHMACKeys
+	}
+
+	if alg == "" {
+		alg = k.hashAlg
+	}
+	h, err := hasher.InitHasher(alg)
+	if err != nil {
+		return "", err
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.hmacKeys) == 0 {
+		return "", ErrNoHMACKeys
+	}
+
+	var candidates []string
+	if _, known := k.hmacKeys[keyID]; known {
+		candidates = []string{keyID}
+	} else {
+		if keyID != "" {
+			zap.L().Warn("Unknown HMAC key id, falling back to configured keys",
+				zap.String("key_id", keyID))
+		}
+		candidates = []string{k.defaultHMACKey}
+		for _, id := range sortedIDs(k.hmacKeys) {
+			if id != k.defaultHMACKey {
+				candidates = append(candidates, id)
+			}
+		}
+	}
+
+	for _, id := range candidates {
+		expected, err := h.CalculateHash(data, []byte(k.hmacKeys[id]))
+		if err != nil {
+			return "", fmt.Errorf("failed to calculate hash: %w", err)
+		}
+		if hmac.Equal(expected, mac) {
+			return id, nil
+		}
+	}
+	return "", ErrSignatureMismatch
+}
+
+// Decrypt расшифровывает данные. Для конверта версии 2 используется ключ с
+// идентификатором из конверта, для старых форматов ключи перебираются по очереди.
+func (k *Keyring) Decrypt(data []byte) ([]byte, error) {
+	if k == nil {
+		return nil, ErrNoPrivateKeys
+	}
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.privateKeys) == 0 {
+		return nil, ErrNoPrivateKeys
+	}
+
+	if keyID, err := crypto.EnvelopeKeyID(data); err == nil {
+		for _, pk := range k.privateKeys {
+			if pk.id == keyID {
+				return crypto.Decrypt(pk.key, data)
+			}
+		}
+		// Данные старого формата тоже могут начинаться с байта версии конверта
+		zap.L().Debug("Envelope key id not found in keyring", zap.String("key_id", keyID))
+	}
+
+	var lastErr error
+	for _, pk := range k.privateKeys {
+		decrypted, err := crypto.Decrypt(pk.key, data)
+		if err == nil {
+			return decrypted, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func sortedIDs(keys map[string]string) []string {
+	ids := make([]string, 0, len(keys))
+	for id := range keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func privateKeyIDs(keys []privateKey) []string {
+	ids := make([]string, 0, len(keys))
+	for _, pk := range keys {
+		ids = append(ids, pk.id)
+	}
+	return ids
+}
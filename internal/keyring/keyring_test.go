@@ -0,0 +1,206 @@
+package keyring
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MPoline/alert_service_yp/internal/crypto"
+	"github.com/MPoline/alert_service_yp/internal/hasher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sign(secret string, data []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func writePrivateKey(t *testing.T, dir, name string) (string, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path, key
+}
+
+func writeKeyringFile(t *testing.T, path string, file File) {
+	t.Helper()
+
+	data, err := json.Marshal(file)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+}
+
+func TestVerifyHMAC(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	writeKeyringFile(t, path, File{
+		DefaultHMACKey: "new",
+		HMACKeys:       map[string]string{"new": "new-secret", "old": "old-secret"},
+	})
+
+	keys, err := New(path, "legacy-secret", "", "")
+	require.NoError(t, err)
+
+	data := []byte(`{"id":"Alloc"}`)
+
+	tests := []struct {
+		name    string
+		keyID   string
+		secret  string
+		wantID  string
+		wantErr error
+	}{
+		{name: "named key", keyID: "old", secret: "old-secret", wantID: "old"},
+		{name: "default key without id", secret: "new-secret", wantID: "new"},
+		{name: "other key without id", secret: "old-secret", wantID: "old"},
+		{name: "legacy flag key", secret: "legacy-secret", wantID: DefaultKeyID},
+		{name: "unknown id falls back", keyID: "missing", secret: "old-secret", wantID: "old"},
+		{name: "named key does not fall back", keyID: "new", secret: "old-secret", wantErr: ErrSignatureMismatch},
+		{name: "unknown secret", secret: "wrong", wantErr: ErrSignatureMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := keys.VerifyHMAC(tt.keyID, "", data, sign(tt.secret, data))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantID, id)
+		})
+	}
+}
+
+func TestReloadRetiresKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	writeKeyringFile(t, path, File{
+		DefaultHMACKey: "new",
+		HMACKeys:       map[string]string{"new": "new-secret", "old": "old-secret"},
+	})
+
+	keys, err := New(path, "", "", "")
+	require.NoError(t, err)
+
+	data := []byte("payload")
+	_, err = keys.VerifyHMAC("old", "", data, sign("old-secret", data))
+	require.NoError(t, err)
+
+	writeKeyringFile(t, path, File{
+		DefaultHMACKey: "new",
+		HMACKeys:       map[string]string{"new": "new-secret"},
+	})
+	require.NoError(t, keys.Reload())
+
+	_, err = keys.VerifyHMAC("old", "", data, sign("old-secret", data))
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+
+	// Некорректный файл не сбрасывает загруженные ключи
+	writeKeyringFile(t, path, File{DefaultHMACKey: "missing", HMACKeys: map[string]string{"new": "new-secret"}})
+	assert.Error(t, keys.Reload())
+
+	_, err = keys.VerifyHMAC("new", "", data, sign("new-secret", data))
+	assert.NoError(t, err)
+}
+
+func TestDecrypt(t *testing.T) {
+	dir := t.TempDir()
+	legacyPath, legacyKey := writePrivateKey(t, dir, "legacy.pem")
+	newPath, newKey := writePrivateKey(t, dir, "new.pem")
+
+	path := filepath.Join(dir, "keyring.json")
+	writeKeyringFile(t, path, File{PrivateKeys: []string{newPath}})
+
+	keys, err := New(path, "", legacyPath, "")
+	require.NoError(t, err)
+	assert.True(t, keys.DecryptionEnabled())
+	assert.False(t, keys.HMACEnabled())
+
+	data := []byte(`{"metrics":[]}`)
+
+	for name, pub := range map[string]*rsa.PublicKey{"legacy": &legacyKey.PublicKey, "new": &newKey.PublicKey} {
+		t.Run(name+" envelope", func(t *testing.T) {
+			encrypted, err := crypto.EncryptEnvelope(pub, data)
+			require.NoError(t, err)
+
+			decrypted, err := keys.Decrypt(encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, data, decrypted)
+		})
+
+		t.Run(name+" chunk protocol", func(t *testing.T) {
+			encrypted, err := crypto.EncryptLargeData(pub, data)
+			require.NoError(t, err)
+
+			decrypted, err := keys.Decrypt(encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, data, decrypted)
+		})
+	}
+
+	t.Run("unknown key", func(t *testing.T) {
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+
+		encrypted, err := crypto.EncryptEnvelope(&other.PublicKey, data)
+		require.NoError(t, err)
+
+		_, err = keys.Decrypt(encrypted)
+		assert.Error(t, err)
+	})
+}
+
+func TestNilKeyring(t *testing.T) {
+	var keys *Keyring
+
+	assert.False(t, keys.HMACEnabled())
+	assert.False(t, keys.DecryptionEnabled())
+
+	_, err := keys.VerifyHMAC("", "", []byte("data"), nil)
+	assert.ErrorIs(t, err, ErrNoHMACKeys)
+
+	_, err = keys.Decrypt([]byte("data"))
+	assert.ErrorIs(t, err, ErrNoPrivateKeys)
+}
+
+func TestVerifyHMACAlgorithm(t *testing.T) {
+	keys, err := New("", "secret", "", hasher.SHA512)
+	require.NoError(t, err)
+
+	data := []byte("data")
+	sign := func(alg string) []byte {
+		h, err := hasher.InitHasher(alg)
+		require.NoError(t, err)
+		mac, err := h.CalculateHash(data, []byte("secret"))
+		require.NoError(t, err)
+		return mac
+	}
+
+	_, err = keys.VerifyHMAC("", "", data, sign(hasher.SHA512))
+	assert.NoError(t, err, "default algorithm comes from the keyring")
+
+	_, err = keys.VerifyHMAC("", hasher.BLAKE2b, data, sign(hasher.BLAKE2b))
+	assert.NoError(t, err, "algorithm requested by the client is used")
+
+	_, err = keys.VerifyHMAC("", hasher.SHA256, data, sign(hasher.SHA512))
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+
+	_, err = keys.VerifyHMAC("", "md5", data, sign(hasher.SHA256))
+	assert.ErrorIs(t, err, hasher.ErrUnknownAlgorithm)
+
+	_, err = New("", "secret", "", "crc32")
+	assert.ErrorIs(t, err, hasher.ErrUnknownAlgorithm)
+}
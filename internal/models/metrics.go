@@ -41,6 +41,14 @@ type Metrics struct {
 	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
 }
 
+// MetricUpdate - изменение метрики при записи: значение до записи и сохраненное значение.
+// Для counter New.Delta - накопленное значение, Old.Delta - накопленное значение до записи
+// (ноль для нового counter). Для gauge Old равен nil, если метрики не было.
+type MetricUpdate struct {
+	Old *Metrics
+	New Metrics
+}
+
 // Стандартные ошибки валидации метрик
 var (
 	// ErrInvalidMetricName возвращается при пустом имени метрики
@@ -0,0 +1,136 @@
+// Package netutil содержит наборы доверенных подсетей и определение IP адреса клиента
+// с учетом доверенных прокси.
+//
+// Заголовкам X-Forwarded-For и X-Real-IP доверяется только тогда, когда соединение
+// установлено с адреса доверенного прокси. В остальных случаях адресом клиента
+// считается адрес TCP соединения, поэтому клиент не может подменить свой IP заголовком.
+package netutil
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Заголовки HTTP и ключ метаданных gRPC с адресом клиента, выставляемые прокси
+const (
+	HeaderForwardedFor   = "X-Forwarded-For"
+	HeaderRealIP         = "X-Real-IP"
+	MetadataForwardedFor = "x-forwarded-for"
+)
+
+// IPSet - набор подсетей IPv4 и IPv6. Пустой набор не содержит ни одного адреса.
+type IPSet []*net.IPNet
+
+// ParseIPSet разбирает список подсетей в формате CIDR, перечисленных через запятую.
+// Отдельный адрес без маски означает подсеть из одного адреса.
+func ParseIPSet(list string) (IPSet, error) {
+	var set IPSet
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			set = append(set, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, subnet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", item, err)
+		}
+		set = append(set, subnet)
+	}
+	return set, nil
+}
+
+// Contains сообщает, входит ли адрес в одну из подсетей набора
+func (s IPSet) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, subnet := range s {
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Strings возвращает подсети набора в формате CIDR
+func (s IPSet) Strings() []string {
+	result := make([]string, 0, len(s))
+	for _, subnet := range s {
+		result = append(result, subnet.String())
+	}
+	return result
+}
+
+// String возвращает подсети набора через запятую
+func (s IPSet) String() string {
+	return strings.Join(s.Strings(), ",")
+}
+
+// ParseIP разбирает адрес, допуская порт и квадратные скобки IPv6: "10.0.0.1:8080", "[::1]:80"
+func ParseIP(value string) net.IP {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	return net.ParseIP(strings.Trim(value, "[]"))
+}
+
+// ClientIP определяет адрес клиента по адресу соединения remoteAddr. Если соединение
+// установлено доверенным прокси, адрес берется из цепочки forwardedFor (первый справа
+// адрес, не являющийся доверенным прокси), а при ее отсутствии - из realIP.
+func ClientIP(remoteAddr, forwardedFor, realIP string, proxies IPSet) net.IP {
+	peerIP := ParseIP(remoteAddr)
+	if peerIP == nil || !proxies.Contains(peerIP) {
+		return peerIP
+	}
+
+	if forwardedFor != "" {
+		client := peerIP
+		hops := strings.Split(forwardedFor, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := ParseIP(hops[i])
+			if ip == nil {
+				break
+			}
+			client = ip
+			if !proxies.Contains(ip) {
+				break
+			}
+		}
+		return client
+	}
+
+	if ip := ParseIP(realIP); ip != nil {
+		return ip
+	}
+	return peerIP
+}
+
+type clientIPKey struct{}
+
+// WithClientIP возвращает контекст с определенным адресом клиента
+func WithClientIP(ctx context.Context, ip net.IP) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext возвращает адрес клиента, сохраненный WithClientIP
+func ClientIPFromContext(ctx context.Context) net.IP {
+	ip, _ := ctx.Value(clientIPKey{}).(net.IP)
+	return ip
+}
@@ -0,0 +1,70 @@
+package netutil
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIPSet(t *testing.T) {
+	set, err := ParseIPSet("10.0.0.0/8, 192.168.1.5, fd00::/8, ::1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.5/32", "fd00::/8", "::1/128"}, set.Strings())
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"192.168.1.5", true},
+		{"192.168.1.6", false},
+		{"fd12:3456::1", true},
+		{"::1", true},
+		{"2001:db8::1", false},
+		{"::ffff:10.0.0.1", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, set.Contains(net.ParseIP(tt.ip)), tt.ip)
+	}
+
+	empty, err := ParseIPSet("")
+	require.NoError(t, err)
+	assert.False(t, empty.Contains(net.ParseIP("10.0.0.1")))
+
+	for _, invalid := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0.0/8,bad"} {
+		_, err := ParseIPSet(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseIPSet("10.0.0.0/8, fd00::/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		realIP       string
+		want         string
+	}{
+		{"direct client ignores headers", "203.0.113.7:5000", "198.51.100.1", "198.51.100.2", "203.0.113.7"},
+		{"proxy forwarded for", "10.0.0.1:5000", "198.51.100.1", "", "198.51.100.1"},
+		{"proxy chain skips trusted hops", "10.0.0.1:5000", "198.51.100.9, 198.51.100.1, 10.0.0.2", "", "198.51.100.1"},
+		{"all hops trusted", "10.0.0.1:5000", "10.0.0.3, 10.0.0.2", "", "10.0.0.3"},
+		{"malformed hop stops chain", "10.0.0.1:5000", "198.51.100.1, garbage", "", "10.0.0.1"},
+		{"proxy real ip", "10.0.0.1:5000", "", "198.51.100.3", "198.51.100.3"},
+		{"proxy without headers", "10.0.0.1:5000", "", "", "10.0.0.1"},
+		{"ipv6 proxy", "[fd00::1]:5000", "2001:db8::7", "", "2001:db8::7"},
+		{"ipv6 direct client", "[2001:db8::1]:5000", "198.51.100.1", "", "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ClientIP(tt.remoteAddr, tt.forwardedFor, tt.realIP, proxies)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package proto
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/MPoline/alert_service_yp/internal/hasher"
+	"github.com/MPoline/alert_service_yp/internal/replay"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// Ключи метаданных gRPC запросов
+const (
+	// MetadataRealIP - IP адрес агента, аналог заголовка X-Real-IP
+	MetadataRealIP = "x-real-ip"
+	// MetadataHash - HMAC подпись запроса в base64, аналог заголовка HashSHA256
+	MetadataHash = "hashsha256"
+	// MetadataKeyID - идентификатор секрета HMAC, аналог заголовка X-Key-Id
+	MetadataKeyID = "x-key-id"
+	// MetadataHashAlg - алгоритм подписи, аналог заголовка X-Hash-Alg
+	MetadataHashAlg = "x-hash-alg"
+	// MetadataRetryAfter - время в секундах до повтора запроса, отклоненного ограничением
+	// частоты, аналог заголовка Retry-After
+	MetadataRetryAfter = "retry-after"
+)
+
+// SignatureData возвращает детерминированное бинарное представление запроса,
+// по которому вычисляется подпись
+func SignatureData(msg protobuf.Message) ([]byte, error) {
+	data, err := protobuf.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return data, nil
+}
+
+// RequestSignature вычисляет подпись запроса алгоритмом alg по его детерминированному
+// бинарному представлению вместе со временем и nonce запроса
+func RequestSignature(msg protobuf.Message, key, alg, timestamp, nonce string) (string, error) {
+	data, err := SignatureData(msg)
+	if err != nil {
+		return "", err
+	}
+
+	h, err := hasher.InitHasher(alg)
+	if err != nil {
+		return "", err
+	}
+	hash, err := h.CalculateHash(replay.SignedData(timestamp, nonce, data), []byte(key))
+	if err != nil {
+		return "", fmt.Errorf("failed to calculate hash: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(hash), nil
+}
+
+// BatchSignatureData возвращает данные для подписи батча потока:
+// детерминированное представление батча с пустыми полями hash и signature
+func BatchSignatureData(batch *MetricsBatch) ([]byte, error) {
+	unsigned := protobuf.Clone(batch).(*MetricsBatch)
+	unsigned.Hash = ""
+	unsigned.Signature = nil
+	return SignatureData(unsigned)
+}
+
+// SignBatch подписывает батч потока ключом key алгоритмом alg.
+// Время и nonce батча должны быть заполнены до подписи.
+func SignBatch(batch *MetricsBatch, key, alg string) error {
+	h, err := hasher.InitHasher(alg)
+	if err != nil {
+		return err
+	}
+
+	data, err := BatchSignatureData(batch)
+	if err != nil {
+		return err
+	}
+
+	hash, err := h.CalculateHash(data, []byte(key))
+	if err != nil {
+		return fmt.Errorf("failed to calculate hash: %w", err)
+	}
+	batch.Hash = base64.StdEncoding.EncodeToString(hash)
+	return nil
+}
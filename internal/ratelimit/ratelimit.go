@@ -0,0 +1,115 @@
+// Package ratelimit реализует ограничение частоты запросов по алгоритму token bucket
+// отдельно для каждого клиента.
+//
+// Каждому клиенту (IP адресу или идентификатору агента) соответствует корзина
+// на burst токенов, которая пополняется со скоростью rate токенов в секунду.
+// Запрос забирает один токен; если корзина пуста, запрос отклоняется, а клиенту
+// сообщается, через сколько появится следующий токен.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// pruneInterval - период удаления корзин неактивных клиентов
+const pruneInterval = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter - ограничитель частоты запросов по клиентам. Методы безопасны для nil,
+// nil означает, что ограничение отключено.
+type Limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+// New создает ограничитель на rate запросов в секунду с запасом burst запросов.
+// rate не больше нуля отключает ограничение и возвращает nil.
+func New(rate float64, burst int) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Enabled сообщает, включено ли ограничение
+func (l *Limiter) Enabled() bool {
+	return l != nil
+}
+
+// Allow забирает токен из корзины клиента key. Если токенов нет, возвращает false
+// и время до появления следующего токена.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// prune удаляет корзины, которые успели заполниться полностью: для клиента
+// они неотличимы от новых
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < pruneInterval {
+		return
+	}
+	l.lastPrune = now
+
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// RetryAfter возвращает значение заголовка Retry-After в целых секундах, не меньше 1
+func RetryAfter(wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
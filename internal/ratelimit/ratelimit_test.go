@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := New(2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("agent-1")
+		assert.True(t, ok, "request %d within burst", i)
+	}
+
+	ok, wait := l.Allow("agent-1")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+	assert.Equal(t, 1, RetryAfter(wait))
+
+	// Другой клиент не зависит от исчерпанной корзины
+	ok, _ = l.Allow("agent-2")
+	assert.True(t, ok)
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("agent-1")
+	assert.True(t, ok, "token refilled after 1/rate seconds")
+
+	ok, _ = l.Allow("agent-1")
+	assert.False(t, ok)
+}
+
+func TestLimiterPrune(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := New(1, 5)
+	l.now = func() time.Time { return now }
+
+	l.Allow("idle")
+	now = now.Add(2 * pruneInterval)
+	l.Allow("active")
+
+	assert.NotContains(t, l.buckets, "idle")
+	assert.Contains(t, l.buckets, "active")
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	l := New(0, 10)
+	assert.False(t, l.Enabled())
+
+	ok, wait := l.Allow("any")
+	assert.True(t, ok)
+	assert.Zero(t, wait)
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 1, RetryAfter(0))
+	assert.Equal(t, 1, RetryAfter(time.Second))
+	assert.Equal(t, 3, RetryAfter(2100*time.Millisecond))
+}
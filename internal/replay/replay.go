@@ -0,0 +1,162 @@
+// Package replay защищает подписанные запросы от повторной отправки.
+//
+// Агент добавляет к каждому изменяющему запросу время отправки и случайный
+// nonce, которые входят в подписываемые данные. Сервер отклоняет запросы
+// со временем за пределами допустимого окна и запросы с уже встречавшимся nonce.
+// Nonce хранятся в ограниченном кеше, пока запрос с ними может пройти проверку времени.
+package replay
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Заголовки HTTP и ключи метаданных gRPC с временем и nonce запроса
+const (
+	HeaderTimestamp   = "X-Timestamp"
+	HeaderNonce       = "X-Nonce"
+	MetadataTimestamp = "x-timestamp"
+	MetadataNonce     = "x-nonce"
+)
+
+// maxNonceLength ограничивает размер nonce, хранимого в кеше
+const maxNonceLength = 128
+
+var (
+	// ErrMissing - в запросе нет времени или nonce
+	ErrMissing = errors.New("request timestamp or nonce is missing")
+	// ErrMalformed - время или nonce в неверном формате
+	ErrMalformed = errors.New("request timestamp or nonce is malformed")
+	// ErrExpired - время запроса вне допустимого окна
+	ErrExpired = errors.New("request timestamp is outside the allowed window")
+	// ErrReplayed - запрос с таким nonce уже был принят
+	ErrReplayed = errors.New("request nonce has already been used")
+	// ErrCacheFull - кеш nonce переполнен, запрос стоит повторить позже
+	ErrCacheFull = errors.New("nonce cache is full")
+)
+
+// NewNonce возвращает случайный nonce
+func NewNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Timestamp возвращает время в формате заголовка X-Timestamp (Unix секунды)
+func Timestamp(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// SignedData возвращает данные для подписи: время и nonce вместе с телом запроса.
+// Без времени и nonce подписывается только тело, как раньше.
+func SignedData(timestamp, nonce string, body []byte) []byte {
+	if timestamp == "" && nonce == "" {
+		return body
+	}
+
+	data := make([]byte, 0, len(timestamp)+len(nonce)+2+len(body))
+	data = append(data, timestamp...)
+	data = append(data, ':')
+	data = append(data, nonce...)
+	data = append(data, ':')
+	return append(data, body...)
+}
+
+// nonceEntry - nonce и момент, после которого его можно забыть
+type nonceEntry struct {
+	nonce   string
+	expires time.Time
+}
+
+// Guard проверяет время и nonce запросов. Nil означает, что защита отключена.
+type Guard struct {
+	window   time.Duration
+	capacity int
+	now      func() time.Time
+
+	mu    sync.Mutex
+	seen  map[string]struct{}
+	queue []nonceEntry
+	head  int
+}
+
+// NewGuard создает защиту с окном допустимого расхождения часов window
+// и кешем не более чем на capacity nonce. Окно не больше нуля отключает защиту.
+func NewGuard(window time.Duration, capacity int) *Guard {
+	if window <= 0 {
+		return nil
+	}
+	return &Guard{
+		window:   window,
+		capacity: capacity,
+		now:      time.Now,
+		seen:     make(map[string]struct{}),
+	}
+}
+
+// Enabled сообщает, включена ли защита
+func (g *Guard) Enabled() bool {
+	return g != nil
+}
+
+// Check проверяет время запроса timestamp (Unix секунды) и запоминает nonce.
+// Повторный nonce в пределах окна отклоняется.
+func (g *Guard) Check(timestamp, nonce string) error {
+	if g == nil {
+		return nil
+	}
+	if timestamp == "" || nonce == "" {
+		return ErrMissing
+	}
+	if len(nonce) > maxNonceLength {
+		return ErrMalformed
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	now := g.now()
+	skew := now.Sub(time.Unix(seconds, 0))
+	if skew > g.window || skew < -g.window {
+		return ErrExpired
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.evict(now)
+
+	if _, ok := g.seen[nonce]; ok {
+		return ErrReplayed
+	}
+	if len(g.seen) >= g.capacity {
+		return ErrCacheFull
+	}
+
+	// Запрос с этим nonce проходит проверку времени не дольше двух окон
+	// с момента получения, поэтому срок хранения растет в порядке очереди
+	g.seen[nonce] = struct{}{}
+	g.queue = append(g.queue, nonceEntry{nonce: nonce, expires: now.Add(2 * g.window)})
+	return nil
+}
+
+// evict удаляет nonce с истекшим сроком хранения
+func (g *Guard) evict(now time.Time) {
+	for g.head < len(g.queue) && !g.queue[g.head].expires.After(now) {
+		delete(g.seen, g.queue[g.head].nonce)
+		g.queue[g.head] = nonceEntry{}
+		g.head++
+	}
+
+	// Освобождаем место в начале очереди, когда его накопилось достаточно
+	if g.head > len(g.queue)/2 {
+		g.queue = append(g.queue[:0], g.queue[g.head:]...)
+		g.head = 0
+	}
+}
@@ -0,0 +1,91 @@
+package replay
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestGuard(window time.Duration, capacity int, now *time.Time) *Guard {
+	g := NewGuard(window, capacity)
+	g.now = func() time.Time { return *now }
+	return g
+}
+
+func TestGuardCheck(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	g := newTestGuard(time.Minute, 10, &now)
+
+	ts := func(d time.Duration) string {
+		return strconv.FormatInt(now.Add(d).Unix(), 10)
+	}
+
+	tests := []struct {
+		name      string
+		timestamp string
+		nonce     string
+		want      error
+	}{
+		{"fresh", ts(0), "a", nil},
+		{"duplicate", ts(0), "a", ErrReplayed},
+		{"small skew", ts(-30 * time.Second), "b", nil},
+		{"future skew", ts(30 * time.Second), "c", nil},
+		{"too old", ts(-2 * time.Minute), "d", ErrExpired},
+		{"too new", ts(2 * time.Minute), "e", ErrExpired},
+		{"missing nonce", ts(0), "", ErrMissing},
+		{"missing timestamp", "", "f", ErrMissing},
+		{"malformed timestamp", "yesterday", "g", ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := g.Check(tt.timestamp, tt.nonce); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestGuardEviction(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	g := newTestGuard(time.Minute, 2, &now)
+
+	for _, nonce := range []string{"a", "b"} {
+		if err := g.Check(Timestamp(now), nonce); err != nil {
+			t.Fatalf("nonce %s: %v", nonce, err)
+		}
+	}
+	if err := g.Check(Timestamp(now), "c"); !errors.Is(err, ErrCacheFull) {
+		t.Fatalf("expected ErrCacheFull, got %v", err)
+	}
+
+	// Через два окна запомненные nonce больше не нужны
+	now = now.Add(2 * time.Minute)
+	if err := g.Check(Timestamp(now), "c"); err != nil {
+		t.Fatalf("expected nonce accepted after eviction, got %v", err)
+	}
+	if err := g.Check(Timestamp(now), "a"); err != nil {
+		t.Fatalf("expected evicted nonce accepted with fresh timestamp, got %v", err)
+	}
+}
+
+func TestGuardDisabled(t *testing.T) {
+	g := NewGuard(0, 10)
+	if g.Enabled() {
+		t.Fatal("expected guard to be disabled")
+	}
+	if err := g.Check("", ""); err != nil {
+		t.Fatalf("disabled guard must accept any request, got %v", err)
+	}
+}
+
+func TestSignedData(t *testing.T) {
+	body := []byte("body")
+	if got := string(SignedData("", "", body)); got != "body" {
+		t.Errorf("expected plain body, got %q", got)
+	}
+	if got := string(SignedData("1", "n", body)); got != "1:n:body" {
+		t.Errorf("expected timestamp and nonce prefix, got %q", got)
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/MPoline/alert_service_yp/internal/apitoken"
 	"github.com/MPoline/alert_service_yp/internal/logging"
+	"github.com/MPoline/alert_service_yp/internal/netutil"
+	"github.com/MPoline/alert_service_yp/internal/ratelimit"
+	"github.com/MPoline/alert_service_yp/internal/server/flags"
 	"github.com/MPoline/alert_service_yp/internal/server/middlewares"
 	"github.com/MPoline/alert_service_yp/internal/server/services"
 	"github.com/gin-gonic/gin"
@@ -12,17 +16,36 @@ import (
 
 type API struct {
 	serviceHandler *services.ServiceHandler
+	tokens         *apitoken.Authenticator
+	trustedSubnets netutil.IPSet
+	trustedProxies netutil.IPSet
+	limiter        *ratelimit.Limiter
 }
 
-func NewAPI(serviceHandler *services.ServiceHandler) *API {
+// NewAPI создает API. Если tokens не nil, маршруты требуют токен с ролью:
+// чтение метрик и настроек агентов - read, изменение метрик - write, журнал аудита - admin.
+// Изменение метрик и журнал аудита доступны только клиентам из trustedSubnets, если они заданы.
+// Адрес клиента берется из заголовков прокси только для соединений от trustedProxies.
+// Если limiter не nil, частота запросов на изменение метрик ограничивается для каждого клиента.
+// Тело запроса распаковывается и расшифровывается только после проверки доступа
+// и ограничения частоты.
+func NewAPI(serviceHandler *services.ServiceHandler, tokens *apitoken.Authenticator, trustedSubnets, trustedProxies netutil.IPSet, limiter *ratelimit.Limiter) *API {
 	return &API{
 		serviceHandler: serviceHandler,
+		tokens:         tokens,
+		trustedSubnets: trustedSubnets,
+		trustedProxies: trustedProxies,
+		limiter:        limiter,
 	}
 }
 
 func (a *API) InitRouter() *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
+	// c.ClientIP() должен совпадать с адресом клиента, определенным ClientIPMiddleware
+	if err := router.SetTrustedProxies(a.trustedProxies.Strings()); err != nil {
+		fmt.Fprintln(os.Stderr, "Error setting trusted proxies:", err)
+	}
 
 	a.registerMiddlewares(router)
 	a.registerRoutes(router)
@@ -37,8 +60,8 @@ func (a *API) registerMiddlewares(r *gin.Engine) {
 	}
 	defer logger.Sync()
 
-	r.Use(middlewares.GZipDecompress())
-	r.Use(middlewares.DecryptMiddleware())
+	r.Use(middlewares.ClientIPMiddleware(a.trustedProxies))
+	r.Use(middlewares.BodyLimitMiddleware(flags.FlagMaxBodySize))
 	r.Use(middlewares.GZipCompress())
 	r.Use(middlewares.RequestLogger(logger))
 	r.Use(middlewares.ResponseLogger(logger))
@@ -46,15 +69,50 @@ func (a *API) registerMiddlewares(r *gin.Engine) {
 
 func (a *API) registerRoutes(r *gin.Engine) {
 	r.GET("/ping", a.serviceHandler.CheckDBConnection)
-	r.GET("/", a.serviceHandler.GetAllMetrics)
-	r.GET("/value/", a.serviceHandler.GetMetricFromJSON)
-	r.GET("/value/:type/:name", a.serviceHandler.GetMetricFromURL)
+
+	readGroup := r.Group("/")
+	readGroup.Use(middlewares.TokenAuthMiddleware(a.tokens, apitoken.RoleRead))
+	readGroup.Use(a.bodyDecoders()...)
+	{
+		readGroup.GET("/", a.serviceHandler.GetAllMetrics)
+		readGroup.GET("/value/", a.serviceHandler.GetMetricFromJSON)
+		readGroup.GET("/value/:type/:name", a.serviceHandler.GetMetricFromURL)
+		readGroup.GET("/api/v1/agent-config", a.serviceHandler.GetAgentConfig)
+	}
 
 	updateGroup := r.Group("/")
-	updateGroup.Use(middlewares.TrustedSubnetMiddleware())
+	updateGroup.Use(middlewares.TrustedSubnetMiddleware(a.trustedSubnets))
+	updateGroup.Use(middlewares.TokenAuthMiddleware(a.tokens, apitoken.RoleWrite))
+	updateGroup.Use(middlewares.RateLimitMiddleware(a.limiter, a.rateLimitKey()))
+	updateGroup.Use(a.bodyDecoders()...)
 	{
 		updateGroup.POST("/update/", a.serviceHandler.UpdateMetricFromJSON)
 		updateGroup.POST("/updates/", a.serviceHandler.UpdateSliceOfMetrics)
 		updateGroup.POST("/update/:type/:name/:value", a.serviceHandler.UpdateMetricFromURL)
 	}
+
+	adminGroup := r.Group("/api/v1")
+	adminGroup.Use(middlewares.TrustedSubnetMiddleware(a.trustedSubnets))
+	adminGroup.Use(middlewares.TokenAuthMiddleware(a.tokens, apitoken.RoleAdmin))
+	{
+		adminGroup.GET("/audit", a.serviceHandler.GetAuditLog)
+	}
+}
+
+// bodyDecoders возвращает middleware распаковки и расшифровки тела запроса.
+// Подключаются в группах маршрутов после проверки доступа, чтобы отклоняемые
+// запросы не расходовали ресурсы на распаковку и расшифровку.
+func (a *API) bodyDecoders() []gin.HandlerFunc {
+	return []gin.HandlerFunc{
+		middlewares.GZipDecompress(flags.FlagMaxDecompressedSize),
+		middlewares.DecryptMiddleware(a.serviceHandler.Keys()),
+	}
+}
+
+// rateLimitKey возвращает способ различения клиентов для ограничения частоты запросов
+func (a *API) rateLimitKey() middlewares.RateLimitKeyFunc {
+	if flags.FlagRateLimitKey == flags.RateLimitKeyAgent {
+		return middlewares.RateLimitByToken
+	}
+	return middlewares.RateLimitByIP
 }
@@ -0,0 +1,57 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MPoline/alert_service_yp/internal/apitoken"
+	"github.com/MPoline/alert_service_yp/internal/config"
+	"github.com/MPoline/alert_service_yp/internal/ratelimit"
+	"github.com/MPoline/alert_service_yp/internal/server/api"
+	"github.com/MPoline/alert_service_yp/internal/server/services"
+	"github.com/MPoline/alert_service_yp/internal/storage"
+)
+
+func TestBodyDecodedAfterAuthAndRateLimit(t *testing.T) {
+	tokens, err := apitoken.New([]config.APIToken{
+		{Name: "agent", Role: "write", Hash: apitoken.HashToken("secret")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := services.NewServiceHandler(storage.NewMemStorage(), nil, nil, nil, nil, nil)
+	router := api.NewAPI(handler, tokens, nil, nil, ratelimit.New(0.001, 1)).InitRouter()
+
+	// Тело не является gzip: ошибку распаковки возвращает только запрос,
+	// прошедший проверку токена и ограничение частоты
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"unauthenticated request is rejected before decoding", "", http.StatusUnauthorized},
+		{"authorized request is decoded", "secret", http.StatusBadRequest},
+		{"rate limited request is rejected before decoding", "secret", http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader("not gzip"))
+			req.RemoteAddr = "10.0.0.1:5000"
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", "gzip")
+			if tt.token != "" {
+				req.Header.Set("Authorization", apitoken.Bearer(tt.token))
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -1,11 +1,11 @@
 // Package database предоставляет функциональность для работы с PostgreSQL:
 // - Установка соединения с БД
-// - Создание и управление структурой таблиц
+// - Создание и управление структурой таблиц через встроенные версионные миграции
 // - CRUD операции с метриками
 // - Транзакционная обработка данных
 //
-// Пакет использует драйвер github.com/lib/pq и поддерживает:
-// - Обработку ошибок PostgreSQL
+// Пакет использует драйвер github.com/jackc/pgx/v5 с настраиваемым пулом соединений и поддерживает:
+// - Обработку ошибок PostgreSQL и повтор запросов после временных ошибок
 // - Логирование операций через zap
 package database
 
@@ -13,26 +13,34 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"sort"
+	"time"
 
 	"github.com/MPoline/alert_service_yp/internal/models"
 	"github.com/MPoline/alert_service_yp/internal/server/flags"
-	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
 
 	"go.uber.org/zap"
 )
 
-// SQL запрос для вставки или обновления метрики
+// SQL запрос для вставки или обновления метрики. Значение counter увеличивается
+// на переданную дельту в самом запросе, поэтому одновременные обновления
+// не теряют приращений. Возвращает накопленное значение counter.
 var createOrUpdateQuery = `INSERT INTO metrics 
 	(id, m_type, delta, value)
 	VALUES ($1, $2, $3, $4)
 	ON CONFLICT (id, m_type)
-	DO UPDATE SET delta = EXCLUDED.delta, value = EXCLUDED.value;`
+	DO UPDATE SET delta = COALESCE(metrics.delta, 0) + EXCLUDED.delta, value = EXCLUDED.value
+	RETURNING delta;`
 
-// OpenDBConnection устанавливает соединение с PostgreSQL.
+// OpenDBConnection создает пул соединений с PostgreSQL через драйвер pgx.
 //
-// Использует DSN из flags.FlagDatabaseDSN.
+// Использует DSN из flags.FlagDatabaseDSN, размер пула и время жизни соединений
+// из флагов -db-max-conns, -db-max-idle-conns, -db-conn-max-lifetime и -db-conn-max-idle-time.
+// Соединения устанавливаются при первом запросе.
 // Возвращает:
 //   - *sql.DB: объект соединения с БД
 //   - error: ошибка соединения
@@ -45,12 +53,21 @@ var createOrUpdateQuery = `INSERT INTO metrics
 //	}
 //	defer database.CloseDBConnection(db)
 func OpenDBConnection() (db *sql.DB, err error) {
-	db, err = sql.Open("postgres", flags.FlagDatabaseDSN)
+	connConfig, err := pgx.ParseConfig(flags.FlagDatabaseDSN)
 	if err != nil {
 		zap.L().Error("Error opening database: ", zap.Error(err))
 		return
 	}
-	zap.L().Info("Successful open to the database")
+
+	db = stdlib.OpenDB(*connConfig)
+	db.SetMaxOpenConns(int(flags.FlagDBMaxConns))
+	db.SetMaxIdleConns(int(flags.FlagDBMaxIdleConns))
+	db.SetConnMaxLifetime(time.Duration(flags.FlagDBConnMaxLifetime) * time.Second)
+	db.SetConnMaxIdleTime(time.Duration(flags.FlagDBConnMaxIdleTime) * time.Second)
+
+	zap.L().Info("Successful open to the database",
+		zap.Int64("max_conns", flags.FlagDBMaxConns),
+		zap.Int64("max_idle_conns", flags.FlagDBMaxIdleConns))
 	return
 }
 
@@ -64,32 +81,9 @@ func CloseDBConnection(db *sql.DB) {
 	}
 }
 
-// CreateMetricsTable создает таблицу metrics если она не существует.
-// Параметры:
-//   - ctx context.Context: контекст выполнения
-//   - db *sql.DB: соединение с БД
-//
-// Возвращает:
-//   - error: ошибка выполнения запроса
-func CreateMetricsTable(ctx context.Context, db *sql.DB) error {
-	createQuery := `CREATE TABLE IF NOT EXISTS metrics ( 
-		id TEXT, 
-		m_type TEXT CHECK(m_type IN ('gauge', 'counter')), 
-		delta BIGINT, 
-		value DOUBLE PRECISION,
-		PRIMARY KEY (id, m_type)
-	);`
-
-	_, err := db.ExecContext(ctx, createQuery)
-	if err != nil {
-		handlePGError(err)
-		return err
-	}
-	zap.L().Info("Table metrics is exist")
-	return nil
-}
-
 // CreateOrUpdateMetric создает или обновляет метрику в БД.
+// Дельта counter прибавляется к сохраненному значению атомарно,
+// после записи metric.Delta содержит накопленное значение.
 // Параметры:
 //   - ctx context.Context: контекст выполнения
 //   - db *sql.DB: соединение с БД
@@ -98,16 +92,27 @@ func CreateMetricsTable(ctx context.Context, db *sql.DB) error {
 // Возвращает:
 //   - error: ошибка выполнения операции
 func CreateOrUpdateMetric(ctx context.Context, db *sql.DB, metric models.Metrics) error {
-	_, err := db.ExecContext(ctx, createOrUpdateQuery, metric.ID, metric.MType, metric.Delta, metric.Value)
+	var total sql.NullInt64
+	// Приращение counter вне транзакции повторяется, только если запрос не был выполнен
+	err := withWriteRetry(ctx, func(ctx context.Context) (err error) {
+		total, err = upsertMetric(ctx, db, metric)
+		return err
+	})
 	if err != nil {
 		handlePGError(err)
 		return err
 	}
+	if metric.Delta != nil && total.Valid {
+		*metric.Delta = total.Int64
+	}
 	zap.L().Info("Metric created/updated in metrics table")
 	return nil
 }
 
 // CreateOrUpdateSliceOfMetrics создает или обновляет несколько метрик в транзакции.
+// Повторы одной метрики в батче предварительно объединяются: дельты counter
+// складываются, для gauge берется последнее значение. После записи Delta каждого
+// counter в metrics содержит накопленное значение.
 // Параметры:
 //   - ctx context.Context: контекст выполнения
 //   - db *sql.DB: соединение с БД
@@ -116,21 +121,189 @@ func CreateOrUpdateMetric(ctx context.Context, db *sql.DB, metric models.Metrics
 // Возвращает:
 //   - error: ошибка выполнения операции
 func CreateOrUpdateSliceOfMetrics(ctx context.Context, db *sql.DB, metrics models.SliceMetrics) error {
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
+	if _, err := applyMerged(ctx, db, metrics.Metrics, false); err != nil {
 		return err
 	}
+	zap.L().Info("Metric created/updated within transaction")
+	return nil
+}
+
+// ApplyMetrics записывает метрики как CreateOrUpdateSliceOfMetrics и возвращает
+// изменение каждой метрики в порядке MergeMetrics. Прежние значения gauge читаются
+// в той же транзакции с блокировкой строк до записи, прежнее значение counter
+// равно накопленному значению минус записанная дельта.
+func ApplyMetrics(ctx context.Context, db *sql.DB, metrics []models.Metrics) ([]models.MetricUpdate, error) {
+	updates, err := applyMerged(ctx, db, metrics, true)
+	if err != nil {
+		return nil, err
+	}
+	zap.L().Info("Metric created/updated within transaction")
+	return updates, nil
+}
+
+// lockGaugesQuery блокирует строки gauge батча до записи и возвращает их значения.
+// Строки блокируются в порядке имен, как и при записи объединенных метрик.
+const lockGaugesQuery = `SELECT id, value FROM metrics
+	WHERE m_type = 'gauge' AND id = ANY($1)
+	ORDER BY id
+	FOR UPDATE`
+
+// applyMerged объединяет повторы метрик и записывает их в одной транзакции.
+// Если readOld установлен, прежние значения gauge читаются в транзакции до записи.
+// После записи Delta каждого counter в metrics содержит накопленное значение.
+func applyMerged(ctx context.Context, db *sql.DB, metrics []models.Metrics, readOld bool) ([]models.MetricUpdate, error) {
+	merged := MergeMetrics(metrics)
+
+	var gaugeIDs []string
+	if readOld {
+		for _, metric := range merged {
+			if metric.MType == "gauge" {
+				gaugeIDs = append(gaugeIDs, metric.ID)
+			}
+		}
+	}
 
-	for _, metric := range metrics.Metrics {
-		_, err := tx.ExecContext(ctx, createOrUpdateQuery, metric.ID, metric.MType, metric.Delta, metric.Value)
+	// Транзакция повторяется целиком: после отката ни одно приращение не применено.
+	// После ошибки фиксации транзакция повторяется, только если фиксация не была отправлена.
+	var updates []models.MetricUpdate
+	err := WithRetry(ctx, func(ctx context.Context) error {
+		updates = make([]models.MetricUpdate, 0, len(merged))
+
+		tx, err := db.BeginTx(ctx, nil)
 		if err != nil {
-			handlePGError(err)
-			tx.Rollback()
 			return err
 		}
+
+		var oldGauges map[string]float64
+		if len(gaugeIDs) > 0 {
+			if oldGauges, err = lockGauges(ctx, tx, gaugeIDs); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+
+		for _, metric := range merged {
+			total, err := upsertMetric(ctx, tx, metric)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+			updates = append(updates, metricUpdate(metric, total, oldGauges))
+		}
+		return commit(tx)
+	})
+	if err != nil {
+		handlePGError(err)
+		return nil, err
 	}
-	zap.L().Info("Metric created/updated within transaction")
-	return tx.Commit()
+
+	totals := make(map[metricKey]int64, len(updates))
+	for _, update := range updates {
+		if update.New.Delta != nil {
+			totals[metricKey{update.New.MType, update.New.ID}] = *update.New.Delta
+		}
+	}
+	for _, metric := range metrics {
+		if total, ok := totals[metricKey{metric.MType, metric.ID}]; ok && metric.Delta != nil {
+			*metric.Delta = total
+		}
+	}
+	return updates, nil
+}
+
+// lockGauges блокирует строки gauge с именами ids и возвращает их значения
+func lockGauges(ctx context.Context, tx *sql.Tx, ids []string) (map[string]float64, error) {
+	rows, err := tx.QueryContext(ctx, lockGaugesQuery, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string]float64, len(ids))
+	for rows.Next() {
+		var id string
+		var value sql.NullFloat64
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, err
+		}
+		if value.Valid {
+			values[id] = value.Float64
+		}
+	}
+	return values, rows.Err()
+}
+
+// metricUpdate составляет изменение записанной метрики по накопленному значению
+// counter и прежним значениям gauge
+func metricUpdate(metric models.Metrics, total sql.NullInt64, oldGauges map[string]float64) models.MetricUpdate {
+	update := models.MetricUpdate{New: models.Metrics{ID: metric.ID, MType: metric.MType}}
+	switch metric.MType {
+	case "gauge":
+		value := *metric.Value
+		update.New.Value = &value
+		if old, ok := oldGauges[metric.ID]; ok {
+			update.Old = &models.Metrics{ID: metric.ID, MType: metric.MType, Value: &old}
+		}
+	case "counter":
+		newTotal, oldTotal := total.Int64, total.Int64-*metric.Delta
+		update.New.Delta = &newTotal
+		update.Old = &models.Metrics{ID: metric.ID, MType: metric.MType, Delta: &oldTotal}
+	}
+	return update
+}
+
+type metricKey struct{ mtype, id string }
+
+// MergeMetrics объединяет повторы метрик: дельты counter складываются, для gauge
+// остается последнее значение. Результат упорядочен по типу и имени, чтобы
+// одновременные транзакции блокировали строки в одном порядке и не взаимоблокировались.
+// Исходные метрики не изменяются.
+func MergeMetrics(metrics []models.Metrics) []models.Metrics {
+	index := make(map[metricKey]int, len(metrics))
+	merged := make([]models.Metrics, 0, len(metrics))
+
+	for _, metric := range metrics {
+		key := metricKey{metric.MType, metric.ID}
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(merged)
+			merged = append(merged, models.Metrics{ID: metric.ID, MType: metric.MType})
+			i = len(merged) - 1
+		}
+
+		if metric.Value != nil {
+			value := *metric.Value
+			merged[i].Value = &value
+		}
+		if metric.Delta != nil {
+			delta := *metric.Delta
+			if merged[i].Delta != nil {
+				delta += *merged[i].Delta
+			}
+			merged[i].Delta = &delta
+		}
+	}
+
+	sort.Slice(merged, func(a, b int) bool {
+		if merged[a].MType != merged[b].MType {
+			return merged[a].MType < merged[b].MType
+		}
+		return merged[a].ID < merged[b].ID
+	})
+	return merged
+}
+
+// queryRower - соединение или транзакция, выполняющие запрос с одной строкой результата
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// upsertMetric записывает метрику и возвращает накопленное значение counter.
+// Метрика не изменяется, поэтому запись можно повторить.
+func upsertMetric(ctx context.Context, q queryRower, metric models.Metrics) (sql.NullInt64, error) {
+	var total sql.NullInt64
+	err := q.QueryRowContext(ctx, createOrUpdateQuery, metric.ID, metric.MType, metric.Delta, metric.Value).Scan(&total)
+	return total, err
 }
 
 // GetAllMetricsFromDB возвращает все метрики из БД.
@@ -144,24 +317,25 @@ func CreateOrUpdateSliceOfMetrics(ctx context.Context, db *sql.DB, metrics model
 func GetAllMetricsFromDB(ctx context.Context, db *sql.DB) ([]models.Metrics, error) {
 	var metrics []models.Metrics
 
-	rows, err := db.QueryContext(ctx, `SELECT id, m_type, delta, value FROM metrics`)
-	if err != nil {
-		handlePGError(err)
-		return nil, err
-	}
-	defer rows.Close()
+	err := WithRetry(ctx, func(ctx context.Context) error {
+		metrics = nil
 
-	for rows.Next() {
-		var metric models.Metrics
-		err := rows.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value)
+		rows, err := db.QueryContext(ctx, `SELECT id, m_type, delta, value FROM metrics`)
 		if err != nil {
-			handlePGError(err)
-			return nil, err
+			return err
 		}
-		metrics = append(metrics, metric)
-	}
+		defer rows.Close()
 
-	if err := rows.Err(); err != nil {
+		for rows.Next() {
+			var metric models.Metrics
+			if err := rows.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value); err != nil {
+				return err
+			}
+			metrics = append(metrics, metric)
+		}
+		return rows.Err()
+	})
+	if err != nil {
 		handlePGError(err)
 		return nil, err
 	}
@@ -181,10 +355,11 @@ func GetAllMetricsFromDB(ctx context.Context, db *sql.DB) ([]models.Metrics, err
 func GetOneMetric(ctx context.Context, db *sql.DB, id string, mType string) (models.Metrics, error) {
 	var metric models.Metrics
 
-	row := db.QueryRowContext(ctx, `SELECT id, m_type, delta, value FROM metrics WHERE id=$1 AND m_type=$2`,
-		id, mType)
-
-	err := row.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value)
+	err := WithRetry(ctx, func(ctx context.Context) error {
+		row := db.QueryRowContext(ctx, `SELECT id, m_type, delta, value FROM metrics WHERE id=$1 AND m_type=$2`,
+			id, mType)
+		return row.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value)
+	})
 	if err == sql.ErrNoRows {
 		err = errors.New("MetricNotFound")
 		zap.L().Info("Metric not found")
@@ -198,12 +373,20 @@ func GetOneMetric(ctx context.Context, db *sql.DB, id string, mType string) (mod
 
 // handlePGError обрабатывает и логирует ошибки PostgreSQL.
 // Различает различные типы ошибок БД:
+//   - Временные ошибки (см. IsRetryable), оставшиеся после повторов или не повторенные,
+//     так как запись могла быть применена
 //   - Нарушение уникальности
 //   - Нарушение внешнего ключа
 //   - Нарушение проверочного ограничения
 //   - Нарушение NOT NULL
 func handlePGError(err error) {
-	if pgErr, ok := err.(*pgconn.PgError); ok {
+	if IsRetryable(err) {
+		zap.L().Error("PostgreSQL is unavailable or the transaction conflicted", zap.Error(err))
+		return
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
 		switch pgErr.Code {
 		case pgerrcode.UniqueViolation:
 			zap.L().Warn("PostgreSQL unique constraint violation",
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/MPoline/alert_service_yp/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeMetrics(t *testing.T) {
+	delta := func(d int64) *int64 { return &d }
+	value := func(v float64) *float64 { return &v }
+
+	first := delta(1)
+	metrics := []models.Metrics{
+		{ID: "PollCount", MType: "counter", Delta: first},
+		{ID: "Alloc", MType: "gauge", Value: value(1.5)},
+		{ID: "PollCount", MType: "counter", Delta: delta(2)},
+		{ID: "Alloc", MType: "gauge", Value: value(2.5)},
+		{ID: "Frees", MType: "counter", Delta: delta(7)},
+	}
+
+	merged := MergeMetrics(metrics)
+	require.Len(t, merged, 3)
+
+	// Метрики упорядочены по типу и имени
+	assert.Equal(t, "Frees", merged[0].ID)
+	assert.Equal(t, int64(7), *merged[0].Delta)
+	assert.Equal(t, "PollCount", merged[1].ID)
+	assert.Equal(t, int64(3), *merged[1].Delta)
+	assert.Equal(t, "Alloc", merged[2].ID)
+	assert.Equal(t, 2.5, *merged[2].Value)
+
+	assert.Equal(t, int64(1), *first, "source metrics are not modified")
+}
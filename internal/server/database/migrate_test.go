@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	assert.Equal(t, int64(1), migrations[0].Version)
+	assert.Equal(t, "create_metrics", migrations[0].Name)
+	for i, m := range migrations {
+		assert.NotEmpty(t, m.Up, m.Name)
+		assert.NotEmpty(t, m.Down, m.Name)
+		if i > 0 {
+			assert.Greater(t, m.Version, migrations[i-1].Version, "migrations are ordered by version")
+		}
+	}
+}
+
+// TestMigrateUpDown требует PostgreSQL: строка подключения задается переменной
+// окружения TEST_DATABASE_DSN, без нее тест пропускается. Тест откатывает
+// последнюю миграцию и применяет ее снова.
+func TestMigrateUpDown(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	db, err := sql.Open("pgx", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	migrations, err := LoadMigrations()
+	require.NoError(t, err)
+
+	// Одновременный запуск не применяет миграции дважды
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := MigrateUp(ctx, db)
+			errs <- err
+		}()
+	}
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+
+	statuses, err := MigrationsStatus(ctx, db)
+	require.NoError(t, err)
+	require.Len(t, statuses, len(migrations))
+	for _, s := range statuses {
+		assert.True(t, s.Applied, s.Name)
+	}
+
+	reverted, err := MigrateDown(ctx, db, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reverted)
+
+	statuses, err = MigrationsStatus(ctx, db)
+	require.NoError(t, err)
+	assert.False(t, statuses[len(statuses)-1].Applied)
+
+	applied, err := MigrateUp(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, 1, applied)
+}
+
+// TestMigrationsStatusReadOnly проверяет, что статус миграций пустой базы не создает
+// таблицу schema_migrations. Требует PostgreSQL, как и TestMigrateUpDown: тест
+// работает в отдельной схеме и удаляет ее.
+func TestMigrationsStatusReadOnly(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	ctx := context.Background()
+	admin, err := sql.Open("pgx", dsn)
+	require.NoError(t, err)
+	defer admin.Close()
+
+	schema := fmt.Sprintf("status_test_%d", time.Now().UnixNano())
+	_, err = admin.ExecContext(ctx, `CREATE SCHEMA `+schema)
+	require.NoError(t, err)
+	defer admin.ExecContext(ctx, `DROP SCHEMA `+schema+` CASCADE`)
+
+	config, err := pgx.ParseConfig(dsn)
+	require.NoError(t, err)
+	config.RuntimeParams["search_path"] = schema
+	db := stdlib.OpenDB(*config)
+	defer db.Close()
+
+	statuses, err := MigrationsStatus(ctx, db)
+	require.NoError(t, err)
+	require.NotEmpty(t, statuses)
+	for _, s := range statuses {
+		assert.False(t, s.Applied, s.Name)
+	}
+
+	var table sql.NullString
+	require.NoError(t, db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations')::text`).Scan(&table))
+	assert.False(t, table.Valid, "status must not create schema_migrations")
+}
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS metrics (
+	id TEXT,
+	m_type TEXT CHECK(m_type IN ('gauge', 'counter')),
+	delta BIGINT,
+	value DOUBLE PRECISION,
+	PRIMARY KEY (id, m_type)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	ts TIMESTAMPTZ NOT NULL,
+	ip TEXT NOT NULL DEFAULT '',
+	agent_id TEXT NOT NULL DEFAULT '',
+	token TEXT NOT NULL DEFAULT '',
+	transport TEXT NOT NULL DEFAULT '',
+	metrics JSONB NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_ts_idx ON audit_log (ts);
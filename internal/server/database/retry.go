@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/server/flags"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// retryDelays - задержки перед повторами запроса; после последней задержки
+// повторы продолжаются с ней же
+var retryDelays = []time.Duration{time.Second, 3 * time.Second, 5 * time.Second}
+
+// IsRetryable определяет, является ли ошибка базы данных временной.
+//
+// Временные ошибки:
+//   - класс 08 (connection exception) и отказ в соединении
+//   - serialization_failure и deadlock_detected: транзакцию можно выполнить заново
+//   - too_many_connections, admin_shutdown и cannot_connect_now при перезапуске сервера БД
+//   - сетевые ошибки и запросы, не отправленные на сервер
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if pgerrcode.IsConnectionException(pgErr.Code) {
+			return true
+		}
+		switch pgErr.Code {
+		case pgerrcode.SerializationFailure,
+			pgerrcode.DeadlockDetected,
+			pgerrcode.TooManyConnections,
+			pgerrcode.AdminShutdown,
+			pgerrcode.CannotConnectNow:
+			return true
+		}
+		return false
+	}
+
+	if pgconn.SafeToRetry(err) || errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isRetryableWrite определяет, можно ли повторить запись, которая не идемпотентна
+// (приращение counter вне транзакции или фиксация транзакции). Запись повторяется,
+// только если запрос заведомо не выполнен: не был отправлен на сервер или соединение
+// не было установлено. После обрыва соединения во время запроса неизвестно,
+// применена ли запись, и повтор мог бы прибавить дельту дважды.
+func isRetryableWrite(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+	var connectErr *pgconn.ConnectError
+	return errors.As(err, &connectErr)
+}
+
+// commitError - ошибка фиксации транзакции. Транзакция могла быть зафиксирована,
+// поэтому повтор допустим только для записи, которая заведомо не выполнена.
+type commitError struct {
+	err error
+}
+
+func (e *commitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *commitError) Unwrap() error {
+	return e.err
+}
+
+// commit фиксирует транзакцию, помечая ошибку фиксации для isRetryableTx
+func commit(tx *sql.Tx) error {
+	if err := tx.Commit(); err != nil {
+		return &commitError{err: err}
+	}
+	return nil
+}
+
+// isRetryableTx определяет, можно ли повторить транзакцию целиком. До фиксации
+// транзакция откатывается при любой ошибке, и ее можно повторить после временной
+// ошибки. Ошибка фиксации проверяется как ошибка записи.
+func isRetryableTx(err error) bool {
+	var commitErr *commitError
+	if errors.As(err, &commitErr) {
+		return isRetryableWrite(commitErr.err)
+	}
+	return IsRetryable(err)
+}
+
+// WithRetry выполняет операцию и повторяет ее после временных ошибок
+// не более flags.FlagDBRetryAttempts раз. Ожидание прерывается при отмене контекста.
+// Операция должна быть безопасна для повтора: чтение, начало транзакции
+// или транзакция целиком, фиксируемая через commit.
+func WithRetry(ctx context.Context, op func(ctx context.Context) error) error {
+	return withRetryIf(ctx, isRetryableTx, op)
+}
+
+// withWriteRetry выполняет запись вне транзакции и повторяет ее, только если
+// запрос заведомо не выполнен (см. isRetryableWrite)
+func withWriteRetry(ctx context.Context, op func(ctx context.Context) error) error {
+	return withRetryIf(ctx, isRetryableWrite, op)
+}
+
+// withRetryIf выполняет операцию и повторяет ее, пока retryable признает ошибку временной
+func withRetryIf(ctx context.Context, retryable func(error) bool, op func(ctx context.Context) error) error {
+	err := op(ctx)
+	for attempt := 0; attempt < int(flags.FlagDBRetryAttempts) && retryable(err); attempt++ {
+		delay := retryDelays[min(attempt, len(retryDelays)-1)]
+		zap.L().Warn("Transient database error, retrying",
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		err = op(ctx)
+	}
+	return err
+}
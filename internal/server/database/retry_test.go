@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/server/flags"
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRetryable(t *testing.T) {
+	pgErr := func(code string) error {
+		return fmt.Errorf("query failed: %w", &pgconn.PgError{Code: code})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection failure", pgErr(pgerrcode.ConnectionFailure), true},
+		{"connection does not exist", pgErr(pgerrcode.ConnectionDoesNotExist), true},
+		{"serialization failure", pgErr(pgerrcode.SerializationFailure), true},
+		{"deadlock", pgErr(pgerrcode.DeadlockDetected), true},
+		{"server shutdown", pgErr(pgerrcode.AdminShutdown), true},
+		{"unique violation", pgErr(pgerrcode.UniqueViolation), false},
+		{"syntax error", pgErr(pgerrcode.SyntaxError), false},
+		{"no rows", sql.ErrNoRows, false},
+		{"canceled", context.Canceled, false},
+		{"nil", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsRetryable(tt.err))
+		})
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	defer func(delays []time.Duration, attempts int64) {
+		retryDelays, flags.FlagDBRetryAttempts = delays, attempts
+	}(retryDelays, flags.FlagDBRetryAttempts)
+	retryDelays = []time.Duration{time.Millisecond}
+	flags.FlagDBRetryAttempts = 3
+
+	transient := &pgconn.PgError{Code: pgerrcode.SerializationFailure}
+
+	calls := 0
+	err := WithRetry(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return transient
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = WithRetry(context.Background(), func(ctx context.Context) error {
+		calls++
+		return transient
+	})
+	assert.ErrorIs(t, err, transient)
+	assert.Equal(t, 4, calls, "first attempt and three retries")
+
+	calls = 0
+	permanent := errors.New("permanent")
+	err = WithRetry(context.Background(), func(ctx context.Context) error {
+		calls++
+		return permanent
+	})
+	assert.ErrorIs(t, err, permanent)
+	assert.Equal(t, 1, calls, "permanent errors are not retried")
+}
+
+func TestIsRetryableWrite(t *testing.T) {
+	// Ошибка после отправки запроса: запись могла быть применена
+	sent := fmt.Errorf("write failed: %w", &net.OpError{Op: "read", Err: syscall.ECONNRESET})
+
+	tests := []struct {
+		name      string
+		err       error
+		wantWrite bool
+		wantTx    bool
+	}{
+		{"connect failure", &pgconn.ConnectError{}, true, true},
+		{"connection lost after send", sent, false, true},
+		{"connection lost on commit", &commitError{err: sent}, false, false},
+		{"commit with connect failure", &commitError{err: &pgconn.ConnectError{}}, true, true},
+		{"bad connection", driver.ErrBadConn, false, true},
+		{"deadlock", &pgconn.PgError{Code: pgerrcode.DeadlockDetected}, false, true},
+		{"unique violation", &pgconn.PgError{Code: pgerrcode.UniqueViolation}, false, false},
+		{"canceled", context.Canceled, false, false},
+		{"nil", nil, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantWrite, isRetryableWrite(tt.err), "write")
+			assert.Equal(t, tt.wantTx, isRetryableTx(tt.err), "transaction")
+		})
+	}
+}
+
+func TestWithWriteRetry(t *testing.T) {
+	defer func(delays []time.Duration, attempts int64) {
+		retryDelays, flags.FlagDBRetryAttempts = delays, attempts
+	}(retryDelays, flags.FlagDBRetryAttempts)
+	retryDelays = []time.Duration{time.Millisecond}
+	flags.FlagDBRetryAttempts = 3
+
+	calls := 0
+	err := withWriteRetry(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 2 {
+			return &pgconn.ConnectError{}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls, "writes are retried when the connection was not established")
+
+	calls = 0
+	sent := &net.OpError{Op: "read", Err: syscall.ECONNRESET}
+	err = withWriteRetry(context.Background(), func(ctx context.Context) error {
+		calls++
+		return sent
+	})
+	assert.ErrorIs(t, err, sent)
+	assert.Equal(t, 1, calls, "writes that may have been applied are not retried")
+}
@@ -14,6 +14,7 @@ import (
 	"strconv"
 
 	"github.com/MPoline/alert_service_yp/internal/config"
+	"github.com/MPoline/alert_service_yp/internal/hasher"
 	"go.uber.org/zap"
 )
 
@@ -40,16 +41,144 @@ var (
 	// FlagCryptoKey - путь до файла с приватным ключом
 	FlagCryptoKey string
 
+	// FlagKeyringFile - путь к файлу с дополнительными ключами RSA и секретами HMAC
+	// (флаг -keyring, переменная KEYRING)
+	FlagKeyringFile string
+
+	// FlagHashAlg - алгоритм подписи для запросов без заголовка X-Hash-Alg:
+	// sha256, sha512 или blake2b (флаг -hash-alg, переменная HASH_ALG)
+	FlagHashAlg string
+
+	// FlagAgentKeysDir - каталог с открытыми ключами Ed25519 агентов. Если задан, запросы
+	// на изменение метрик подписываются ключами агентов вместо общего секрета HMAC
+	// (флаг -agent-keys, переменная AGENT_KEYS)
+	FlagAgentKeysDir string
+
+	// FlagReplayWindow - допустимое расхождение времени подписанного запроса в секундах,
+	// 0 отключает защиту от повтора (флаг -replay-window, переменная REPLAY_WINDOW)
+	FlagReplayWindow int64
+
+	// FlagReplayCacheSize - максимальное число запоминаемых nonce (флаг -replay-cache-size, переменная REPLAY_CACHE_SIZE)
+	FlagReplayCacheSize int64
+
 	FlagConfigFile string
 
-	// FlagTrustedSubnet - CIDR подсеть доверенных IP адресов (флаг -t, переменная TRUSTED_SUBNET)
+	// FlagTrustedSubnet - подсети доверенных IP адресов IPv4 и IPv6 в формате CIDR через запятую
+	// (флаг -t, переменная TRUSTED_SUBNET)
 	FlagTrustedSubnet string
 
+	// FlagTrustedProxies - подсети доверенных прокси в формате CIDR через запятую. Только для
+	// соединений от них адрес клиента берется из X-Forwarded-For и X-Real-IP
+	// (флаг -trusted-proxies, переменная TRUSTED_PROXIES)
+	FlagTrustedProxies string
+
 	// FlagGRPC - использовать gRPC вместо HTTP (флаг -grpc, переменная USE_GRPC)
 	FlagGRPC bool
 
 	// FlagGRPCAddress - адрес gRPC сервера (флаг -grpc-address, переменная GRPC_ADDRESS)
 	FlagGRPCAddress string
+
+	// FlagGRPCReflection - включить reflection gRPC сервера (флаг -grpc-reflection, переменная GRPC_REFLECTION)
+	FlagGRPCReflection bool
+
+	// FlagAgentConfigFile - путь к файлу с настройками агентов (флаг -agent-config, переменная AGENT_CONFIG)
+	FlagAgentConfigFile string
+
+	// FlagTLSCert - путь к сертификату сервера, включает TLS для HTTP и gRPC (флаг -tls-cert, переменная TLS_CERT)
+	FlagTLSCert string
+
+	// FlagTLSKey - путь к приватному ключу сертификата сервера (флаг -tls-key, переменная TLS_KEY)
+	FlagTLSKey string
+
+	// FlagTLSClientCA - путь к CA для проверки клиентских сертификатов, включает mTLS
+	// (флаг -tls-client-ca, переменная TLS_CLIENT_CA)
+	FlagTLSClientCA string
+
+	// FlagMaxBodySize - максимальный размер тела запроса в байтах до распаковки, 0 - без ограничения
+	// (флаг -max-body-size, переменная MAX_BODY_SIZE)
+	FlagMaxBodySize int64
+
+	// FlagMaxDecompressedSize - максимальный размер распакованного тела запроса gzip и сообщения gRPC
+	// в байтах, 0 - без ограничения (флаг -max-decompressed-size, переменная MAX_DECOMPRESSED_SIZE)
+	FlagMaxDecompressedSize int64
+
+	// FlagRateLimit - допустимое число запросов на изменение метрик в секунду от одного клиента,
+	// 0 отключает ограничение (флаг -rate-limit, переменная RATE_LIMIT)
+	FlagRateLimit float64
+
+	// FlagRateBurst - допустимый всплеск запросов сверх FlagRateLimit (флаг -rate-burst, переменная RATE_BURST)
+	FlagRateBurst int64
+
+	// FlagRateLimitKey - по чему различаются клиенты при ограничении частоты: ip или agent
+	// (флаг -rate-limit-key, переменная RATE_LIMIT_KEY)
+	FlagRateLimitKey string
+
+	// FlagAuditFile - файл журнала аудита изменений метрик в формате JSON lines,
+	// пустое значение отключает журнал в файле (флаг -audit-file, переменная AUDIT_FILE)
+	FlagAuditFile string
+
+	// FlagAuditMaxSize - размер файла журнала аудита в мегабайтах, после которого файл ротируется
+	// (флаг -audit-max-size, переменная AUDIT_MAX_SIZE)
+	FlagAuditMaxSize int64
+
+	// FlagAuditMaxBackups - число хранимых ротированных файлов журнала аудита
+	// (флаг -audit-max-backups, переменная AUDIT_MAX_BACKUPS)
+	FlagAuditMaxBackups int64
+
+	// FlagAuditDB - дополнительно записывать журнал аудита в таблицу audit_log,
+	// действует только вместе с FlagDatabaseDSN (флаг -audit-db, переменная AUDIT_DB)
+	FlagAuditDB bool
+
+	// FlagDBMaxConns - максимальное число открытых соединений с базой данных
+	// (флаг -db-max-conns, переменная DB_MAX_CONNS)
+	FlagDBMaxConns int64
+
+	// FlagDBMaxIdleConns - максимальное число простаивающих соединений в пуле
+	// (флаг -db-max-idle-conns, переменная DB_MAX_IDLE_CONNS)
+	FlagDBMaxIdleConns int64
+
+	// FlagDBConnMaxLifetime - время жизни соединения в секундах, 0 - без ограничения
+	// (флаг -db-conn-max-lifetime, переменная DB_CONN_MAX_LIFETIME)
+	FlagDBConnMaxLifetime int64
+
+	// FlagDBConnMaxIdleTime - время простоя соединения в секундах до закрытия, 0 - без ограничения
+	// (флаг -db-conn-max-idle-time, переменная DB_CONN_MAX_IDLE_TIME)
+	FlagDBConnMaxIdleTime int64
+
+	// FlagDBRetryAttempts - число повторов запроса к базе данных после временной ошибки
+	// (флаг -db-retry-attempts, переменная DB_RETRY_ATTEMPTS)
+	FlagDBRetryAttempts int64
+
+	// APITokens - токены доступа к API с ролями. Задаются только в файле конфигурации
+	// (поле api_tokens), пустой список отключает аутентификацию по токенам.
+	APITokens []config.APIToken
+)
+
+// Ключи ограничения частоты запросов
+const (
+	// RateLimitKeyIP - клиенты различаются по IP адресу
+	RateLimitKeyIP = "ip"
+	// RateLimitKeyAgent - клиенты различаются по токену API или ключу агента
+	// с проверенной подписью (unary запросы gRPC), а при их отсутствии - по IP адресу
+	RateLimitKeyAgent = "agent"
+)
+
+// Значения по умолчанию для ограничений запросов
+const (
+	defaultMaxBodySize         = 10 << 20
+	defaultMaxDecompressedSize = 50 << 20
+	defaultRateBurst           = 20
+	defaultAuditMaxSize        = 100
+	defaultAuditMaxBackups     = 5
+)
+
+// Значения по умолчанию для пула соединений с базой данных
+const (
+	defaultDBMaxConns        = 10
+	defaultDBMaxIdleConns    = 5
+	defaultDBConnMaxLifetime = 3600
+	defaultDBConnMaxIdleTime = 300
+	defaultDBRetryAttempts   = 3
 )
 
 // ParseFlags обрабатывает аргументы командной строки и переменные окружения.
@@ -62,9 +191,33 @@ var (
 //	-f : путь к файлу метрик (по умолчанию "./savedMetrics")
 //	-r : восстановить метрики из файла (по умолчанию false)
 //	-d : строка подключения к БД (по умолчанию "")
+//	-db-max-conns : максимальное число соединений с БД (по умолчанию 10)
+//	-db-max-idle-conns : максимальное число простаивающих соединений с БД (по умолчанию 5)
+//	-db-conn-max-lifetime : время жизни соединения с БД в секундах (по умолчанию 3600)
+//	-db-conn-max-idle-time : время простоя соединения с БД в секундах (по умолчанию 300)
+//	-db-retry-attempts : число повторов запроса к БД после временной ошибки (по умолчанию 3)
 //	-k : ключ для подписи (по умолчанию "+randomSrting+")
 //	-с : ассиметричное шифрование (по умолчанию не используется)
-//	-t : доверенная подсеть в формате CIDR (по умолчанию "")
+//	-keyring : файл с набором ключей для постепенной смены ключей (по умолчанию "")
+//	-hash-alg : алгоритм подписи по умолчанию: sha256, sha512 или blake2b (по умолчанию "sha256")
+//	-agent-keys : каталог с открытыми ключами Ed25519 агентов (по умолчанию "" - подпись HMAC)
+//	-replay-window : окно защиты от повтора подписанных запросов в секундах (по умолчанию 0 - отключена)
+//	-replay-cache-size : размер кеша nonce (по умолчанию 100000)
+//	-max-body-size : максимальный размер тела запроса в байтах (по умолчанию 10 МБ)
+//	-max-decompressed-size : максимальный размер распакованного запроса в байтах (по умолчанию 50 МБ)
+//	-rate-limit : запросов на изменение метрик в секунду от клиента (по умолчанию 0 - без ограничения)
+//	-rate-burst : допустимый всплеск запросов (по умолчанию 20)
+//	-rate-limit-key : ключ ограничения частоты: ip или agent (по умолчанию "ip")
+//	-audit-file : файл журнала аудита изменений метрик (по умолчанию "" - не ведется)
+//	-audit-max-size : размер файла журнала аудита в МБ до ротации (по умолчанию 100)
+//	-audit-max-backups : число ротированных файлов журнала аудита (по умолчанию 5)
+//	-audit-db : вести журнал аудита в таблице audit_log базы данных (по умолчанию false)
+//	-t : доверенные подсети в формате CIDR через запятую (по умолчанию "")
+//	-trusted-proxies : подсети доверенных прокси в формате CIDR через запятую (по умолчанию "")
+//	-grpc-reflection : включить reflection gRPC сервера для grpcurl (по умолчанию false)
+//	-agent-config : файл с настройками агентов для удаленной раздачи (по умолчанию "")
+//	-tls-cert, -tls-key : сертификат и ключ сервера для TLS (по умолчанию TLS отключен)
+//	-tls-client-ca : CA для проверки клиентских сертификатов (mTLS) (по умолчанию "")
 //
 // Пример использования:
 //
@@ -77,13 +230,38 @@ func ParseFlags() {
 	flag.StringVar(&FlagFileStoragePath, "f", "./savedMetrics", "address of file for save metrics")
 	flag.BoolVar(&FlagRestore, "r", false, "read metrics from file")
 	flag.StringVar(&FlagDatabaseDSN, "d", "", "address and port to run database")
+	flag.Int64Var(&FlagDBMaxConns, "db-max-conns", defaultDBMaxConns, "maximum number of open database connections")
+	flag.Int64Var(&FlagDBMaxIdleConns, "db-max-idle-conns", defaultDBMaxIdleConns, "maximum number of idle database connections")
+	flag.Int64Var(&FlagDBConnMaxLifetime, "db-conn-max-lifetime", defaultDBConnMaxLifetime, "maximum database connection lifetime in seconds (0 disables)")
+	flag.Int64Var(&FlagDBConnMaxIdleTime, "db-conn-max-idle-time", defaultDBConnMaxIdleTime, "maximum database connection idle time in seconds (0 disables)")
+	flag.Int64Var(&FlagDBRetryAttempts, "db-retry-attempts", defaultDBRetryAttempts, "number of retries of database queries after transient errors")
 	flag.StringVar(&FlagKey, "k", "+randomSrting+", "key hashSHA256")
 	flag.StringVar(&FlagCryptoKey, "crypto-key", "", "path to file with private key for encryption")
+	flag.StringVar(&FlagKeyringFile, "keyring", "", "path to keyring file with additional private keys and HMAC secrets")
+	flag.StringVar(&FlagHashAlg, "hash-alg", hasher.DefaultAlgorithm, "default signature algorithm: sha256, sha512 or blake2b")
+	flag.StringVar(&FlagAgentKeysDir, "agent-keys", "", "directory with Ed25519 public keys of agents")
+	flag.Int64Var(&FlagReplayWindow, "replay-window", 0, "allowed clock skew of signed requests in seconds (0 disables replay protection)")
+	flag.Int64Var(&FlagReplayCacheSize, "replay-cache-size", 100000, "maximum number of remembered request nonces")
 	flag.StringVar(&FlagConfigFile, "config", "", "path to configuration file")
 	flag.StringVar(&FlagConfigFile, "c", "", "path to configuration file (shorthand)")
-	flag.StringVar(&FlagTrustedSubnet, "t", "", "trusted subnet in CIDR format")
+	flag.Int64Var(&FlagMaxBodySize, "max-body-size", defaultMaxBodySize, "maximum request body size in bytes before decompression (0 disables)")
+	flag.Int64Var(&FlagMaxDecompressedSize, "max-decompressed-size", defaultMaxDecompressedSize, "maximum decompressed request and gRPC message size in bytes (0 disables)")
+	flag.Float64Var(&FlagRateLimit, "rate-limit", 0, "allowed metric update requests per second per client (0 disables)")
+	flag.Int64Var(&FlagRateBurst, "rate-burst", defaultRateBurst, "allowed burst of requests above the rate limit")
+	flag.StringVar(&FlagRateLimitKey, "rate-limit-key", RateLimitKeyIP, "rate limit clients by ip or agent")
+	flag.StringVar(&FlagAuditFile, "audit-file", "", "path to JSON lines audit log of metric writes")
+	flag.Int64Var(&FlagAuditMaxSize, "audit-max-size", defaultAuditMaxSize, "audit log file size in megabytes before rotation")
+	flag.Int64Var(&FlagAuditMaxBackups, "audit-max-backups", defaultAuditMaxBackups, "number of rotated audit log files to keep")
+	flag.BoolVar(&FlagAuditDB, "audit-db", false, "also write audit log to the audit_log database table (requires -d)")
+	flag.StringVar(&FlagTrustedSubnet, "t", "", "comma-separated trusted subnets in CIDR format")
+	flag.StringVar(&FlagTrustedProxies, "trusted-proxies", "", "comma-separated CIDRs of proxies trusted to set X-Forwarded-For and X-Real-IP")
 	flag.BoolVar(&FlagGRPC, "grpc", false, "use gRPC instead of HTTP")
 	flag.StringVar(&FlagGRPCAddress, "grpc-address", ":3200", "gRPC server address")
+	flag.BoolVar(&FlagGRPCReflection, "grpc-reflection", false, "enable gRPC server reflection")
+	flag.StringVar(&FlagAgentConfigFile, "agent-config", "", "path to file with remote agent configurations")
+	flag.StringVar(&FlagTLSCert, "tls-cert", "", "path to server TLS certificate (enables TLS)")
+	flag.StringVar(&FlagTLSKey, "tls-key", "", "path to server TLS private key")
+	flag.StringVar(&FlagTLSClientCA, "tls-client-ca", "", "path to CA certificate for client verification (enables mutual TLS)")
 
 	flag.Parse()
 
@@ -124,16 +302,78 @@ func applyFileConfig(config *config.ServerConfig) {
 	if FlagDatabaseDSN == "" && config.DatabaseDSN != "" {
 		FlagDatabaseDSN = config.DatabaseDSN
 	}
+	if FlagDBMaxConns == defaultDBMaxConns && config.DBMaxConns != 0 {
+		FlagDBMaxConns = int64(config.DBMaxConns)
+	}
+	if FlagDBMaxIdleConns == defaultDBMaxIdleConns && config.DBMaxIdleConns != 0 {
+		FlagDBMaxIdleConns = int64(config.DBMaxIdleConns)
+	}
+	if FlagDBConnMaxLifetime == defaultDBConnMaxLifetime && config.DBConnMaxLifetime != 0 {
+		FlagDBConnMaxLifetime = int64(config.DBConnMaxLifetime.ToDuration().Seconds())
+	}
+	if FlagDBConnMaxIdleTime == defaultDBConnMaxIdleTime && config.DBConnMaxIdleTime != 0 {
+		FlagDBConnMaxIdleTime = int64(config.DBConnMaxIdleTime.ToDuration().Seconds())
+	}
+	if FlagDBRetryAttempts == defaultDBRetryAttempts && config.DBRetryAttempts != 0 {
+		FlagDBRetryAttempts = int64(config.DBRetryAttempts)
+	}
 	if FlagKey == "+randomSrting+" && config.Key != "" {
 		FlagKey = config.Key
 	}
 	if FlagCryptoKey == "" && config.CryptoKey != "" {
 		FlagCryptoKey = config.CryptoKey
 	}
+	if FlagKeyringFile == "" && config.KeyringFile != "" {
+		FlagKeyringFile = config.KeyringFile
+	}
+	if FlagHashAlg == hasher.DefaultAlgorithm && config.HashAlg != "" {
+		FlagHashAlg = config.HashAlg
+	}
+	if FlagAgentKeysDir == "" && config.AgentKeysDir != "" {
+		FlagAgentKeysDir = config.AgentKeysDir
+	}
+	if FlagReplayWindow == 0 && config.ReplayWindow != 0 {
+		FlagReplayWindow = int64(config.ReplayWindow.ToDuration().Seconds())
+	}
+	if FlagReplayCacheSize == 100000 && config.ReplayCacheSize != 0 {
+		FlagReplayCacheSize = int64(config.ReplayCacheSize)
+	}
+
+	if FlagMaxBodySize == defaultMaxBodySize && config.MaxBodySize != 0 {
+		FlagMaxBodySize = config.MaxBodySize
+	}
+	if FlagMaxDecompressedSize == defaultMaxDecompressedSize && config.MaxDecompressedSize != 0 {
+		FlagMaxDecompressedSize = config.MaxDecompressedSize
+	}
+	if FlagRateLimit == 0 && config.RateLimit != 0 {
+		FlagRateLimit = config.RateLimit
+	}
+	if FlagRateBurst == defaultRateBurst && config.RateBurst != 0 {
+		FlagRateBurst = int64(config.RateBurst)
+	}
+	if FlagRateLimitKey == RateLimitKeyIP && config.RateLimitKey != "" {
+		FlagRateLimitKey = config.RateLimitKey
+	}
+
+	if FlagAuditFile == "" && config.AuditFile != "" {
+		FlagAuditFile = config.AuditFile
+	}
+	if FlagAuditMaxSize == defaultAuditMaxSize && config.AuditMaxSize != 0 {
+		FlagAuditMaxSize = int64(config.AuditMaxSize)
+	}
+	if FlagAuditMaxBackups == defaultAuditMaxBackups && config.AuditMaxBackups != 0 {
+		FlagAuditMaxBackups = int64(config.AuditMaxBackups)
+	}
+	if !FlagAuditDB && config.AuditDB {
+		FlagAuditDB = config.AuditDB
+	}
 
 	if FlagTrustedSubnet == "" && config.TrustedSubnet != "" {
 		FlagTrustedSubnet = config.TrustedSubnet
 	}
+	if FlagTrustedProxies == "" && config.TrustedProxies != "" {
+		FlagTrustedProxies = config.TrustedProxies
+	}
 
 	if !FlagGRPC && config.UseGRPC {
 		FlagGRPC = config.UseGRPC
@@ -141,6 +381,24 @@ func applyFileConfig(config *config.ServerConfig) {
 	if FlagGRPCAddress == ":3200" && config.GRPCAddress != "" {
 		FlagGRPCAddress = config.GRPCAddress
 	}
+	if !FlagGRPCReflection && config.GRPCReflection {
+		FlagGRPCReflection = config.GRPCReflection
+	}
+	if FlagAgentConfigFile == "" && config.AgentConfigFile != "" {
+		FlagAgentConfigFile = config.AgentConfigFile
+	}
+	if FlagTLSCert == "" && config.TLSCert != "" {
+		FlagTLSCert = config.TLSCert
+	}
+	if FlagTLSKey == "" && config.TLSKey != "" {
+		FlagTLSKey = config.TLSKey
+	}
+	if FlagTLSClientCA == "" && config.TLSClientCA != "" {
+		FlagTLSClientCA = config.TLSClientCA
+	}
+	if len(config.APITokens) > 0 {
+		APITokens = config.APITokens
+	}
 }
 
 func readEnvVars() {
@@ -172,6 +430,46 @@ func readEnvVars() {
 		FlagDatabaseDSN = envDatabaseDSN
 	}
 
+	if envDBMaxConns := os.Getenv("DB_MAX_CONNS"); envDBMaxConns != "" {
+		if maxConns, err := strconv.ParseInt(envDBMaxConns, 10, 64); err == nil {
+			FlagDBMaxConns = maxConns
+		} else {
+			zap.L().Error("Failed to parse DB_MAX_CONNS", zap.Error(err))
+		}
+	}
+
+	if envDBMaxIdleConns := os.Getenv("DB_MAX_IDLE_CONNS"); envDBMaxIdleConns != "" {
+		if maxIdleConns, err := strconv.ParseInt(envDBMaxIdleConns, 10, 64); err == nil {
+			FlagDBMaxIdleConns = maxIdleConns
+		} else {
+			zap.L().Error("Failed to parse DB_MAX_IDLE_CONNS", zap.Error(err))
+		}
+	}
+
+	if envDBConnMaxLifetime := os.Getenv("DB_CONN_MAX_LIFETIME"); envDBConnMaxLifetime != "" {
+		if lifetime, err := strconv.ParseInt(envDBConnMaxLifetime, 10, 64); err == nil {
+			FlagDBConnMaxLifetime = lifetime
+		} else {
+			zap.L().Error("Failed to parse DB_CONN_MAX_LIFETIME", zap.Error(err))
+		}
+	}
+
+	if envDBConnMaxIdleTime := os.Getenv("DB_CONN_MAX_IDLE_TIME"); envDBConnMaxIdleTime != "" {
+		if idleTime, err := strconv.ParseInt(envDBConnMaxIdleTime, 10, 64); err == nil {
+			FlagDBConnMaxIdleTime = idleTime
+		} else {
+			zap.L().Error("Failed to parse DB_CONN_MAX_IDLE_TIME", zap.Error(err))
+		}
+	}
+
+	if envDBRetryAttempts := os.Getenv("DB_RETRY_ATTEMPTS"); envDBRetryAttempts != "" {
+		if attempts, err := strconv.ParseInt(envDBRetryAttempts, 10, 64); err == nil {
+			FlagDBRetryAttempts = attempts
+		} else {
+			zap.L().Error("Failed to parse DB_RETRY_ATTEMPTS", zap.Error(err))
+		}
+	}
+
 	if envKey := os.Getenv("KEY"); envKey != "" {
 		FlagKey = envKey
 	}
@@ -180,14 +478,110 @@ func readEnvVars() {
 		FlagCryptoKey = envCryptoKey
 	}
 
+	if envKeyringFile := os.Getenv("KEYRING"); envKeyringFile != "" {
+		FlagKeyringFile = envKeyringFile
+	}
+
+	if envHashAlg := os.Getenv("HASH_ALG"); envHashAlg != "" {
+		FlagHashAlg = envHashAlg
+	}
+
+	if envAgentKeysDir := os.Getenv("AGENT_KEYS"); envAgentKeysDir != "" {
+		FlagAgentKeysDir = envAgentKeysDir
+	}
+
+	if envReplayWindow := os.Getenv("REPLAY_WINDOW"); envReplayWindow != "" {
+		if window, err := strconv.ParseInt(envReplayWindow, 10, 64); err == nil {
+			FlagReplayWindow = window
+		} else {
+			zap.L().Error("Failed to parse REPLAY_WINDOW", zap.Error(err))
+		}
+	}
+
+	if envReplayCacheSize := os.Getenv("REPLAY_CACHE_SIZE"); envReplayCacheSize != "" {
+		if size, err := strconv.ParseInt(envReplayCacheSize, 10, 64); err == nil {
+			FlagReplayCacheSize = size
+		} else {
+			zap.L().Error("Failed to parse REPLAY_CACHE_SIZE", zap.Error(err))
+		}
+	}
+
 	if envConfigFile := os.Getenv("CONFIG"); envConfigFile != "" {
 		FlagConfigFile = envConfigFile
 	}
 
+	if envMaxBodySize := os.Getenv("MAX_BODY_SIZE"); envMaxBodySize != "" {
+		if size, err := strconv.ParseInt(envMaxBodySize, 10, 64); err == nil {
+			FlagMaxBodySize = size
+		} else {
+			zap.L().Error("Failed to parse MAX_BODY_SIZE", zap.Error(err))
+		}
+	}
+
+	if envMaxDecompressedSize := os.Getenv("MAX_DECOMPRESSED_SIZE"); envMaxDecompressedSize != "" {
+		if size, err := strconv.ParseInt(envMaxDecompressedSize, 10, 64); err == nil {
+			FlagMaxDecompressedSize = size
+		} else {
+			zap.L().Error("Failed to parse MAX_DECOMPRESSED_SIZE", zap.Error(err))
+		}
+	}
+
+	if envRateLimit := os.Getenv("RATE_LIMIT"); envRateLimit != "" {
+		if rate, err := strconv.ParseFloat(envRateLimit, 64); err == nil {
+			FlagRateLimit = rate
+		} else {
+			zap.L().Error("Failed to parse RATE_LIMIT", zap.Error(err))
+		}
+	}
+
+	if envRateBurst := os.Getenv("RATE_BURST"); envRateBurst != "" {
+		if burst, err := strconv.ParseInt(envRateBurst, 10, 64); err == nil {
+			FlagRateBurst = burst
+		} else {
+			zap.L().Error("Failed to parse RATE_BURST", zap.Error(err))
+		}
+	}
+
+	if envRateLimitKey := os.Getenv("RATE_LIMIT_KEY"); envRateLimitKey != "" {
+		FlagRateLimitKey = envRateLimitKey
+	}
+
+	if envAuditFile := os.Getenv("AUDIT_FILE"); envAuditFile != "" {
+		FlagAuditFile = envAuditFile
+	}
+
+	if envAuditMaxSize := os.Getenv("AUDIT_MAX_SIZE"); envAuditMaxSize != "" {
+		if size, err := strconv.ParseInt(envAuditMaxSize, 10, 64); err == nil {
+			FlagAuditMaxSize = size
+		} else {
+			zap.L().Error("Failed to parse AUDIT_MAX_SIZE", zap.Error(err))
+		}
+	}
+
+	if envAuditMaxBackups := os.Getenv("AUDIT_MAX_BACKUPS"); envAuditMaxBackups != "" {
+		if backups, err := strconv.ParseInt(envAuditMaxBackups, 10, 64); err == nil {
+			FlagAuditMaxBackups = backups
+		} else {
+			zap.L().Error("Failed to parse AUDIT_MAX_BACKUPS", zap.Error(err))
+		}
+	}
+
+	if envAuditDB := os.Getenv("AUDIT_DB"); envAuditDB != "" {
+		if auditDB, err := strconv.ParseBool(envAuditDB); err == nil {
+			FlagAuditDB = auditDB
+		} else {
+			zap.L().Error("Failed to parse AUDIT_DB", zap.Error(err))
+		}
+	}
+
 	if envTrustedSubnet := os.Getenv("TRUSTED_SUBNET"); envTrustedSubnet != "" {
 		FlagTrustedSubnet = envTrustedSubnet
 	}
 
+	if envTrustedProxies := os.Getenv("TRUSTED_PROXIES"); envTrustedProxies != "" {
+		FlagTrustedProxies = envTrustedProxies
+	}
+
 	if envUseGRPC := os.Getenv("USE_GRPC"); envUseGRPC != "" {
 		if useGRPC, err := strconv.ParseBool(envUseGRPC); err == nil {
 			FlagGRPC = useGRPC
@@ -199,6 +593,30 @@ func readEnvVars() {
 	if envGRPCAddress := os.Getenv("GRPC_ADDRESS"); envGRPCAddress != "" {
 		FlagGRPCAddress = envGRPCAddress
 	}
+
+	if envGRPCReflection := os.Getenv("GRPC_REFLECTION"); envGRPCReflection != "" {
+		if reflection, err := strconv.ParseBool(envGRPCReflection); err == nil {
+			FlagGRPCReflection = reflection
+		} else {
+			zap.L().Error("Failed to parse GRPC_REFLECTION", zap.Error(err))
+		}
+	}
+
+	if envAgentConfigFile := os.Getenv("AGENT_CONFIG"); envAgentConfigFile != "" {
+		FlagAgentConfigFile = envAgentConfigFile
+	}
+
+	if envTLSCert := os.Getenv("TLS_CERT"); envTLSCert != "" {
+		FlagTLSCert = envTLSCert
+	}
+
+	if envTLSKey := os.Getenv("TLS_KEY"); envTLSKey != "" {
+		FlagTLSKey = envTLSKey
+	}
+
+	if envTLSClientCA := os.Getenv("TLS_CLIENT_CA"); envTLSClientCA != "" {
+		FlagTLSClientCA = envTLSClientCA
+	}
 }
 
 func validateAndLogFlags() {
@@ -208,6 +626,95 @@ func validateAndLogFlags() {
 		FlagStoreInterval = 300
 	}
 
+	if FlagReplayWindow < 0 {
+		zap.L().Warn("Replay window cannot be negative, disabling replay protection")
+		FlagReplayWindow = 0
+	}
+
+	if FlagReplayCacheSize <= 0 {
+		zap.L().Warn("Replay cache size must be positive, using default value",
+			zap.Int64("default", 100000))
+		FlagReplayCacheSize = 100000
+	}
+
+	if FlagMaxBodySize < 0 {
+		zap.L().Warn("Max body size cannot be negative, using default value",
+			zap.Int64("default", defaultMaxBodySize))
+		FlagMaxBodySize = defaultMaxBodySize
+	}
+
+	if FlagMaxDecompressedSize < 0 {
+		zap.L().Warn("Max decompressed size cannot be negative, using default value",
+			zap.Int64("default", defaultMaxDecompressedSize))
+		FlagMaxDecompressedSize = defaultMaxDecompressedSize
+	}
+
+	if FlagRateLimit < 0 {
+		zap.L().Warn("Rate limit cannot be negative, disabling rate limiting")
+		FlagRateLimit = 0
+	}
+
+	if FlagRateBurst <= 0 {
+		zap.L().Warn("Rate burst must be positive, using default value",
+			zap.Int64("default", defaultRateBurst))
+		FlagRateBurst = defaultRateBurst
+	}
+
+	if FlagRateLimitKey != RateLimitKeyIP && FlagRateLimitKey != RateLimitKeyAgent {
+		zap.L().Warn("Unknown rate limit key, limiting by IP",
+			zap.String("rate_limit_key", FlagRateLimitKey))
+		FlagRateLimitKey = RateLimitKeyIP
+	}
+
+	if FlagDBMaxConns <= 0 {
+		zap.L().Warn("Database max connections must be positive, using default value",
+			zap.Int64("default", defaultDBMaxConns))
+		FlagDBMaxConns = defaultDBMaxConns
+	}
+
+	if FlagDBMaxIdleConns < 0 || FlagDBMaxIdleConns > FlagDBMaxConns {
+		zap.L().Warn("Database max idle connections must be between 0 and max connections, using max connections",
+			zap.Int64("max_conns", FlagDBMaxConns))
+		FlagDBMaxIdleConns = FlagDBMaxConns
+	}
+
+	if FlagDBConnMaxLifetime < 0 {
+		zap.L().Warn("Database connection lifetime cannot be negative, using default value",
+			zap.Int64("default", defaultDBConnMaxLifetime))
+		FlagDBConnMaxLifetime = defaultDBConnMaxLifetime
+	}
+
+	if FlagDBConnMaxIdleTime < 0 {
+		zap.L().Warn("Database connection idle time cannot be negative, using default value",
+			zap.Int64("default", defaultDBConnMaxIdleTime))
+		FlagDBConnMaxIdleTime = defaultDBConnMaxIdleTime
+	}
+
+	if FlagDBRetryAttempts < 0 {
+		zap.L().Warn("Database retry attempts cannot be negative, disabling retries")
+		FlagDBRetryAttempts = 0
+	}
+
+	if FlagAuditMaxSize <= 0 {
+		zap.L().Warn("Audit log size must be positive, using default value",
+			zap.Int64("default", defaultAuditMaxSize))
+		FlagAuditMaxSize = defaultAuditMaxSize
+	}
+
+	if FlagAuditMaxBackups < 0 {
+		zap.L().Warn("Audit log backups cannot be negative, using default value",
+			zap.Int64("default", defaultAuditMaxBackups))
+		FlagAuditMaxBackups = defaultAuditMaxBackups
+	}
+
+	if FlagAuditDB && FlagDatabaseDSN == "" {
+		zap.L().Warn("Audit log table is ignored without a database DSN")
+	}
+
+	if FlagTLSCert == "" && (FlagTLSKey != "" || FlagTLSClientCA != "") {
+		zap.L().Warn("TLS key and client CA are ignored without a server certificate")
+	}
+
 	zap.L().Info(
 		"Server configuration",
 		zap.String("address", FlagRunAddr),
@@ -215,11 +722,37 @@ func validateAndLogFlags() {
 		zap.String("file_storage_path", FlagFileStoragePath),
 		zap.Bool("restore", FlagRestore),
 		zap.String("database_dsn", FlagDatabaseDSN),
+		zap.Int64("db_max_conns", FlagDBMaxConns),
+		zap.Int64("db_max_idle_conns", FlagDBMaxIdleConns),
+		zap.Int64("db_conn_max_lifetime", FlagDBConnMaxLifetime),
+		zap.Int64("db_conn_max_idle_time", FlagDBConnMaxIdleTime),
+		zap.Int64("db_retry_attempts", FlagDBRetryAttempts),
 		zap.String("key", config.MaskSensitive(FlagKey)),
 		zap.String("crypto_key", FlagCryptoKey),
+		zap.String("keyring", FlagKeyringFile),
+		zap.String("hash_alg", FlagHashAlg),
+		zap.String("agent_keys", FlagAgentKeysDir),
+		zap.Int64("replay_window", FlagReplayWindow),
+		zap.Int64("replay_cache_size", FlagReplayCacheSize),
 		zap.String("config_file", FlagConfigFile),
+		zap.Int64("max_body_size", FlagMaxBodySize),
+		zap.Int64("max_decompressed_size", FlagMaxDecompressedSize),
+		zap.Float64("rate_limit", FlagRateLimit),
+		zap.Int64("rate_burst", FlagRateBurst),
+		zap.String("rate_limit_key", FlagRateLimitKey),
+		zap.String("audit_file", FlagAuditFile),
+		zap.Int64("audit_max_size", FlagAuditMaxSize),
+		zap.Int64("audit_max_backups", FlagAuditMaxBackups),
+		zap.Bool("audit_db", FlagAuditDB),
 		zap.String("trusted_subnet", FlagTrustedSubnet),
+		zap.String("trusted_proxies", FlagTrustedProxies),
 		zap.Bool("use_grpc", FlagGRPC),
 		zap.String("grpc_address", FlagGRPCAddress),
+		zap.Bool("grpc_reflection", FlagGRPCReflection),
+		zap.String("agent_config_file", FlagAgentConfigFile),
+		zap.String("tls_cert", FlagTLSCert),
+		zap.String("tls_key", FlagTLSKey),
+		zap.String("tls_client_ca", FlagTLSClientCA),
+		zap.Int("api_tokens", len(APITokens)),
 	)
 }
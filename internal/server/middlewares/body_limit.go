@@ -0,0 +1,52 @@
+package middlewares
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// BodyLimitMiddleware ограничивает размер тела запроса до распаковки. Запросы
+// с телом больше maxBytes отклоняются с кодом 413, в том числе без Content-Length.
+// maxBytes не больше нуля отключает ограничение.
+func BodyLimitMiddleware(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxBytes <= 0 || c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > maxBytes {
+			abortBodyTooLarge(c, c.Request.ContentLength, maxBytes)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBytes+1))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"Error": "Failed to read request"})
+			zap.L().Error("Failed to read request body", zap.Error(err))
+			return
+		}
+		if int64(len(body)) > maxBytes {
+			abortBodyTooLarge(c, int64(len(body)), maxBytes)
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+		c.Next()
+	}
+}
+
+// abortBodyTooLarge отклоняет запрос с телом размера size, превышающим limit
+func abortBodyTooLarge(c *gin.Context, size, limit int64) {
+	zap.L().Warn("Request body too large",
+		zap.Int64("size", size),
+		zap.Int64("limit", limit),
+		zap.String("path", c.Request.URL.Path),
+		zap.String("client_ip", c.ClientIP()))
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"Error": "Request body too large"})
+}
@@ -0,0 +1,117 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/ratelimit"
+	"github.com/MPoline/alert_service_yp/internal/server/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func gzipBody(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(middlewares.BodyLimitMiddleware(4096))
+	router.Use(middlewares.GZipDecompress(8192))
+	router.POST("/updates/", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, strconv.Itoa(len(body)))
+	})
+
+	// Сильно сжимаемые данные: 1 МБ нулей укладывается в ограничение сжатого тела
+	bomb := gzipBody(t, make([]byte, 1<<20))
+	if len(bomb) > 4096 {
+		t.Fatalf("compressed bomb is too large for the test: %d bytes", len(bomb))
+	}
+
+	tests := []struct {
+		name    string
+		body    []byte
+		gzip    bool
+		chunked bool
+		want    int
+	}{
+		{"small plain body", []byte(strings.Repeat("a", 512)), false, false, http.StatusOK},
+		{"large plain body", []byte(strings.Repeat("a", 5000)), false, false, http.StatusRequestEntityTooLarge},
+		{"large chunked body", []byte(strings.Repeat("a", 5000)), false, true, http.StatusRequestEntityTooLarge},
+		{"small gzip body", gzipBody(t, []byte(strings.Repeat("a", 6000))), true, false, http.StatusOK},
+		{"gzip bomb", bomb, true, false, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			if tt.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d (%s)", tt.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/updates/", middlewares.RateLimitMiddleware(ratelimit.New(1, 2), middlewares.RateLimitByIP), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	send := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := send("10.0.0.1:5000"); w.Code != http.StatusOK {
+			t.Fatalf("request %d within burst: expected 200, got %d", i, w.Code)
+		}
+	}
+
+	w := send("10.0.0.1:5000")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	if err != nil || retryAfter < 1 || time.Duration(retryAfter)*time.Second > 2*time.Second {
+		t.Errorf("unexpected Retry-After %q", w.Header().Get("Retry-After"))
+	}
+
+	if w := send("10.0.0.2:5000"); w.Code != http.StatusOK {
+		t.Errorf("other client: expected 200, got %d", w.Code)
+	}
+}
@@ -6,13 +6,14 @@ import (
 	"net/http"
 
 	"github.com/MPoline/alert_service_yp/internal/crypto"
-	"github.com/MPoline/alert_service_yp/internal/server/services"
+	"github.com/MPoline/alert_service_yp/internal/keyring"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
 // DecryptMiddleware проверяет и расшифровывает входящие зашифрованные данные
-func DecryptMiddleware() gin.HandlerFunc {
+// ключами из набора keys
+func DecryptMiddleware(keys *keyring.Keyring) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		isEncrypted := c.GetHeader("X-Encrypted") == "true"
 
@@ -21,8 +22,7 @@ func DecryptMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		privateKey := services.GetPrivateKey()
-		if privateKey == nil {
+		if !keys.DecryptionEnabled() {
 			zap.L().Error("Received encrypted data but decryption is not configured")
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Decryption not configured"})
 			c.Abort()
@@ -40,15 +40,14 @@ func DecryptMiddleware() gin.HandlerFunc {
 
 		zap.L().Debug("Encrypted request received (after gzip decompress)",
 			zap.Int("size", len(body)),
-			zap.Int("key_size", privateKey.Size()),
+			zap.Bool("is_envelope", crypto.IsEnvelope(body)),
 			zap.Bool("is_chunk_protocol", crypto.IsChunkProtocol(body)))
 
-		decryptedData, err := crypto.DecryptLargeData(privateKey, body)
+		decryptedData, err := keys.Decrypt(body)
 		if err != nil {
 			zap.L().Error("Failed to decrypt data",
 				zap.Error(err),
-				zap.Int("data_size", len(body)),
-				zap.Int("key_size", privateKey.Size()))
+				zap.Int("data_size", len(body)))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Decryption failed: " + err.Error()})
 			c.Abort()
 			return
@@ -59,6 +58,7 @@ func DecryptMiddleware() gin.HandlerFunc {
 		c.Request.Header.Set("Content-Type", "application/json")
 		c.Request.Header.Del("X-Encrypted")
 		c.Request.Header.Del("X-Encryption-Algorithm")
+		c.Request.Header.Del("X-Encryption-Mode")
 
 		zap.L().Info("Data decrypted successfully",
 			zap.Int("encrypted_size", len(body)),
@@ -25,7 +25,7 @@ func ExampleGZipCompress() {
 func ExampleGZipDecompress() {
 	router := gin.Default()
 
-	router.Use(middlewares.GZipDecompress())
+	router.Use(middlewares.GZipDecompress(50 << 20))
 
 	router.POST("/data", func(c *gin.Context) {
 		var jsonData map[string]interface{}
@@ -47,11 +47,13 @@ func (gzw *gzipWriter) Close() {
 
 // GZipDecompress возвращает middleware для распаковки входящих Gzip-запросов.
 // Проверяет заголовок Content-Encoding: gzip и автоматически распаковывает тело запроса.
+// Распаковка прекращается, как только размер данных превышает maxBytes, такие запросы
+// отклоняются с кодом 413. maxBytes не больше нуля отключает ограничение.
 //
 // Пример использования:
 //  router := gin.Default()
-//  router.Use(GZipDecompress())
-func GZipDecompress() gin.HandlerFunc {
+//  router.Use(GZipDecompress(50 << 20))
+func GZipDecompress(maxBytes int64) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if !strings.EqualFold(c.GetHeader("Content-Encoding"), "gzip") {
 			c.Next()
@@ -68,12 +70,21 @@ func GZipDecompress() gin.HandlerFunc {
 		}
 		defer gzr.Close()
 
-		body, err := io.ReadAll(gzr)
+		var reader io.Reader = gzr
+		if maxBytes > 0 {
+			reader = io.LimitReader(gzr, maxBytes+1)
+		}
+
+		body, err := io.ReadAll(reader)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"Error": "Failed to read compressed request"})
 			zap.L().Error("Failed to read compressed request", zap.Error(err))
 			return
 		}
+		if maxBytes > 0 && int64(len(body)) > maxBytes {
+			abortBodyTooLarge(c, int64(len(body)), maxBytes)
+			return
+		}
 
 		c.Request.Body = io.NopCloser(bytes.NewReader(body))
 		c.Request.ContentLength = int64(len(body))
@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/MPoline/alert_service_yp/internal/apitoken"
+	"github.com/MPoline/alert_service_yp/internal/netutil"
+	"github.com/MPoline/alert_service_yp/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RateLimitKeyFunc возвращает ключ клиента, по которому ограничивается частота запросов
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// RateLimitByIP различает клиентов по IP адресу, определенному ClientIPMiddleware
+func RateLimitByIP(c *gin.Context) string {
+	if ip := netutil.ClientIPFromContext(c.Request.Context()); ip != nil {
+		return "ip:" + ip.String()
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimitByToken различает клиентов по имени проверенного токена API, остальных -
+// по IP адресу. Заголовок X-Agent-Id не используется: подпись агента проверяется
+// обработчиком уже после ограничения частоты, и подставной идентификатор позволял бы
+// обойти ограничение.
+func RateLimitByToken(c *gin.Context) string {
+	if identity, ok := apitoken.IdentityFromContext(c.Request.Context()); ok && identity.Name != "" {
+		return "token:" + identity.Name
+	}
+	return RateLimitByIP(c)
+}
+
+// RateLimitMiddleware ограничивает частоту запросов клиента. При превышении
+// возвращает 429 с заголовком Retry-After. nil limiter отключает ограничение.
+func RateLimitMiddleware(limiter *ratelimit.Limiter, key RateLimitKeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !limiter.Enabled() {
+			c.Next()
+			return
+		}
+
+		client := key(c)
+		if ok, wait := limiter.Allow(client); !ok {
+			retryAfter := ratelimit.RetryAfter(wait)
+			zap.L().Warn("Rate limit exceeded",
+				zap.String("client", client),
+				zap.Int("retry_after", retryAfter),
+				zap.String("path", c.Request.URL.Path))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"Error": "Rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
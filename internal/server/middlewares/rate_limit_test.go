@@ -0,0 +1,37 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/ratelimit"
+	"github.com/MPoline/alert_service_yp/internal/server/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitByTokenIgnoresAgentHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(middlewares.ClientIPMiddleware(nil))
+	router.POST("/updates/", middlewares.RateLimitMiddleware(ratelimit.New(0.001, 1), middlewares.RateLimitByToken), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	// Разные X-Agent-Id от одного адреса расходуют одну корзину
+	want := []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}
+	for i, code := range want {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		req.Header.Set(agentkey.HeaderAgentID, "agent-"+strconv.Itoa(i))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != code {
+			t.Errorf("request %d: expected status %d, got %d", i+1, code, w.Code)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/MPoline/alert_service_yp/internal/apitoken"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// TokenAuthMiddleware проверяет токен Bearer из заголовка Authorization и его роль.
+// Без токена или с неизвестным токеном возвращает 401, при недостаточной роли - 403.
+// Если аутентификация по токенам отключена, пропускает все запросы.
+func TokenAuthMiddleware(auth *apitoken.Authenticator, required apitoken.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.Enabled() {
+			c.Next()
+			return
+		}
+
+		identity, err := auth.Authorize(c.GetHeader(apitoken.HeaderAuthorization), required)
+		if err != nil {
+			zap.L().Warn("API token rejected",
+				zap.String("token", identity.Name),
+				zap.String("required_role", string(required)),
+				zap.String("path", c.Request.URL.Path),
+				zap.String("method", c.Request.Method),
+				zap.Error(err))
+
+			if errors.Is(err, apitoken.ErrForbidden) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"Error": "Access denied - insufficient token role",
+				})
+				return
+			}
+			c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"Error": "Valid API token required",
+			})
+			return
+		}
+
+		c.Request = c.Request.WithContext(apitoken.WithIdentity(c.Request.Context(), identity))
+		c.Next()
+	}
+}
@@ -0,0 +1,79 @@
+package middlewares_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MPoline/alert_service_yp/internal/apitoken"
+	"github.com/MPoline/alert_service_yp/internal/config"
+	"github.com/MPoline/alert_service_yp/internal/server/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func TestTokenAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	auth, err := apitoken.New([]config.APIToken{
+		{Name: "grafana", Role: "read", Hash: apitoken.HashToken("read-token")},
+		{Name: "agents", Role: "write", Hash: apitoken.HashToken("write-token")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.GET("/", middlewares.TokenAuthMiddleware(auth, apitoken.RoleRead), func(c *gin.Context) {
+		identity, _ := apitoken.IdentityFromContext(c.Request.Context())
+		c.String(http.StatusOK, identity.Name)
+	})
+	router.POST("/update/", middlewares.TokenAuthMiddleware(auth, apitoken.RoleWrite), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/open", middlewares.TokenAuthMiddleware(nil, apitoken.RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"read with read token", http.MethodGet, "/", "read-token", http.StatusOK},
+		{"read with write token", http.MethodGet, "/", "write-token", http.StatusOK},
+		{"read without token", http.MethodGet, "/", "", http.StatusUnauthorized},
+		{"read with unknown token", http.MethodGet, "/", "other", http.StatusUnauthorized},
+		{"write with read token", http.MethodPost, "/update/", "read-token", http.StatusForbidden},
+		{"write with write token", http.MethodPost, "/update/", "write-token", http.StatusOK},
+		{"disabled authentication", http.MethodGet, "/open", "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set(apitoken.HeaderAuthorization, apitoken.Bearer(tt.token))
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, w.Code)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header")
+			}
+
+			// Ошибки авторизации передаются в том же поле, что и остальные ошибки API
+			if w.Code == http.StatusUnauthorized || w.Code == http.StatusForbidden {
+				var body map[string]string
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["Error"] == "" {
+					t.Errorf("expected error in the Error field, got %s", w.Body.String())
+				}
+			}
+		})
+	}
+}
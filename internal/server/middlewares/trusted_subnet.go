@@ -1,67 +1,54 @@
 package middlewares
 
 import (
-	"net"
 	"net/http"
-	"strings"
 
-	"github.com/MPoline/alert_service_yp/internal/server/flags"
+	"github.com/MPoline/alert_service_yp/internal/netutil"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
-// TrustedSubnetMiddleware проверяет, что IP адрес из заголовка X-Real-IP
-// находится в доверенной подсети. Если подсеть не задана, пропускает все запросы.
-func TrustedSubnetMiddleware() gin.HandlerFunc {
+// ClientIPMiddleware определяет IP адрес клиента и сохраняет его в контексте запроса.
+// Заголовки X-Forwarded-For и X-Real-IP учитываются, только если соединение
+// установлено с адреса из proxies, иначе используется адрес соединения.
+func ClientIPMiddleware(proxies netutil.IPSet) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if flags.FlagTrustedSubnet == "" {
-			c.Next()
-			return
+		ip := netutil.ClientIP(c.Request.RemoteAddr,
+			c.GetHeader(netutil.HeaderForwardedFor),
+			c.GetHeader(netutil.HeaderRealIP),
+			proxies)
+		if ip != nil {
+			c.Request = c.Request.WithContext(netutil.WithClientIP(c.Request.Context(), ip))
 		}
+		c.Next()
+	}
+}
 
-		realIP := c.GetHeader("X-Real-IP")
-		if realIP == "" {
-			zap.L().Warn("X-Real-IP header is missing",
-				zap.String("path", c.Request.URL.Path),
-				zap.String("method", c.Request.Method))
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-				"error": "X-Real-IP header required",
-			})
+// TrustedSubnetMiddleware проверяет, что IP адрес клиента, определенный ClientIPMiddleware,
+// входит в одну из доверенных подсетей. Если подсети не заданы, пропускает все запросы.
+func TrustedSubnetMiddleware(trusted netutil.IPSet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(trusted) == 0 {
+			c.Next()
 			return
 		}
 
-		if strings.Contains(realIP, ":") {
-			if host, _, err := net.SplitHostPort(realIP); err == nil {
-				realIP = host
-			}
-		}
-
-		ip := net.ParseIP(realIP)
+		ip := netutil.ClientIPFromContext(c.Request.Context())
 		if ip == nil {
-			zap.L().Warn("Invalid IP address in X-Real-IP header",
-				zap.String("ip", realIP),
-				zap.String("path", c.Request.URL.Path))
+			zap.L().Warn("Client IP address is unknown",
+				zap.String("remote_addr", c.Request.RemoteAddr),
+				zap.String("path", c.Request.URL.Path),
+				zap.String("method", c.Request.Method))
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-				"error": "Invalid IP address",
-			})
-			return
-		}
-
-		_, trustedNet, err := net.ParseCIDR(flags.FlagTrustedSubnet)
-		if err != nil {
-			zap.L().Error("Invalid trusted subnet CIDR",
-				zap.String("subnet", flags.FlagTrustedSubnet),
-				zap.Error(err))
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-				"error": "Server configuration error",
+				"error": "Client IP address is unknown",
 			})
 			return
 		}
 
-		if !trustedNet.Contains(ip) {
+		if !trusted.Contains(ip) {
 			zap.L().Warn("IP address not in trusted subnet",
-				zap.String("ip", realIP),
-				zap.String("trusted_subnet", flags.FlagTrustedSubnet),
+				zap.String("ip", ip.String()),
+				zap.String("trusted_subnet", trusted.String()),
 				zap.String("path", c.Request.URL.Path))
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
 				"error": "Access denied - IP not in trusted subnet",
@@ -70,8 +57,8 @@ func TrustedSubnetMiddleware() gin.HandlerFunc {
 		}
 
 		zap.L().Debug("IP address allowed",
-			zap.String("ip", realIP),
-			zap.String("trusted_subnet", flags.FlagTrustedSubnet),
+			zap.String("ip", ip.String()),
+			zap.String("trusted_subnet", trusted.String()),
 			zap.String("path", c.Request.URL.Path))
 
 		c.Next()
@@ -0,0 +1,61 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MPoline/alert_service_yp/internal/netutil"
+	"github.com/MPoline/alert_service_yp/internal/server/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func TestTrustedSubnetMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	trusted, err := netutil.ParseIPSet("10.0.0.0/8, fd00::/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxies, err := netutil.ParseIPSet("192.168.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(middlewares.ClientIPMiddleware(proxies))
+	router.POST("/update/", middlewares.TrustedSubnetMiddleware(trusted), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       int
+	}{
+		{"trusted client", "10.1.2.3:5000", nil, http.StatusOK},
+		{"trusted ipv6 client", "[fd00::7]:5000", nil, http.StatusOK},
+		{"untrusted client", "203.0.113.5:5000", nil, http.StatusForbidden},
+		{"spoofed real ip", "203.0.113.5:5000", map[string]string{"X-Real-IP": "10.1.2.3"}, http.StatusForbidden},
+		{"spoofed forwarded for", "203.0.113.5:5000", map[string]string{"X-Forwarded-For": "10.1.2.3"}, http.StatusForbidden},
+		{"trusted client behind proxy", "192.168.0.1:5000", map[string]string{"X-Forwarded-For": "10.1.2.3"}, http.StatusOK},
+		{"untrusted client behind proxy", "192.168.0.1:5000", map[string]string{"X-Real-IP": "203.0.113.5"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/update/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"net/http"
+
+	"github.com/MPoline/alert_service_yp/internal/netutil"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// GetAgentConfig обрабатывает запрос агента на получение его настроек.
+//
+// Эндпоинт: GET /api/v1/agent-config
+//
+// Логика работы:
+//  1. Определяет метку агента из параметра label и IP адрес клиента
+//     (из заголовков X-Forwarded-For и X-Real-IP только за доверенным прокси)
+//  2. Выбирает первое подходящее правило из файла настроек агентов
+//  3. Возвращает настройки по умолчанию с примененным правилом
+//
+// Возможные ответы:
+//   - 200 OK: настройки агента в JSON
+//   - 404 Not Found: удаленная раздача настроек не сконфигурирована
+//
+// Пример:
+//
+//	Запрос:
+//	  GET /api/v1/agent-config?label=db
+//
+//	Ответ:
+//	  {"poll_interval":"1s","report_interval":"10s","collectors":["runtime"],"labels":{"env":"prod"}}
+func (h *ServiceHandler) GetAgentConfig(c *gin.Context) {
+	if h.agentConfigs == nil {
+		c.JSON(http.StatusNotFound, gin.H{"Error": "Remote agent config is not configured"})
+		return
+	}
+
+	label := c.Query("label")
+	ip := c.ClientIP()
+	if clientIP := netutil.ClientIPFromContext(c.Request.Context()); clientIP != nil {
+		ip = clientIP.String()
+	}
+
+	agentConfig := h.agentConfigs.Resolve(label, ip)
+
+	zap.L().Debug("Agent config resolved",
+		zap.String("label", label),
+		zap.String("ip", ip))
+
+	c.JSON(http.StatusOK, agentConfig)
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/audit"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// defaultAuditLimit - число записей журнала аудита в ответе, если limit не задан
+const defaultAuditLimit = 1000
+
+// GetAuditLog возвращает записи журнала аудита изменений метрик за интервал времени.
+//
+// Эндпоинт: GET /api/v1/audit
+//
+// Параметры запроса:
+//   - from: начало интервала в RFC 3339 включительно (по умолчанию без ограничения)
+//   - to: конец интервала в RFC 3339 не включительно (по умолчанию без ограничения)
+//   - limit: максимальное число записей (по умолчанию 1000)
+//
+// Возможные ответы:
+//   - 200 OK: записи журнала в JSON в порядке времени
+//   - 400 Bad Request: неверный формат параметров
+//   - 404 Not Found: журнал аудита не ведется
+//   - 500 Internal Server Error: ошибка чтения журнала
+//
+// Пример:
+//
+//	Запрос:
+//	  GET /api/v1/audit?from=2024-05-01T00:00:00Z&to=2024-05-02T00:00:00Z&limit=100
+//
+//	Ответ:
+//	  [{"ts":"2024-05-01T10:00:00Z","ip":"10.0.0.5","agent_id":"agent-1","transport":"http-batch",
+//	    "metrics":[{"id":"PollCount","type":"counter","old_delta":5,"new_delta":6}]}]
+func (h *ServiceHandler) GetAuditLog(c *gin.Context) {
+	if !h.audit.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"Error": "Audit log is not configured"})
+		return
+	}
+
+	filter := audit.Filter{Limit: defaultAuditLimit}
+	var err error
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid from parameter, RFC 3339 expected"})
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid to parameter, RFC 3339 expected"})
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"Error": "Invalid limit parameter"})
+			return
+		}
+	}
+
+	entries, err := h.audit.Query(c.Request.Context(), filter)
+	if err != nil {
+		zap.L().Error("Failed to query audit log", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to read audit log"})
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// auditContext возвращает контекст запроса со способом передачи метрик для журнала аудита.
+// Вызывается непосредственно перед записью, чтобы контекст содержал проверенного агента.
+func auditContext(c *gin.Context, transport audit.Transport) context.Context {
+	return audit.WithTransport(c.Request.Context(), transport)
+}
@@ -4,8 +4,9 @@ package services
 import (
 	"net/http"
 
-	"github.com/MPoline/alert_service_yp/internal/server/database"
+	"github.com/MPoline/alert_service_yp/internal/storage"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 // CheckDBConnection обрабатывает запрос проверки соединения с базой данных.
@@ -13,29 +14,30 @@ import (
 // Эндпоинт: GET /ping
 //
 // Логика работы:
-//  1. Устанавливает соединение с БД
-//  2. Проверяет доступность БД методом Ping()
+//  1. Проверяет, что метрики хранятся в базе данных
+//  2. Проверяет доступность базы данных соединением из пула хранилища
 //  3. Возвращает результат проверки
 //
 // Возможные ответы:
-//  - 200 OK: соединение успешно установлено
-//    Тело ответа: "Successful connection to the database"
-//  - 500 Internal Server Error: ошибка соединения
-//    Тело ответа: {"Error": "Error opening database"} 
-//                или {"Error": "Error checking database connection"}
+//   - 200 OK: база данных доступна
+//     Тело ответа: "Successful connection to the database"
+//   - 500 Internal Server Error: хранилище не использует базу данных
+//     Тело ответа: {"Error": "Storage is not backed by a database"}
+//   - 500 Internal Server Error: ошибка соединения
+//     Тело ответа: {"Error": "Error checking database connection"}
 //
 // Пример использования:
-//  router := gin.Default()
-//  router.GET("/ping", services.CheckDBConnection)
+//
+//	router := gin.Default()
+//	router.GET("/ping", serviceHandler.CheckDBConnection)
 func (h *ServiceHandler) CheckDBConnection(c *gin.Context) {
-	db, err := database.OpenDBConnection()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Error opening database"})
+	if storage.DBConn(h.storage) == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Storage is not backed by a database"})
 		return
 	}
-	defer database.CloseDBConnection(db)
 
-	if err := db.Ping(); err != nil {
+	if err := h.storage.Ping(c.Request.Context()); err != nil {
+		zap.L().Error("Database ping failed", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Error checking database connection"})
 		return
 	}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MPoline/alert_service_yp/internal/audit"
+	"github.com/MPoline/alert_service_yp/internal/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// pingDriver - драйвер database/sql, соединения которого отвечают на Ping ошибкой err
+type pingDriver struct {
+	err error
+}
+
+func (d pingDriver) Open(name string) (driver.Conn, error) {
+	return pingConn(d), nil
+}
+
+type pingConn struct {
+	err error
+}
+
+func (c pingConn) Ping(ctx context.Context) error {
+	return c.err
+}
+
+func (c pingConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c pingConn) Close() error {
+	return nil
+}
+
+func (c pingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not implemented")
+}
+
+// pingConnector открывает соединения pingDriver
+type pingConnector struct {
+	pingDriver
+}
+
+func (c pingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.Open("")
+}
+
+func (c pingConnector) Driver() driver.Driver {
+	return c.pingDriver
+}
+
+func TestCheckDBConnection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	dbStorage := func(pingErr error) storage.Storage {
+		db := sql.OpenDB(pingConnector{pingDriver{err: pingErr}})
+		t.Cleanup(func() { db.Close() })
+		return storage.NewDBStorageWithConn(db)
+	}
+
+	tests := []struct {
+		name     string
+		storage  storage.Storage
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "memory storage",
+			storage:  storage.NewMemStorage(),
+			wantCode: http.StatusInternalServerError,
+			wantBody: "Storage is not backed by a database",
+		},
+		{
+			name:     "database available",
+			storage:  dbStorage(nil),
+			wantCode: http.StatusOK,
+			wantBody: "Successful connection to the database",
+		},
+		{
+			name:     "database behind decorators",
+			storage:  storage.NewWatchedStorage(audit.Wrap(dbStorage(nil), audit.New(&audit.FileSink{}))),
+			wantCode: http.StatusOK,
+			wantBody: "Successful connection to the database",
+		},
+		{
+			name:     "database unavailable",
+			storage:  dbStorage(driver.ErrBadConn),
+			wantCode: http.StatusInternalServerError,
+			wantBody: "Error checking database connection",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			handler := NewServiceHandler(tt.storage, nil, nil, nil, nil, nil)
+			router.GET("/ping", handler.CheckDBConnection)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+			if w.Code != tt.wantCode {
+				t.Errorf("expected status %d, got %d", tt.wantCode, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("expected body to contain %q, got %q", tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package services
 
 import (
-	"crypto/hmac"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -9,7 +8,6 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/MPoline/alert_service_yp/internal/hasher"
 	"github.com/MPoline/alert_service_yp/internal/models"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -76,24 +74,8 @@ func (h *ServiceHandler) GetMetricFromJSON(c *gin.Context) {
 		zap.L().Error("Error in read request: ", zap.Error(err))
 		return
 	}
-	hs := hasher.InitHasher("SHA256")
-	hash, err := hs.CalculateHash(data, []byte(h.key))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"Error": "Failed calculate sha256"})
-		zap.L().Error("Failed calculate sha256: ", zap.Error(err))
-		return
-	}
-
-	hashFromHeader, err := base64.StdEncoding.DecodeString(c.Request.Header.Get("HashSHA256"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"Error": "Failed to decode hash"})
-		zap.L().Error("Failed to decode hash: ", zap.Error(err))
-		return
-	}
-
-	if !(hmac.Equal(hash, hashFromHeader)) {
-		c.JSON(http.StatusBadRequest, gin.H{"Error": "Signature hash does not match"})
-		zap.L().Error("Signature hash does not match")
+	hash, ok := h.verifyRequestHash(c, data)
+	if !ok {
 		return
 	}
 
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/proto"
+	"github.com/MPoline/alert_service_yp/internal/storage"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// healthCheckInterval - период проверки готовности хранилища
+	healthCheckInterval = 5 * time.Second
+	// healthCheckTimeout - таймаут одной проверки хранилища
+	healthCheckTimeout = 2 * time.Second
+)
+
+// storageHealth публикует готовность хранилища через grpc.health.v1.Health.
+// Статус обновляется периодически, поэтому Watch работает без дополнительной логики.
+type storageHealth struct {
+	server  *health.Server
+	storage storage.Storage
+	stop    chan struct{}
+}
+
+func newStorageHealth(s storage.Storage) *storageHealth {
+	return &storageHealth{
+		server:  health.NewServer(),
+		storage: s,
+		stop:    make(chan struct{}),
+	}
+}
+
+// check проверяет хранилище и обновляет статус сервиса
+func (h *storageHealth) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	servingStatus := healthpb.HealthCheckResponse_SERVING
+	if err := h.storage.Ping(ctx); err != nil {
+		zap.L().Warn("Storage health check failed", zap.Error(err))
+		servingStatus = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	h.server.SetServingStatus("", servingStatus)
+	h.server.SetServingStatus(proto.MetricsService_ServiceDesc.ServiceName, servingStatus)
+}
+
+// run периодически проверяет хранилище до вызова Stop
+func (h *storageHealth) run() {
+	h.check()
+
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.check()
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// Stop прекращает проверки и переводит все сервисы в NOT_SERVING
+func (h *storageHealth) Stop() {
+	close(h.stop)
+	h.server.Shutdown()
+}
+
+// Ping проверяет готовность сервера и хранилища
+func (s *MetricsServer) Ping(ctx context.Context, req *proto.PingRequest) (*proto.PingResponse, error) {
+	if err := s.storage.Ping(ctx); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "storage is not ready: %v", err)
+	}
+	return &proto.PingResponse{Status: "ok"}, nil
+}
@@ -0,0 +1,495 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"expvar"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/apitoken"
+	"github.com/MPoline/alert_service_yp/internal/hasher"
+	"github.com/MPoline/alert_service_yp/internal/keyring"
+	"github.com/MPoline/alert_service_yp/internal/netutil"
+	"github.com/MPoline/alert_service_yp/internal/proto"
+	"github.com/MPoline/alert_service_yp/internal/ratelimit"
+	"github.com/MPoline/alert_service_yp/internal/replay"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// writeMethods - методы, изменяющие метрики. Для них проверяются доверенная подсеть и подпись:
+// unary запросов - signatureUnaryInterceptor, батчей StreamMetrics - обработчиком потока.
+var writeMethods = map[string]bool{
+	proto.MetricsService_UpdateMetrics_FullMethodName: true,
+	proto.MetricsService_UpdateMetric_FullMethodName:  true,
+	proto.MetricsService_StreamMetrics_FullMethodName: true,
+}
+
+// Счетчики запросов gRPC по методам, публикуются через expvar (/debug/vars)
+var (
+	grpcRequests      = expvar.NewMap("grpc_requests_total")
+	grpcErrors        = expvar.NewMap("grpc_errors_total")
+	grpcLatencyMicros = expvar.NewMap("grpc_latency_microseconds_total")
+)
+
+// clientIP возвращает IP адрес клиента, определенный clientIPUnaryInterceptor,
+// а при его отсутствии - адрес соединения
+func clientIP(ctx context.Context) string {
+	if ip := netutil.ClientIPFromContext(ctx); ip != nil {
+		return ip.String()
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// withClientIP определяет адрес клиента и сохраняет его в контексте. Метаданные
+// x-forwarded-for и x-real-ip учитываются, только если соединение установлено
+// с адреса из proxies, иначе используется адрес соединения.
+func withClientIP(ctx context.Context, proxies netutil.IPSet) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	ip := netutil.ClientIP(p.Addr.String(),
+		strings.Join(metadataValues(ctx, netutil.MetadataForwardedFor), ","),
+		metadataValue(ctx, proto.MetadataRealIP),
+		proxies)
+	if ip == nil {
+		return ctx
+	}
+	return netutil.WithClientIP(ctx, ip)
+}
+
+// clientIPUnaryInterceptor определяет адрес клиента unary запросов
+func clientIPUnaryInterceptor(proxies netutil.IPSet) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(withClientIP(ctx, proxies), req)
+	}
+}
+
+// clientIPStreamInterceptor определяет адрес клиента потоковых запросов
+func clientIPStreamInterceptor(proxies netutil.IPSet) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: withClientIP(ss.Context(), proxies)})
+	}
+}
+
+// recoveryUnaryInterceptor превращает панику в обработчике в ошибку Internal
+func recoveryUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			zap.L().Error("Panic in gRPC handler",
+				zap.String("method", info.FullMethod),
+				zap.Any("panic", r),
+				zap.Stack("stack"))
+			err = status.Error(codes.Internal, "internal server error")
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+// recoveryStreamInterceptor превращает панику в потоковом обработчике в ошибку Internal
+func recoveryStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			zap.L().Error("Panic in gRPC stream handler",
+				zap.String("method", info.FullMethod),
+				zap.Any("panic", r),
+				zap.Stack("stack"))
+			err = status.Error(codes.Internal, "internal server error")
+		}
+	}()
+
+	return handler(srv, ss)
+}
+
+// logRequest пишет access-лог запроса
+func logRequest(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	fields := []zap.Field{
+		zap.String("method", method),
+		zap.String("client_ip", clientIP(ctx)),
+		zap.String("code", code.String()),
+		zap.Duration("duration", time.Since(start)),
+	}
+
+	if err != nil && code != codes.Canceled {
+		zap.L().Warn("gRPC request failed", append(fields, zap.Error(err))...)
+		return
+	}
+	zap.L().Info("gRPC request", fields...)
+}
+
+// loggingUnaryInterceptor пишет access-лог unary запросов
+func loggingUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logRequest(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+// loggingStreamInterceptor пишет access-лог потоковых запросов по их завершении
+func loggingStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logRequest(ss.Context(), info.FullMethod, start, err)
+	return err
+}
+
+// observeRequest обновляет счетчики запросов, ошибок и суммарной длительности
+func observeRequest(method string, start time.Time, err error) {
+	grpcRequests.Add(method, 1)
+	grpcLatencyMicros.Add(method, time.Since(start).Microseconds())
+	if err != nil {
+		grpcErrors.Add(method+":"+status.Code(err).String(), 1)
+	}
+}
+
+// metricsUnaryInterceptor считает unary запросы, ошибки и задержки
+func metricsUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observeRequest(info.FullMethod, start, err)
+	return resp, err
+}
+
+// metricsStreamInterceptor считает потоковые запросы, ошибки и длительность потоков
+func metricsStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observeRequest(info.FullMethod, start, err)
+	return err
+}
+
+// checkTrustedSubnet проверяет, что клиент изменяющего метода находится в одной из доверенных подсетей
+func checkTrustedSubnet(ctx context.Context, method string, trusted netutil.IPSet) error {
+	if len(trusted) == 0 || !writeMethods[method] {
+		return nil
+	}
+
+	ip := net.ParseIP(clientIP(ctx))
+	if ip == nil {
+		return status.Error(codes.PermissionDenied, "client IP address is unknown")
+	}
+	if !trusted.Contains(ip) {
+		zap.L().Warn("IP address not in trusted subnet",
+			zap.String("ip", ip.String()),
+			zap.String("trusted_subnet", trusted.String()),
+			zap.String("method", method))
+		return status.Error(codes.PermissionDenied, "access denied - IP not in trusted subnet")
+	}
+	return nil
+}
+
+// trustedSubnetUnaryInterceptor ограничивает изменяющие unary методы доверенными подсетями.
+// Пустой набор подсетей отключает проверку.
+func trustedSubnetUnaryInterceptor(trusted netutil.IPSet) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := checkTrustedSubnet(ctx, info.FullMethod, trusted); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// trustedSubnetStreamInterceptor ограничивает изменяющие потоковые методы доверенными подсетями
+func trustedSubnetStreamInterceptor(trusted netutil.IPSet) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkTrustedSubnet(ss.Context(), info.FullMethod, trusted); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// requiredRole возвращает роль токена, необходимую для метода. Изменяющие методы требуют
+// роль write, остальные методы MetricsService - read. Ping и сервисы вне MetricsService
+// (проверка здоровья, reflection) доступны без токена.
+func requiredRole(method string) (apitoken.Role, bool) {
+	if writeMethods[method] {
+		return apitoken.RoleWrite, true
+	}
+	if method == proto.MetricsService_Ping_FullMethodName ||
+		!strings.HasPrefix(method, "/"+proto.MetricsService_ServiceDesc.ServiceName+"/") {
+		return "", false
+	}
+	return apitoken.RoleRead, true
+}
+
+// checkToken проверяет токен из метаданных authorization и возвращает контекст
+// с владельцем токена
+func checkToken(ctx context.Context, method string, auth *apitoken.Authenticator) (context.Context, error) {
+	role, ok := requiredRole(method)
+	if !auth.Enabled() || !ok {
+		return ctx, nil
+	}
+
+	identity, err := auth.Authorize(metadataValue(ctx, apitoken.MetadataAuthorization), role)
+	if err != nil {
+		zap.L().Warn("gRPC request API token rejected",
+			zap.String("method", method),
+			zap.String("token", identity.Name),
+			zap.String("client_ip", clientIP(ctx)),
+			zap.Error(err))
+		if errors.Is(err, apitoken.ErrForbidden) {
+			return ctx, status.Error(codes.PermissionDenied, "access denied - insufficient token role")
+		}
+		return ctx, status.Error(codes.Unauthenticated, "valid API token required")
+	}
+	return apitoken.WithIdentity(ctx, identity), nil
+}
+
+// tokenUnaryInterceptor проверяет токен и роль unary запросов. nil отключает проверку.
+func tokenUnaryInterceptor(auth *apitoken.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := checkToken(ctx, info.FullMethod, auth)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// tokenStreamInterceptor проверяет токен и роль при открытии потока
+func tokenStreamInterceptor(auth *apitoken.Authenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := checkToken(ss.Context(), info.FullMethod, auth)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// contextServerStream подменяет контекст потока, чтобы передать обработчику
+// данные, добавленные перехватчиками
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// rateLimitKey возвращает ключ клиента для ограничения частоты запросов. При byAgent
+// клиенты различаются по имени проверенного токена API или по идентификатору агента,
+// подпись которого проверена, иначе - по IP адресу. Идентификатор из метаданных
+// x-agent-id до проверки подписи не используется: его может подставить любой клиент.
+func rateLimitKey(ctx context.Context, byAgent bool) string {
+	if byAgent {
+		if identity, ok := apitoken.IdentityFromContext(ctx); ok && identity.Name != "" {
+			return "token:" + identity.Name
+		}
+		if agentID := agentkey.AgentIDFromContext(ctx); agentID != "" {
+			return "agent:" + agentID
+		}
+	}
+	return "ip:" + clientIP(ctx)
+}
+
+// checkRateLimit забирает токен из корзины клиента. При превышении возвращает
+// ResourceExhausted и передает время ожидания в метаданных retry-after.
+func checkRateLimit(ctx context.Context, method string, limiter *ratelimit.Limiter, key string) error {
+	ok, wait := limiter.Allow(key)
+	if ok {
+		return nil
+	}
+
+	retryAfter := ratelimit.RetryAfter(wait)
+	zap.L().Warn("gRPC rate limit exceeded",
+		zap.String("method", method),
+		zap.String("client", key),
+		zap.Int("retry_after", retryAfter))
+	_ = grpc.SetHeader(ctx, metadata.Pairs(proto.MetadataRetryAfter, strconv.Itoa(retryAfter)))
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %d seconds", retryAfter)
+}
+
+// rateLimitUnaryInterceptor ограничивает частоту изменяющих unary запросов каждого клиента.
+// Подключается после signatureUnaryInterceptor, чтобы различать агентов по проверенной
+// подписи. nil limiter отключает ограничение.
+func rateLimitUnaryInterceptor(limiter *ratelimit.Limiter, byAgent bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !limiter.Enabled() || !writeMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		if err := checkRateLimit(ctx, info.FullMethod, limiter, rateLimitKey(ctx, byAgent)); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// rateLimitStreamInterceptor ограничивает частоту сообщений в изменяющих потоках:
+// каждое полученное сообщение расходует токен клиента, при превышении поток завершается
+// с ошибкой ResourceExhausted. Подписи батчей проверяются обработчиком потока,
+// поэтому потоки различаются по токену API или IP адресу.
+func rateLimitStreamInterceptor(limiter *ratelimit.Limiter, byAgent bool) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !limiter.Enabled() || !writeMethods[info.FullMethod] {
+			return handler(srv, ss)
+		}
+		return handler(srv, &rateLimitedServerStream{
+			ServerStream: ss,
+			method:       info.FullMethod,
+			limiter:      limiter,
+			key:          rateLimitKey(ss.Context(), byAgent),
+		})
+	}
+}
+
+// rateLimitedServerStream расходует токен клиента на каждое полученное сообщение
+type rateLimitedServerStream struct {
+	grpc.ServerStream
+	method  string
+	limiter *ratelimit.Limiter
+	key     string
+}
+
+func (s *rateLimitedServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return checkRateLimit(s.Context(), s.method, s.limiter, s.key)
+}
+
+// signatureUnaryInterceptor проверяет подпись изменяющих unary запросов: ключом Ed25519 агента
+// из метаданных x-agent-id и x-signature, если задан каталог ключей агентов, иначе секретом
+// HMAC из метаданных hashsha256 и x-key-id. Время и nonce из x-timestamp и x-nonce входят
+// в подпись и после ее проверки передаются защите от повтора guard. Без секретов HMAC
+// и ключей агентов проверка не выполняется. Подпись отдельных метрик проверяется обработчиками.
+// У потоков нет подписанного запроса: каждый батч StreamMetrics проверяется обработчиком.
+func signatureUnaryInterceptor(keys *keyring.Keyring, agents *agentkey.Registry, guard *replay.Guard) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !writeMethods[info.FullMethod] || (!keys.HMACEnabled() && !agents.Enabled()) {
+			return handler(ctx, req)
+		}
+
+		msg, ok := req.(protobuf.Message)
+		if !ok {
+			return nil, status.Error(codes.Internal, "unexpected request type")
+		}
+
+		data, err := proto.SignatureData(msg)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to verify request signature: %v", err)
+		}
+
+		timestamp := metadataValue(ctx, replay.MetadataTimestamp)
+		nonce := metadataValue(ctx, replay.MetadataNonce)
+		signed := replay.SignedData(timestamp, nonce, data)
+
+		if agents.Enabled() {
+			agentID := agentIDFromContext(ctx)
+			if err := verifyAgentMetadata(ctx, agents, signed); err != nil {
+				zap.L().Warn("gRPC request agent signature verification failed",
+					zap.String("method", info.FullMethod),
+					zap.String("agent_id", agentID),
+					zap.String("client_ip", clientIP(ctx)),
+					zap.Error(err))
+				return nil, err
+			}
+			ctx = agentkey.WithAgentID(ctx, agentID)
+		} else if err := verifyHMACMetadata(ctx, keys, signed); err != nil {
+			zap.L().Warn("gRPC request signature mismatch",
+				zap.String("method", info.FullMethod),
+				zap.String("key_id", keyIDFromContext(ctx)),
+				zap.String("client_ip", clientIP(ctx)),
+				zap.Error(err))
+			return nil, err
+		}
+
+		if err := guard.Check(timestamp, nonce); err != nil {
+			zap.L().Warn("gRPC request rejected by replay protection",
+				zap.String("method", info.FullMethod),
+				zap.String("client_ip", clientIP(ctx)),
+				zap.Error(err))
+			return nil, status.Error(replayCode(err), err.Error())
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// verifyHMACMetadata проверяет подпись HMAC данных data из метаданных запроса
+func verifyHMACMetadata(ctx context.Context, keys *keyring.Keyring, data []byte) error {
+	received := metadataValue(ctx, proto.MetadataHash)
+	if received == "" {
+		return status.Error(codes.Unauthenticated, "request signature is missing")
+	}
+
+	receivedHash, err := base64.StdEncoding.DecodeString(received)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, "malformed request signature")
+	}
+
+	_, err = keys.VerifyHMAC(keyIDFromContext(ctx), hashAlgFromContext(ctx), data, receivedHash)
+	if errors.Is(err, hasher.ErrUnknownAlgorithm) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return status.Error(codes.Unauthenticated, "request signature does not match")
+	}
+	return nil
+}
+
+// verifyAgentMetadata проверяет подпись Ed25519 данных data ключом агента из метаданных запроса
+func verifyAgentMetadata(ctx context.Context, agents *agentkey.Registry, data []byte) error {
+	signature, err := base64.StdEncoding.DecodeString(metadataValue(ctx, agentkey.MetadataSignature))
+	if err != nil {
+		return status.Error(codes.Unauthenticated, "malformed agent signature")
+	}
+	if err := agents.Verify(agentIDFromContext(ctx), data, signature); err != nil {
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return nil
+}
+
+// metadataValue возвращает первое значение ключа метаданных входящего запроса
+func metadataValue(ctx context.Context, key string) string {
+	if values := metadataValues(ctx, key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// metadataValues возвращает все значения ключа метаданных входящего запроса
+func metadataValues(ctx context.Context, key string) []string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		return md.Get(key)
+	}
+	return nil
+}
+
+// keyIDFromContext возвращает идентификатор секрета HMAC из метаданных x-key-id
+func keyIDFromContext(ctx context.Context) string {
+	return metadataValue(ctx, proto.MetadataKeyID)
+}
+
+// hashAlgFromContext возвращает алгоритм подписи из метаданных x-hash-alg
+func hashAlgFromContext(ctx context.Context) string {
+	return metadataValue(ctx, proto.MetadataHashAlg)
+}
+
+// agentIDFromContext возвращает идентификатор агента из метаданных x-agent-id
+func agentIDFromContext(ctx context.Context) string {
+	return metadataValue(ctx, agentkey.MetadataAgentID)
+}
@@ -0,0 +1,415 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/apitoken"
+	"github.com/MPoline/alert_service_yp/internal/config"
+	"github.com/MPoline/alert_service_yp/internal/hasher"
+	"github.com/MPoline/alert_service_yp/internal/keyring"
+	"github.com/MPoline/alert_service_yp/internal/netutil"
+	"github.com/MPoline/alert_service_yp/internal/proto"
+	"github.com/MPoline/alert_service_yp/internal/ratelimit"
+	"github.com/MPoline/alert_service_yp/internal/replay"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func okHandler(ctx context.Context, req any) (any, error) {
+	return "ok", nil
+}
+
+func TestRecoveryUnaryInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: proto.MetricsService_UpdateMetrics_FullMethodName}
+	_, err := recoveryUnaryInterceptor(context.Background(), nil, info, func(ctx context.Context, req any) (any, error) {
+		panic("boom")
+	})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("expected Internal after panic, got %v", err)
+	}
+}
+
+// peerContext возвращает контекст входящего запроса с адресом соединения ip
+func peerContext(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 50000}})
+}
+
+func TestTrustedSubnetUnaryInterceptor(t *testing.T) {
+	trusted, err := netutil.ParseIPSet("10.0.0.0/8, fd00::/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	interceptor := trustedSubnetUnaryInterceptor(trusted)
+
+	tests := []struct {
+		name   string
+		method string
+		ip     string
+		want   codes.Code
+	}{
+		{"trusted write", proto.MetricsService_UpdateMetrics_FullMethodName, "10.1.2.3", codes.OK},
+		{"untrusted write", proto.MetricsService_UpdateMetrics_FullMethodName, "192.168.1.1", codes.PermissionDenied},
+		{"trusted ipv6 write", proto.MetricsService_UpdateMetrics_FullMethodName, "fd00::5", codes.OK},
+		{"untrusted ipv6 write", proto.MetricsService_UpdateMetrics_FullMethodName, "2001:db8::1", codes.PermissionDenied},
+		{"missing ip", proto.MetricsService_UpdateMetric_FullMethodName, "", codes.PermissionDenied},
+		{"untrusted read", proto.MetricsService_GetMetric_FullMethodName, "192.168.1.1", codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.ip != "" {
+				ctx = peerContext(tt.ip)
+			}
+
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, okHandler)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("expected %s, got %s (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestHMACUnaryInterceptor(t *testing.T) {
+	const key = "secret"
+	keys, err := keyring.New("", key, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	interceptor := signatureUnaryInterceptor(keys, nil, nil)
+	info := &grpc.UnaryServerInfo{FullMethod: proto.MetricsService_UpdateMetrics_FullMethodName}
+	req := &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "Alloc", Mtype: "gauge", Value: 1}}}
+
+	valid, err := proto.RequestSignature(req, key, "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid, _ := proto.RequestSignature(req, "other", "", "", "")
+
+	tests := []struct {
+		name      string
+		signature string
+		want      codes.Code
+	}{
+		{"valid", valid, codes.OK},
+		{"wrong key", invalid, codes.Unauthenticated},
+		{"missing", "", codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.signature != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(proto.MetadataHash, tt.signature))
+			}
+
+			_, err := interceptor(ctx, req, info, okHandler)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("expected %s, got %s (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestHMACUnaryInterceptorReplay(t *testing.T) {
+	const key = "secret"
+	keys, err := keyring.New("", key, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	interceptor := signatureUnaryInterceptor(keys, nil, replay.NewGuard(time.Minute, 10))
+	info := &grpc.UnaryServerInfo{FullMethod: proto.MetricsService_UpdateMetrics_FullMethodName}
+	req := &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "Alloc", Mtype: "gauge", Value: 1}}}
+
+	signedContext := func(timestamp, nonce string) context.Context {
+		signature, err := proto.RequestSignature(req, key, "", timestamp, nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+			proto.MetadataHash, signature,
+			replay.MetadataTimestamp, timestamp,
+			replay.MetadataNonce, nonce))
+	}
+
+	now := replay.Timestamp(time.Now())
+	expired := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{"fresh", signedContext(now, "nonce-1"), codes.OK},
+		{"replayed", signedContext(now, "nonce-1"), codes.AlreadyExists},
+		{"expired", signedContext(expired, "nonce-2"), codes.Unauthenticated},
+		{"without nonce", signedContext("", ""), codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := interceptor(tt.ctx, req, info, okHandler)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("expected %s, got %s (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestHMACUnaryInterceptorAlgorithm(t *testing.T) {
+	const key = "secret"
+	keys, err := keyring.New("", key, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	interceptor := signatureUnaryInterceptor(keys, nil, nil)
+	info := &grpc.UnaryServerInfo{FullMethod: proto.MetricsService_UpdateMetrics_FullMethodName}
+	req := &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "Alloc", Mtype: "gauge", Value: 1}}}
+
+	sha512Signature, err := proto.RequestSignature(req, key, hasher.SHA512, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		alg  string
+		want codes.Code
+	}{
+		{"announced algorithm", hasher.SHA512, codes.OK},
+		{"default algorithm", "", codes.Unauthenticated},
+		{"unknown algorithm", "md5", codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := metadata.Pairs(proto.MetadataHash, sha512Signature)
+			if tt.alg != "" {
+				md.Set(proto.MetadataHashAlg, tt.alg)
+			}
+
+			_, err := interceptor(metadata.NewIncomingContext(context.Background(), md), req, info, okHandler)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("expected %s, got %s (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+// newTestAgentRegistry создает каталог с ключом агента agentID и возвращает его
+// вместе с закрытым ключом агента
+func newTestAgentRegistry(t *testing.T, agentID string) (*agentkey.Registry, ed25519.PrivateKey) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, agentID+".pem"), pemData, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	agents, err := agentkey.NewRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return agents, priv
+}
+
+func TestSignatureUnaryInterceptorAgentKeys(t *testing.T) {
+	agents, priv := newTestAgentRegistry(t, "web-01")
+	keys, err := keyring.New("", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	interceptor := signatureUnaryInterceptor(keys, agents, nil)
+	info := &grpc.UnaryServerInfo{FullMethod: proto.MetricsService_UpdateMetrics_FullMethodName}
+	req := &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{{Id: "Alloc", Mtype: "gauge", Value: 1}}}
+
+	data, err := proto.SignatureData(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, replay.SignedData("", "", data)))
+
+	tests := []struct {
+		name      string
+		agentID   string
+		signature string
+		want      codes.Code
+	}{
+		{"valid signature", "web-01", signature, codes.OK},
+		{"unknown agent", "web-02", signature, codes.Unauthenticated},
+		{"wrong signature", "web-01", base64.StdEncoding.EncodeToString(make([]byte, ed25519.SignatureSize)), codes.Unauthenticated},
+		{"missing signature", "web-01", "", codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := metadata.Pairs(agentkey.MetadataAgentID, tt.agentID)
+			if tt.signature != "" {
+				md.Set(agentkey.MetadataSignature, tt.signature)
+			}
+
+			handler := func(ctx context.Context, req any) (any, error) {
+				if got := agentkey.AgentIDFromContext(ctx); got != tt.agentID {
+					t.Errorf("expected agent %q in context, got %q", tt.agentID, got)
+				}
+				return "ok", nil
+			}
+
+			_, err := interceptor(metadata.NewIncomingContext(context.Background(), md), req, info, handler)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("expected %s, got %s (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestTokenUnaryInterceptor(t *testing.T) {
+	auth, err := apitoken.New([]config.APIToken{
+		{Name: "grafana", Role: "read", Hash: apitoken.HashToken("read-token")},
+		{Name: "agents", Role: "write", Hash: apitoken.HashToken("write-token")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	interceptor := tokenUnaryInterceptor(auth)
+
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		want   codes.Code
+	}{
+		{"write with write token", proto.MetricsService_UpdateMetrics_FullMethodName, "write-token", codes.OK},
+		{"write with read token", proto.MetricsService_UpdateMetrics_FullMethodName, "read-token", codes.PermissionDenied},
+		{"read with read token", proto.MetricsService_GetMetric_FullMethodName, "read-token", codes.OK},
+		{"read without token", proto.MetricsService_GetMetric_FullMethodName, "", codes.Unauthenticated},
+		{"read with unknown token", proto.MetricsService_ListMetrics_FullMethodName, "other", codes.Unauthenticated},
+		{"ping without token", proto.MetricsService_Ping_FullMethodName, "", codes.OK},
+		{"health without token", "/grpc.health.v1.Health/Check", "", codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := metadata.MD{}
+			if tt.token != "" {
+				md.Set(apitoken.MetadataAuthorization, apitoken.Bearer(tt.token))
+			}
+			info := &grpc.UnaryServerInfo{FullMethod: tt.method}
+
+			_, err := interceptor(metadata.NewIncomingContext(context.Background(), md), nil, info, okHandler)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("expected %s, got %s (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestClientIPUnaryInterceptor(t *testing.T) {
+	proxies, err := netutil.ParseIPSet("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	interceptor := clientIPUnaryInterceptor(proxies)
+	info := &grpc.UnaryServerInfo{FullMethod: proto.MetricsService_UpdateMetrics_FullMethodName}
+
+	tests := []struct {
+		name string
+		peer string
+		md   metadata.MD
+		want string
+	}{
+		{"direct client", "192.168.1.1", nil, "192.168.1.1"},
+		{"spoofed real ip", "192.168.1.1", metadata.Pairs(proto.MetadataRealIP, "10.1.2.3"), "192.168.1.1"},
+		{"proxy real ip", "10.0.0.1", metadata.Pairs(proto.MetadataRealIP, "10.1.2.3"), "10.1.2.3"},
+		{"proxy forwarded for", "10.0.0.1", metadata.Pairs(netutil.MetadataForwardedFor, "203.0.113.5, 10.1.2.3"), "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := peerContext(tt.peer)
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+
+			var got string
+			_, err := interceptor(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+				got = clientIP(ctx)
+				return nil, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected client IP %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRateLimitUnaryInterceptor(t *testing.T) {
+	interceptor := rateLimitUnaryInterceptor(ratelimit.New(1, 1), false)
+	write := &grpc.UnaryServerInfo{FullMethod: proto.MetricsService_UpdateMetrics_FullMethodName}
+	read := &grpc.UnaryServerInfo{FullMethod: proto.MetricsService_GetMetric_FullMethodName}
+
+	ctx := peerContext("10.0.0.1")
+	if _, err := interceptor(ctx, nil, write, okHandler); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	if _, err := interceptor(ctx, nil, write, okHandler); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted, got %v", err)
+	}
+	if _, err := interceptor(ctx, nil, read, okHandler); err != nil {
+		t.Errorf("read methods are not limited: %v", err)
+	}
+	if _, err := interceptor(peerContext("10.0.0.2"), nil, write, okHandler); err != nil {
+		t.Errorf("other client: %v", err)
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	unverified := metadata.NewIncomingContext(peerContext("10.0.0.1"),
+		metadata.Pairs(agentkey.MetadataAgentID, "web-01"))
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		byAgent bool
+		want    string
+	}{
+		{"by ip", agentkey.WithAgentID(unverified, "web-01"), false, "ip:10.0.0.1"},
+		{"unverified agent id", unverified, true, "ip:10.0.0.1"},
+		{"verified agent id", agentkey.WithAgentID(unverified, "web-01"), true, "agent:web-01"},
+		{"token", apitoken.WithIdentity(unverified, apitoken.Identity{Name: "ci", Role: apitoken.RoleWrite}), true, "token:ci"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rateLimitKey(tt.ctx, tt.byAgent); got != tt.want {
+				t.Errorf("expected key %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"strings"
+
+	"github.com/MPoline/alert_service_yp/internal/models"
+	"github.com/MPoline/alert_service_yp/internal/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultPageSize - размер страницы ListMetrics по умолчанию
+	defaultPageSize = 100
+	// maxPageSize - максимальный размер страницы ListMetrics
+	maxPageSize = 1000
+	// watchBuffer - размер буфера обновлений для одного WatchMetrics
+	watchBuffer = 256
+)
+
+// MetricWatcher - хранилище, поддерживающее подписку на обновления метрик
+type MetricWatcher interface {
+	Subscribe(buffer int) (<-chan models.Metrics, func())
+}
+
+// GetMetric возвращает текущее значение метрики
+func (s *MetricsServer) GetMetric(ctx context.Context, req *proto.GetMetricRequest) (*proto.GetMetricResponse, error) {
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "metric id is required")
+	}
+	if req.GetMtype() != "gauge" && req.GetMtype() != "counter" {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown metric type: %s", req.GetMtype())
+	}
+
+	metric, err := s.storage.GetMetric(ctx, req.GetMtype(), req.GetId())
+	if err != nil {
+		switch err.Error() {
+		case "NotFound", "MetricNotFound":
+			return nil, status.Errorf(codes.NotFound, "metric %s not found", req.GetId())
+		case "Unknown":
+			return nil, status.Errorf(codes.InvalidArgument, "unknown metric type: %s", req.GetMtype())
+		default:
+			return nil, status.Errorf(codes.Internal, "failed to get metric: %v", err)
+		}
+	}
+
+	return &proto.GetMetricResponse{Metric: modelToProto(metric)}, nil
+}
+
+// ListMetrics возвращает метрики, отсортированные по имени и типу, постранично.
+// page_token - непрозрачный курсор из next_page_token предыдущего ответа.
+func (s *MetricsServer) ListMetrics(ctx context.Context, req *proto.ListMetricsRequest) (*proto.ListMetricsResponse, error) {
+	pageSize := int(req.GetPageSize())
+	switch {
+	case pageSize < 0:
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	case pageSize == 0:
+		pageSize = defaultPageSize
+	case pageSize > maxPageSize:
+		pageSize = maxPageSize
+	}
+
+	var after string
+	if req.GetPageToken() != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(req.GetPageToken())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		after = string(decoded)
+	}
+
+	all, err := s.storage.GetAllMetrics(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list metrics: %v", err)
+	}
+
+	var metrics []models.Metrics
+	for _, m := range all {
+		if strings.HasPrefix(m.ID, req.GetPrefix()) && (after == "" || metricCursor(m) > after) {
+			metrics = append(metrics, m)
+		}
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metricCursor(metrics[i]) < metricCursor(metrics[j])
+	})
+
+	resp := &proto.ListMetricsResponse{}
+	if len(metrics) > pageSize {
+		metrics = metrics[:pageSize]
+		resp.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(metricCursor(metrics[pageSize-1])))
+	}
+
+	for _, m := range metrics {
+		resp.Metrics = append(resp.Metrics, modelToProto(m))
+	}
+	return resp, nil
+}
+
+// WatchMetrics отправляет клиенту обновления метрик по мере их применения к хранилищу.
+// При send_initial сначала отправляются текущие значения всех подходящих метрик.
+func (s *MetricsServer) WatchMetrics(req *proto.WatchMetricsRequest, stream proto.MetricsService_WatchMetricsServer) error {
+	watcher, ok := s.storage.(MetricWatcher)
+	if !ok {
+		return status.Error(codes.Unimplemented, "storage does not support watching")
+	}
+
+	ctx := stream.Context()
+	prefix := req.GetPrefix()
+
+	// Подписка до чтения текущих значений, чтобы не потерять обновления между ними
+	updates, unsubscribe := watcher.Subscribe(watchBuffer)
+	defer unsubscribe()
+
+	if req.GetSendInitial() {
+		all, err := s.storage.GetAllMetrics(ctx)
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to list metrics: %v", err)
+		}
+		sort.Slice(all, func(i, j int) bool {
+			return metricCursor(all[i]) < metricCursor(all[j])
+		})
+
+		for _, m := range all {
+			if !strings.HasPrefix(m.ID, prefix) {
+				continue
+			}
+			if err := stream.Send(modelToProto(m)); err != nil {
+				return err
+			}
+		}
+	}
+
+	zap.L().Info("Metrics watcher subscribed", zap.String("prefix", prefix))
+	defer zap.L().Info("Metrics watcher unsubscribed", zap.String("prefix", prefix))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case m, ok := <-updates:
+			if !ok {
+				return nil
+			}
+			if !strings.HasPrefix(m.ID, prefix) {
+				continue
+			}
+			if err := stream.Send(modelToProto(m)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// metricCursor возвращает ключ сортировки и пагинации метрики
+func metricCursor(m models.Metrics) string {
+	return m.ID + "\x00" + m.MType
+}
+
+// modelToProto преобразует модель хранилища в protobuf метрику
+func modelToProto(m models.Metrics) *proto.Metric {
+	metric := &proto.Metric{
+		Id:    m.ID,
+		Mtype: m.MType,
+	}
+	if m.Delta != nil {
+		metric.Delta = *m.Delta
+	}
+	if m.Value != nil {
+		metric.Value = *m.Value
+	}
+	return metric
+}
@@ -2,52 +2,113 @@ package services
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/rsa"
-	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
+	"time"
 
-	"github.com/MPoline/alert_service_yp/internal/crypto"
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/apitoken"
+	"github.com/MPoline/alert_service_yp/internal/audit"
+	"github.com/MPoline/alert_service_yp/internal/config"
+	"github.com/MPoline/alert_service_yp/internal/keyring"
 	"github.com/MPoline/alert_service_yp/internal/models"
+	"github.com/MPoline/alert_service_yp/internal/netutil"
 	"github.com/MPoline/alert_service_yp/internal/proto"
+	"github.com/MPoline/alert_service_yp/internal/ratelimit"
+	"github.com/MPoline/alert_service_yp/internal/replay"
 	"github.com/MPoline/alert_service_yp/internal/server/flags"
 	"github.com/MPoline/alert_service_yp/internal/storage"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 )
 
 // MetricsServer реализует gRPC сервер для метрик
 type MetricsServer struct {
 	proto.UnimplementedMetricsServiceServer
-	privKey *rsa.PrivateKey
-	key     string
-	storage storage.Storage
+	keys         *keyring.Keyring
+	replayGuard  *replay.Guard
+	agents       *agentkey.Registry
+	storage      storage.Storage
+	agentConfigs *config.AgentConfigSet
 }
 
 var (
 	grpcServer    *grpc.Server
 	metricsServer *MetricsServer
+	healthChecker *storageHealth
 )
 
-// InitGRPCServer инициализирует и запускает gRPC сервер
-func InitGRPCServer(privKey *rsa.PrivateKey, key string, storage storage.Storage) error {
+// InitGRPCServer инициализирует и запускает gRPC сервер.
+// Если tlsConfig не nil, сервер принимает только TLS соединения.
+// Если tokens не nil, методы требуют токен с ролью в метаданных authorization.
+// Изменяющие методы доступны только клиентам из trustedSubnets, если они заданы,
+// адрес клиента берется из метаданных прокси только для соединений от trustedProxies.
+// Если limiter не nil, частота изменяющих запросов ограничивается для каждого клиента.
+func InitGRPCServer(keys *keyring.Keyring, replayGuard *replay.Guard, agents *agentkey.Registry, tokens *apitoken.Authenticator, trustedSubnets, trustedProxies netutil.IPSet, limiter *ratelimit.Limiter, storage storage.Storage, agentConfigs *config.AgentConfigSet, tlsConfig *tls.Config) error {
 	metricsServer = &MetricsServer{
-		privKey: privKey,
-		key:     key,
-		storage: storage,
+		keys:         keys,
+		replayGuard:  replayGuard,
+		agents:       agents,
+		storage:      storage,
+		agentConfigs: agentConfigs,
 	}
 
-	grpcServer = grpc.NewServer(
-		grpc.UnaryInterceptor(metricsServer.unaryInterceptor),
-	)
+	rateLimitByAgent := flags.FlagRateLimitKey == flags.RateLimitKeyAgent
+
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			recoveryUnaryInterceptor,
+			clientIPUnaryInterceptor(trustedProxies),
+			loggingUnaryInterceptor,
+			metricsUnaryInterceptor,
+			trustedSubnetUnaryInterceptor(trustedSubnets),
+			tokenUnaryInterceptor(tokens),
+			signatureUnaryInterceptor(keys, agents, replayGuard),
+			rateLimitUnaryInterceptor(limiter, rateLimitByAgent),
+		),
+		grpc.ChainStreamInterceptor(
+			recoveryStreamInterceptor,
+			clientIPStreamInterceptor(trustedProxies),
+			loggingStreamInterceptor,
+			metricsStreamInterceptor,
+			trustedSubnetStreamInterceptor(trustedSubnets),
+			tokenStreamInterceptor(tokens),
+			// Подпись потока проверяется не перехватчиком, а для каждого батча
+			// в StreamMetrics (verifyBatch): подписывается батч, а не открытие потока
+			rateLimitStreamInterceptor(limiter, rateLimitByAgent),
+		),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	// Ограничение применяется и к размеру распакованного сообщения
+	if flags.FlagMaxDecompressedSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(int(flags.FlagMaxDecompressedSize)))
+	}
+
+	grpcServer = grpc.NewServer(opts...)
 
 	proto.RegisterMetricsServiceServer(grpcServer, metricsServer)
 
+	healthChecker = newStorageHealth(storage)
+	healthpb.RegisterHealthServer(grpcServer, healthChecker.server)
+	go healthChecker.run()
+
+	if flags.FlagGRPCReflection {
+		reflection.Register(grpcServer)
+		zap.L().Info("gRPC server reflection enabled")
+	}
+
 	lis, err := net.Listen("tcp", flags.FlagGRPCAddress)
 	if err != nil {
 		return fmt.Errorf("failed to listen on %s: %w", flags.FlagGRPCAddress, err)
@@ -63,61 +124,244 @@ func InitGRPCServer(privKey *rsa.PrivateKey, key string, storage storage.Storage
 	return nil
 }
 
+// grpcStopTimeout - время ожидания завершения активных запросов при остановке.
+// Долгоживущие потоки (WatchMetrics, StreamMetrics) прерываются по его истечении.
+const grpcStopTimeout = 5 * time.Second
+
 // StopGRPCServer останавливает gRPC сервер
 func StopGRPCServer() {
 	if grpcServer != nil {
 		zap.L().Info("Stopping gRPC server gracefully...")
-		grpcServer.GracefulStop()
-		zap.L().Info("gRPC server stopped")
-	}
-}
 
-// unaryInterceptor перехватчик для обработки аутентификации и валидации
-func (s *MetricsServer) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	zap.L().Debug("gRPC request",
-		zap.String("method", info.FullMethod),
-		zap.Any("request", req))
+		if healthChecker != nil {
+			healthChecker.Stop()
+		}
 
-	return handler(ctx, req)
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-time.After(grpcStopTimeout):
+			zap.L().Warn("gRPC graceful stop timed out, closing active streams")
+			grpcServer.Stop()
+		}
+		zap.L().Info("gRPC server stopped")
+	}
 }
 
-// UpdateMetrics обработчик для массового обновления метрик
+// UpdateMetrics обработчик для массового обновления метрик.
+// В ответе возвращается результат по каждой метрике. Если не применена ни одна
+// метрика, возвращается ошибка с кодом первой неудачи и ответом в деталях статуса.
+// Поле Error заполняется для совместимости со старыми агентами.
 func (s *MetricsServer) UpdateMetrics(ctx context.Context, req *proto.UpdateMetricsRequest) (*proto.UpdateMetricsResponse, error) {
 	if req == nil || req.Metrics == nil {
 		return nil, status.Error(codes.InvalidArgument, "empty request")
 	}
 
-	var errors []string
+	results, applied := s.applyMetrics(audit.WithTransport(ctx, audit.TransportGRPC), req.Metrics)
+	resp := &proto.UpdateMetricsResponse{Results: results}
+
+	failures := failedResults(results)
+	if len(failures) == 0 {
+		zap.L().Info("Metrics processed successfully via gRPC",
+			zap.Int("metrics_count", len(req.Metrics)),
+			zap.String("agent_id", agentkey.AgentIDFromContext(ctx)))
+		return resp, nil
+	}
+
+	resp.Error = fmt.Sprintf("failed to process %d metrics: %v", len(failures), failures)
+	if applied == 0 {
+		return nil, statusWithResponse(failureCode(results), resp.Error, resp)
+	}
+
+	zap.L().Warn("Metrics partially processed via gRPC",
+		zap.Int("applied", applied),
+		zap.Int("failed", len(failures)))
+	return resp, nil
+}
+
+// StreamMetrics принимает батчи метрик через двунаправленный поток
+// и подтверждает каждый батч его порядковым номером. Подпись и защита от повтора
+// проверяются для каждого батча до его обработки.
+func (s *MetricsServer) StreamMetrics(stream proto.MetricsService_StreamMetricsServer) error {
+	ctx := stream.Context()
+
+	// Подписи батчей проверены ключом агента из метаданных, поэтому
+	// агент известен журналу аудита только при включенных ключах агентов
+	auditCtx := audit.WithTransport(ctx, audit.TransportGRPCStream)
+	if s.agents.Enabled() {
+		auditCtx = agentkey.WithAgentID(auditCtx, agentIDFromContext(ctx))
+	}
+
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Батч без верной подписи завершает поток, как неподписанный unary запрос
+		if err := s.verifyBatch(ctx, batch); err != nil {
+			zap.L().Warn("Metrics batch rejected",
+				zap.Uint64("seq", batch.Seq),
+				zap.String("client_ip", clientIP(ctx)),
+				zap.Error(err))
+			return err
+		}
+
+		ack := &proto.BatchAck{Seq: batch.Seq, Applied: true}
+		if len(batch.Metrics) == 0 {
+			ack.Applied = false
+			ack.Error = "empty batch"
+		} else {
+			results, _ := s.applyMetrics(auditCtx, batch.Metrics)
+			if failures := failedResults(results); len(failures) > 0 {
+				ack.Applied = false
+				ack.Error = fmt.Sprintf("failed to process %d metrics: %v", len(failures), failures)
+				ack.Results = results
+			}
+		}
+
+		zap.L().Debug("Metrics batch received via gRPC stream",
+			zap.Uint64("seq", batch.Seq),
+			zap.String("agent_id", agentIDFromContext(ctx)),
+			zap.Int("metrics_count", len(batch.Metrics)),
+			zap.Bool("applied", ack.Applied))
+
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+}
+
+// verifyBatch проверяет подпись батча потока ключом агента из метаданных x-agent-id,
+// если задан каталог ключей агентов, иначе секретом из метаданных x-key-id,
+// а затем его время и nonce. Без секретов HMAC и ключей агентов проверка не выполняется.
+// Если проверка включена, батч без подписи отклоняется: подписи отдельных метрик
+// необязательны и не защищают поток. Ошибки возвращаются со статусом gRPC.
+func (s *MetricsServer) verifyBatch(ctx context.Context, batch *proto.MetricsBatch) error {
+	switch {
+	case s.agents.Enabled():
+		data, err := proto.BatchSignatureData(batch)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "failed to verify batch signature: %v", err)
+		}
+		if err := s.agents.Verify(agentIDFromContext(ctx), data, batch.Signature); err != nil {
+			return status.Errorf(codes.Unauthenticated, "batch agent signature verification failed: %v", err)
+		}
+
+	case s.keys.HMACEnabled():
+		if batch.Hash == "" {
+			return status.Error(codes.Unauthenticated, "batch signature is missing")
+		}
+		receivedHash, err := base64.StdEncoding.DecodeString(batch.Hash)
+		if err != nil {
+			return status.Error(codes.Unauthenticated, "malformed batch signature")
+		}
+
+		data, err := proto.BatchSignatureData(batch)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "failed to verify batch signature: %v", err)
+		}
+		if _, err := s.keys.VerifyHMAC(keyIDFromContext(ctx), hashAlgFromContext(ctx), data, receivedHash); err != nil {
+			return status.Error(codes.Unauthenticated, "batch signature does not match")
+		}
+
+	default:
+		return nil
+	}
+
+	var timestamp string
+	if batch.Timestamp != 0 {
+		timestamp = strconv.FormatInt(batch.Timestamp, 10)
+	}
+	if err := s.replayGuard.Check(timestamp, batch.Nonce); err != nil {
+		return status.Error(replayCode(err), err.Error())
+	}
+	return nil
+}
+
+// applyMetrics проверяет метрики и сохраняет корректные одним батчем.
+// Возвращает результат по каждой метрике и число примененных метрик.
+// При ошибке хранилища корректные метрики получают статус Unavailable.
+func (s *MetricsServer) applyMetrics(ctx context.Context, protoMetrics []*proto.Metric) ([]*proto.MetricResult, int) {
+	results := make([]*proto.MetricResult, len(protoMetrics))
 	var metrics []models.Metrics
+	var validIdx []int
+
+	for i, metric := range protoMetrics {
+		results[i] = &proto.MetricResult{Index: int32(i)}
 
-	for _, metric := range req.Metrics {
-		if m, err := s.processMetric(ctx, metric); err != nil {
-			errors = append(errors, fmt.Sprintf("metric %s: %v", metric.Id, err))
+		m, err := s.processMetric(ctx, metric)
+		if err != nil {
+			st := status.Convert(err)
+			results[i].Status = uint32(st.Code())
+			results[i].Reason = fmt.Sprintf("metric %s: %s", metric.Id, st.Message())
 			zap.L().Error("Failed to process metric",
 				zap.String("metric_id", metric.Id),
 				zap.Error(err))
-		} else {
-			metrics = append(metrics, m)
+			continue
 		}
+
+		metrics = append(metrics, m)
+		validIdx = append(validIdx, i)
 	}
 
 	if len(metrics) > 0 {
 		if err := s.storage.UpdateSliceOfMetrics(ctx, models.SliceMetrics{Metrics: metrics}); err != nil {
-			errors = append(errors, fmt.Sprintf("batch update failed: %v", err))
 			zap.L().Error("Failed to update metrics batch", zap.Error(err))
+			for _, i := range validIdx {
+				results[i].Status = uint32(codes.Unavailable)
+				results[i].Reason = fmt.Sprintf("batch update failed: %v", err)
+			}
+			return results, 0
 		}
 	}
 
-	if len(errors) > 0 {
-		return &proto.UpdateMetricsResponse{
-			Error: fmt.Sprintf("failed to process %d metrics: %v", len(errors), errors),
-		}, nil
+	return results, len(metrics)
+}
+
+// failedResults возвращает описания неудачных результатов
+func failedResults(results []*proto.MetricResult) []string {
+	var failures []string
+	for _, r := range results {
+		if codes.Code(r.Status) != codes.OK {
+			failures = append(failures, r.Reason)
+		}
 	}
+	return failures
+}
 
-	zap.L().Info("Metrics processed successfully via gRPC",
-		zap.Int("metrics_count", len(req.Metrics)))
+// failureCode возвращает код ошибки вызова, в котором не применена ни одна метрика.
+// Unavailable возвращается, если хотя бы одну метрику можно отправить повторно,
+// иначе - код первого неудачного результата.
+func failureCode(results []*proto.MetricResult) codes.Code {
+	code := codes.Unknown
+	for _, r := range results {
+		switch c := codes.Code(r.Status); {
+		case c == codes.Unavailable:
+			return codes.Unavailable
+		case c != codes.OK && code == codes.Unknown:
+			code = c
+		}
+	}
+	return code
+}
 
-	return &proto.UpdateMetricsResponse{}, nil
+// statusWithResponse создает ошибку со статусом и ответом в деталях,
+// чтобы клиент мог получить результаты по отдельным метрикам
+func statusWithResponse(code codes.Code, msg string, resp *proto.UpdateMetricsResponse) error {
+	st := status.New(code, msg)
+	if detailed, err := st.WithDetails(resp); err == nil {
+		st = detailed
+	}
+	return st.Err()
 }
 
 // UpdateMetric обработчик для обновления одной метрики
@@ -128,15 +372,12 @@ func (s *MetricsServer) UpdateMetric(ctx context.Context, req *proto.UpdateMetri
 
 	metric, err := s.processMetric(ctx, req.Metric)
 	if err != nil {
-		return &proto.UpdateMetricResponse{
-			Error: fmt.Sprintf("failed to process metric %s: %v", req.Metric.Id, err),
-		}, nil
+		st := status.Convert(err)
+		return nil, status.Errorf(st.Code(), "failed to process metric %s: %s", req.Metric.Id, st.Message())
 	}
 
-	if err := s.storage.UpdateMetric(ctx, metric); err != nil {
-		return &proto.UpdateMetricResponse{
-			Error: fmt.Sprintf("failed to update metric %s: %v", req.Metric.Id, err),
-		}, nil
+	if err := s.storage.UpdateMetric(audit.WithTransport(ctx, audit.TransportGRPC), metric); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to update metric %s: %v", req.Metric.Id, err)
 	}
 
 	zap.L().Info("Metric processed successfully via gRPC",
@@ -145,26 +386,88 @@ func (s *MetricsServer) UpdateMetric(ctx context.Context, req *proto.UpdateMetri
 	return &proto.UpdateMetricResponse{}, nil
 }
 
-// processMetric обрабатывает одну метрику и возвращает модель для storage
+// GetAgentConfig возвращает настройки агента, выбранные по метке или IP адресу.
+// Адрес определяется по соединению, как и в HTTP: адрес из запроса не используется,
+// иначе клиент мог бы получить настройки чужой подсети.
+func (s *MetricsServer) GetAgentConfig(ctx context.Context, req *proto.AgentConfigRequest) (*proto.AgentConfigResponse, error) {
+	if s.agentConfigs == nil {
+		return nil, status.Error(codes.NotFound, "remote agent config is not configured")
+	}
+
+	ip := clientIP(ctx)
+
+	agentConfig := s.agentConfigs.Resolve(req.GetLabel(), ip)
+
+	zap.L().Debug("Agent config resolved via gRPC",
+		zap.String("label", req.GetLabel()),
+		zap.String("ip", ip))
+
+	poll, report := agentConfig.PollInterval.ToDuration(), agentConfig.ReportInterval.ToDuration()
+	return &proto.AgentConfigResponse{
+		PollIntervalSeconds:   int64(poll.Seconds()),
+		ReportIntervalSeconds: int64(report.Seconds()),
+		PollIntervalMs:        poll.Milliseconds(),
+		ReportIntervalMs:      report.Milliseconds(),
+		Collectors:            agentConfig.Collectors,
+		Labels:                agentConfig.Labels,
+	}, nil
+}
+
+// processMetric обрабатывает одну метрику и возвращает модель для storage.
+// Ошибки возвращаются со статусом gRPC: Unauthenticated при неверной подписи,
+// InvalidArgument при некорректных или нерасшифровываемых данных.
 func (s *MetricsServer) processMetric(ctx context.Context, metric *proto.Metric) (models.Metrics, error) {
-	if err := s.validateAndDecryptMetric(metric); err != nil {
+	if err := s.validateAndDecryptMetric(metric, metricSignerFromContext(ctx)); err != nil {
 		return models.Metrics{}, err
 	}
 
-	return s.convertProtoToModel(metric)
+	m, err := s.convertProtoToModel(metric)
+	if err != nil {
+		return models.Metrics{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return m, nil
+}
+
+// metricSigner - сведения о подписи метрик из метаданных запроса
+type metricSigner struct {
+	keyID   string
+	hashAlg string
+	agentID string
 }
 
-// validateAndDecryptMetric проверяет и расшифровывает метрику
-func (s *MetricsServer) validateAndDecryptMetric(metric *proto.Metric) error {
-	if s.privKey != nil {
+// metricSignerFromContext возвращает сведения о подписи метрик из метаданных запроса
+func metricSignerFromContext(ctx context.Context) metricSigner {
+	return metricSigner{
+		keyID:   keyIDFromContext(ctx),
+		hashAlg: hashAlgFromContext(ctx),
+		agentID: agentIDFromContext(ctx),
+	}
+}
+
+// validateAndDecryptMetric проверяет и расшифровывает метрику.
+// Если задан каталог ключей агентов, подпись проверяется ключом Ed25519 агента,
+// иначе секретом HMAC, выбранным по метаданным запроса.
+func (s *MetricsServer) validateAndDecryptMetric(metric *proto.Metric, signer metricSigner) error {
+	if s.keys.DecryptionEnabled() {
 		if err := s.decryptMetricValue(metric); err != nil {
-			return fmt.Errorf("decryption failed: %w", err)
+			return status.Errorf(codes.InvalidArgument, "decryption failed: %v", err)
 		}
 	}
 
-	if s.key != "" {
-		if !s.verifyMetricHash(metric) {
-			return fmt.Errorf("signature verification failed")
+	if s.agents.Enabled() {
+		if err := s.agents.Verify(signer.agentID, []byte(metricHashData(metric)), metric.Signature); err != nil {
+			zap.L().Warn("Metric agent signature verification failed",
+				zap.String("metric_id", metric.Id),
+				zap.String("agent_id", signer.agentID),
+				zap.Error(err))
+			return status.Error(codes.Unauthenticated, "agent signature verification failed")
+		}
+		return nil
+	}
+
+	if s.keys.HMACEnabled() {
+		if !s.verifyMetricHash(metric, signer.keyID, signer.hashAlg) {
+			return status.Error(codes.Unauthenticated, "signature verification failed")
 		}
 	}
 
@@ -202,7 +505,7 @@ func (s *MetricsServer) convertProtoToModel(metric *proto.Metric) (models.Metric
 
 // decryptMetricValue расшифровывает значение метрики с использованием приватного ключа
 func (s *MetricsServer) decryptMetricValue(metric *proto.Metric) error {
-	if metric.Hash == "" || s.privKey == nil {
+	if metric.Hash == "" || !s.keys.DecryptionEnabled() {
 		return nil
 	}
 
@@ -211,7 +514,7 @@ func (s *MetricsServer) decryptMetricValue(metric *proto.Metric) error {
 		return fmt.Errorf("failed to decode encrypted data: %w", err)
 	}
 
-	decryptedData, err := crypto.DecryptLargeData(s.privKey, encryptedData)
+	decryptedData, err := s.keys.Decrypt(encryptedData)
 	if err != nil {
 		return fmt.Errorf("failed to decrypt metric data: %w", err)
 	}
@@ -245,43 +548,42 @@ func (s *MetricsServer) decryptMetricValue(metric *proto.Metric) error {
 }
 
 // verifyMetricHash проверяет HMAC подпись метрики
-func (s *MetricsServer) verifyMetricHash(metric *proto.Metric) bool {
-	if metric.Hash == "" || s.key == "" {
+func (s *MetricsServer) verifyMetricHash(metric *proto.Metric, keyID, hashAlg string) bool {
+	if metric.Hash == "" || !s.keys.HMACEnabled() {
 		return true
 	}
 
-	originalHash := metric.Hash
-
-	expectedHash := s.calculateMetricHash(metric)
-
-	metric.Hash = originalHash
+	receivedHash, err := hex.DecodeString(metric.Hash)
+	if err != nil {
+		zap.L().Warn("Malformed metric hash",
+			zap.String("metric_id", metric.Id),
+			zap.Error(err))
+		return false
+	}
 
-	if originalHash != expectedHash {
+	usedKeyID, err := s.keys.VerifyHMAC(keyID, hashAlg, []byte(metricHashData(metric)), receivedHash)
+	if err != nil {
 		zap.L().Warn("Metric hash verification failed",
 			zap.String("metric_id", metric.Id),
-			zap.String("received_hash", originalHash),
-			zap.String("expected_hash", expectedHash))
+			zap.String("key_id", keyID),
+			zap.Error(err))
 		return false
 	}
 
 	zap.L().Debug("Metric hash verified successfully",
-		zap.String("metric_id", metric.Id))
+		zap.String("metric_id", metric.Id),
+		zap.String("key_id", usedKeyID))
 	return true
 }
 
-// calculateMetricHash вычисляет HMAC-SHA256 хеш для метрики
-func (s *MetricsServer) calculateMetricHash(metric *proto.Metric) string {
-	var data string
+// metricHashData возвращает строку, которую агент подписывает HMAC для метрики
+func metricHashData(metric *proto.Metric) string {
 	switch metric.Mtype {
 	case "counter":
-		data = fmt.Sprintf("%s:counter:%d", metric.Id, metric.Delta)
+		return fmt.Sprintf("%s:counter:%d", metric.Id, metric.Delta)
 	case "gauge":
-		data = fmt.Sprintf("%s:gauge:%f", metric.Id, metric.Value)
+		return fmt.Sprintf("%s:gauge:%f", metric.Id, metric.Value)
 	default:
-		data = fmt.Sprintf("%s:%s", metric.Id, metric.Mtype)
+		return fmt.Sprintf("%s:%s", metric.Id, metric.Mtype)
 	}
-
-	h := hmac.New(sha256.New, []byte(s.key))
-	h.Write([]byte(data))
-	return hex.EncodeToString(h.Sum(nil))
 }
@@ -0,0 +1,406 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/config"
+	"github.com/MPoline/alert_service_yp/internal/keyring"
+	"github.com/MPoline/alert_service_yp/internal/models"
+	"github.com/MPoline/alert_service_yp/internal/proto"
+	"github.com/MPoline/alert_service_yp/internal/storage"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestGRPCClient поднимает MetricsServer поверх bufconn и возвращает клиента к нему
+func newTestGRPCClient(t *testing.T, server *MetricsServer) proto.MetricsServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	grpcSrv := grpc.NewServer()
+	proto.RegisterMetricsServiceServer(grpcSrv, server)
+	go func() { _ = grpcSrv.Serve(lis) }()
+	t.Cleanup(grpcSrv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return proto.NewMetricsServiceClient(conn)
+}
+
+func TestStreamMetrics(t *testing.T) {
+	memStorage := storage.NewMemStorage()
+	client := newTestGRPCClient(t, &MetricsServer{storage: memStorage})
+
+	stream, err := client.StreamMetrics(context.Background())
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+
+	batches := []*proto.MetricsBatch{
+		{Seq: 1, Metrics: []*proto.Metric{{Id: "Alloc", Mtype: "gauge", Value: 1.5}}},
+		{Seq: 2, Metrics: []*proto.Metric{{Id: "PollCount", Mtype: "counter", Delta: 3}}},
+		{Seq: 3, Metrics: []*proto.Metric{{Id: "Frees", Mtype: "gauge", Value: 7}, {Id: "Bad", Mtype: "unknown"}}},
+	}
+	for _, batch := range batches {
+		if err := stream.Send(batch); err != nil {
+			t.Fatalf("failed to send batch %d: %v", batch.Seq, err)
+		}
+	}
+
+	wantApplied := map[uint64]bool{1: true, 2: true, 3: false}
+	for range batches {
+		ack, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("failed to receive ack: %v", err)
+		}
+		if ack.Applied != wantApplied[ack.Seq] {
+			t.Errorf("batch %d: applied = %v, want %v (error: %s)", ack.Seq, ack.Applied, wantApplied[ack.Seq], ack.Error)
+		}
+
+		// Частично примененный батч подтверждается с результатами по метрикам
+		if ack.Seq == 3 {
+			if len(ack.Results) != 2 {
+				t.Fatalf("batch 3: expected 2 results, got %v", ack.Results)
+			}
+			if code := codes.Code(ack.Results[0].Status); code != codes.OK {
+				t.Errorf("batch 3: valid metric status = %v, want OK", code)
+			}
+			if code := codes.Code(ack.Results[1].Status); code != codes.InvalidArgument {
+				t.Errorf("batch 3: invalid metric status = %v, want InvalidArgument", code)
+			}
+		} else if len(ack.Results) != 0 {
+			t.Errorf("batch %d: expected no results for applied batch, got %v", ack.Seq, ack.Results)
+		}
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("failed to close stream: %v", err)
+	}
+
+	if value, ok := memStorage.GetGauge("Alloc"); !ok || value != 1.5 {
+		t.Errorf("expected gauge Alloc = 1.5, got %v (present: %v)", value, ok)
+	}
+	if delta, ok := memStorage.GetCounter("PollCount"); !ok || delta != 3 {
+		t.Errorf("expected counter PollCount = 3, got %v (present: %v)", delta, ok)
+	}
+	if value, ok := memStorage.GetGauge("Frees"); !ok || value != 7 {
+		t.Errorf("expected gauge Frees from partially applied batch = 7, got %v (present: %v)", value, ok)
+	}
+}
+
+func TestStreamMetricsRequiresBatchSignature(t *testing.T) {
+	const key = "secret"
+	keys, err := keyring.New("", key, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := &proto.MetricsBatch{Seq: 1, Metrics: []*proto.Metric{{Id: "Alloc", Mtype: "gauge", Value: 1}}}
+	if err := proto.SignBatch(signed, key, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		batch *proto.MetricsBatch
+		want  codes.Code
+	}{
+		{"signed batch", signed, codes.OK},
+		{"unsigned batch", &proto.MetricsBatch{Seq: 1, Metrics: []*proto.Metric{{Id: "PollCount", Mtype: "counter", Delta: 1}}}, codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Защита от повтора выключена: подпись батча обязательна и без нее
+			memStorage := storage.NewMemStorage()
+			client := newTestGRPCClient(t, &MetricsServer{keys: keys, storage: memStorage})
+
+			stream, err := client.StreamMetrics(context.Background())
+			if err != nil {
+				t.Fatalf("failed to open stream: %v", err)
+			}
+			if err := stream.Send(tt.batch); err != nil {
+				t.Fatalf("failed to send batch: %v", err)
+			}
+
+			ack, err := stream.Recv()
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("expected %s, got %s (%v)", tt.want, got, err)
+			}
+			if tt.want == codes.OK && !ack.Applied {
+				t.Errorf("signed batch was not applied: %s", ack.Error)
+			}
+
+			if _, ok := memStorage.GetCounter("PollCount"); ok {
+				t.Error("metrics of an unsigned batch must not be stored")
+			}
+		})
+	}
+}
+
+func TestStreamMetricsRequiresAgentSignature(t *testing.T) {
+	agents, priv := newTestAgentRegistry(t, "web-01")
+
+	signed := &proto.MetricsBatch{Seq: 1, Metrics: []*proto.Metric{{Id: "Alloc", Mtype: "gauge", Value: 1}}}
+	data, err := proto.BatchSignatureData(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed.Signature = ed25519.Sign(priv, data)
+
+	tests := []struct {
+		name  string
+		batch *proto.MetricsBatch
+		want  codes.Code
+	}{
+		{"signed batch", signed, codes.OK},
+		{"unsigned batch", &proto.MetricsBatch{Seq: 1, Metrics: []*proto.Metric{{Id: "Alloc", Mtype: "gauge", Value: 2}}}, codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestGRPCClient(t, &MetricsServer{agents: agents, storage: storage.NewMemStorage()})
+
+			ctx := metadata.AppendToOutgoingContext(context.Background(), agentkey.MetadataAgentID, "web-01")
+			stream, err := client.StreamMetrics(ctx)
+			if err != nil {
+				t.Fatalf("failed to open stream: %v", err)
+			}
+			if err := stream.Send(tt.batch); err != nil {
+				t.Fatalf("failed to send batch: %v", err)
+			}
+
+			if _, err := stream.Recv(); status.Code(err) != tt.want {
+				t.Fatalf("expected %s, got %s (%v)", tt.want, status.Code(err), err)
+			}
+		})
+	}
+}
+
+func TestGetAgentConfigUsesConnectionAddress(t *testing.T) {
+	server := &MetricsServer{agentConfigs: &config.AgentConfigSet{
+		Default: config.RemoteAgentConfig{Collectors: []string{config.CollectorRuntime}},
+		Rules: []config.AgentConfigRule{
+			{IP: "192.168.0.0/16", Config: config.RemoteAgentConfig{Collectors: []string{config.CollectorSystem}}},
+		},
+	}}
+
+	tests := []struct {
+		name     string
+		peerAddr string
+		want     string
+	}{
+		{"claimed address is ignored", "10.0.0.5:4000", config.CollectorRuntime},
+		{"connection address selects the rule", "192.168.1.7:4000", config.CollectorSystem},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := net.ResolveTCPAddr("tcp", tt.peerAddr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+
+			resp, err := server.GetAgentConfig(ctx, &proto.AgentConfigRequest{Ip: "192.168.1.1"})
+			if err != nil {
+				t.Fatalf("GetAgentConfig failed: %v", err)
+			}
+			if !reflect.DeepEqual(resp.Collectors, []string{tt.want}) {
+				t.Errorf("expected collectors [%s], got %v", tt.want, resp.Collectors)
+			}
+		})
+	}
+}
+
+func TestGetAndListMetrics(t *testing.T) {
+	memStorage := storage.NewMemStorage()
+	for _, name := range []string{"cpu.user", "cpu.system", "mem.used", "cpu.idle"} {
+		memStorage.SetGauge(name, 1)
+	}
+	memStorage.IncrementCounter("cpu.user", 5)
+
+	client := newTestGRPCClient(t, &MetricsServer{storage: memStorage})
+	ctx := context.Background()
+
+	resp, err := client.GetMetric(ctx, &proto.GetMetricRequest{Id: "cpu.user", Mtype: "counter"})
+	if err != nil || resp.Metric.Delta != 5 {
+		t.Fatalf("GetMetric: expected delta 5, got %v (err: %v)", resp, err)
+	}
+
+	_, err = client.GetMetric(ctx, &proto.GetMetricRequest{Id: "missing", Mtype: "gauge"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("GetMetric: expected NotFound, got %v", err)
+	}
+
+	var ids []string
+	req := &proto.ListMetricsRequest{Prefix: "cpu.", PageSize: 2}
+	for page := 0; ; page++ {
+		list, err := client.ListMetrics(ctx, req)
+		if err != nil {
+			t.Fatalf("ListMetrics failed: %v", err)
+		}
+		if len(list.Metrics) > 2 {
+			t.Fatalf("page %d exceeds page size: %d", page, len(list.Metrics))
+		}
+		for _, m := range list.Metrics {
+			ids = append(ids, m.Id+":"+m.Mtype)
+		}
+		if list.NextPageToken == "" {
+			break
+		}
+		req.PageToken = list.NextPageToken
+	}
+
+	want := []string{"cpu.idle:gauge", "cpu.system:gauge", "cpu.user:counter", "cpu.user:gauge"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("ListMetrics: expected %v, got %v", want, ids)
+	}
+}
+
+func TestWatchMetrics(t *testing.T) {
+	watched := storage.NewWatchedStorage(storage.NewMemStorage())
+	client := newTestGRPCClient(t, &MetricsServer{storage: watched})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchMetrics(ctx, &proto.WatchMetricsRequest{Prefix: "Poll"})
+	if err != nil {
+		t.Fatalf("WatchMetrics failed: %v", err)
+	}
+	// Первое сообщение придет только после подписки, поэтому обновляем в цикле до получения
+	received := make(chan *proto.Metric, 1)
+	go func() {
+		m, err := stream.Recv()
+		if err == nil {
+			received <- m
+		}
+	}()
+
+	delta := int64(2)
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		value := 1.0
+		_ = watched.UpdateMetric(ctx, models.Metrics{ID: "Alloc", MType: "gauge", Value: &value})
+		_ = watched.UpdateMetric(ctx, models.Metrics{ID: "PollCount", MType: "counter", Delta: &delta})
+
+		select {
+		case m := <-received:
+			if m.Id != "PollCount" || m.Delta < 2 {
+				t.Fatalf("unexpected update: %+v", m)
+			}
+			return
+		case <-ticker.C:
+		case <-ctx.Done():
+			t.Fatal("no update received")
+		}
+	}
+}
+
+func TestUpdateMetricsResults(t *testing.T) {
+	client := newTestGRPCClient(t, &MetricsServer{storage: storage.NewMemStorage()})
+	ctx := context.Background()
+
+	resp, err := client.UpdateMetrics(ctx, &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{
+		{Id: "Alloc", Mtype: "gauge", Value: 1},
+		{Id: "Bad", Mtype: "unknown"},
+	}})
+	if err != nil {
+		t.Fatalf("partial failure must not fail the call: %v", err)
+	}
+	if len(resp.Results) != 2 || codes.Code(resp.Results[0].Status) != codes.OK ||
+		codes.Code(resp.Results[1].Status) != codes.InvalidArgument || resp.Results[1].Index != 1 {
+		t.Errorf("unexpected results: %v", resp.Results)
+	}
+	if resp.Error == "" {
+		t.Error("expected legacy error text for partial failure")
+	}
+
+	_, err = client.UpdateMetrics(ctx, &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{
+		{Id: "Bad", Mtype: "unknown"},
+	}})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument when nothing was applied, got %v", err)
+	}
+	if len(st.Details()) != 1 {
+		t.Errorf("expected per-metric results in status details, got %v", st.Details())
+	}
+
+	// Ошибка хранилища важнее ошибки первой метрики: клиент повторит корректные метрики
+	client = newTestGRPCClient(t, &MetricsServer{storage: failingStorage{storage.NewMemStorage()}})
+	_, err = client.UpdateMetrics(ctx, &proto.UpdateMetricsRequest{Metrics: []*proto.Metric{
+		{Id: "Bad", Mtype: "unknown"},
+		{Id: "Alloc", Mtype: "gauge", Value: 1},
+	}})
+	if code := status.Code(err); code != codes.Unavailable {
+		t.Fatalf("expected Unavailable for a mixed batch with storage failures, got %v", err)
+	}
+}
+
+// failingStorage - хранилище, отклоняющее запись метрик
+type failingStorage struct {
+	storage.Storage
+}
+
+func (failingStorage) UpdateSliceOfMetrics(ctx context.Context, sliceMitrics models.SliceMetrics) error {
+	return errors.New("connection refused")
+}
+
+// unavailableStorage - хранилище, не проходящее проверку готовности
+type unavailableStorage struct {
+	storage.Storage
+}
+
+func (unavailableStorage) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestStorageHealth(t *testing.T) {
+	service := proto.MetricsService_ServiceDesc.ServiceName
+
+	for _, tt := range []struct {
+		name    string
+		storage storage.Storage
+		want    healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{"memory", storage.NewMemStorage(), healthpb.HealthCheckResponse_SERVING},
+		{"unavailable", unavailableStorage{storage.NewMemStorage()}, healthpb.HealthCheckResponse_NOT_SERVING},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newStorageHealth(tt.storage)
+			h.check()
+
+			resp, err := h.server.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+			if err != nil {
+				t.Fatalf("Check failed: %v", err)
+			}
+			if resp.Status != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, resp.Status)
+			}
+		})
+	}
+}
@@ -1,21 +1,35 @@
 package services
 
 import (
-	"crypto/rsa"
-
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/audit"
+	"github.com/MPoline/alert_service_yp/internal/config"
+	"github.com/MPoline/alert_service_yp/internal/keyring"
+	"github.com/MPoline/alert_service_yp/internal/replay"
 	"github.com/MPoline/alert_service_yp/internal/storage"
 )
 
 type ServiceHandler struct {
-	storage    storage.Storage
-	privateKey *rsa.PrivateKey
-	key        string
+	storage      storage.Storage
+	keys         *keyring.Keyring
+	replayGuard  *replay.Guard
+	agents       *agentkey.Registry
+	agentConfigs *config.AgentConfigSet
+	audit        *audit.Logger
 }
 
-func NewServiceHandler(storage storage.Storage, privateKey *rsa.PrivateKey, key string) *ServiceHandler {
+func NewServiceHandler(storage storage.Storage, keys *keyring.Keyring, replayGuard *replay.Guard, agents *agentkey.Registry, agentConfigs *config.AgentConfigSet, auditLog *audit.Logger) *ServiceHandler {
 	return &ServiceHandler{
-		storage:    storage,
-		privateKey: privateKey,
-		key:        key,
+		storage:      storage,
+		keys:         keys,
+		replayGuard:  replayGuard,
+		agents:       agents,
+		agentConfigs: agentConfigs,
+		audit:        auditLog,
 	}
 }
+
+// Keys возвращает набор ключей для проверки подписей и расшифровки
+func (h *ServiceHandler) Keys() *keyring.Keyring {
+	return h.keys
+}
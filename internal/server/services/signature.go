@@ -0,0 +1,135 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/hasher"
+	"github.com/MPoline/alert_service_yp/internal/keyring"
+	"github.com/MPoline/alert_service_yp/internal/replay"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// verifyRequestHash проверяет подпись тела запроса из заголовка HashSHA256
+// секретом, выбранным по заголовку X-Key-Id, и алгоритмом из заголовка X-Hash-Alg. Время и nonce из заголовков
+// X-Timestamp и X-Nonce, если они переданы, входят в подписанные данные.
+// Возвращает проверенную подпись для ответа; при ошибке отправляет ответ 400 и возвращает false.
+func (h *ServiceHandler) verifyRequestHash(c *gin.Context, data []byte) ([]byte, bool) {
+	hashFromHeader, err := base64.StdEncoding.DecodeString(c.Request.Header.Get("HashSHA256"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error": "Failed to decode hash"})
+		zap.L().Error("Failed to decode hash: ", zap.Error(err))
+		return nil, false
+	}
+
+	timestamp := c.GetHeader(replay.HeaderTimestamp)
+	nonce := c.GetHeader(replay.HeaderNonce)
+
+	keyID, err := h.keys.VerifyHMAC(c.GetHeader(keyring.HeaderKeyID), c.GetHeader(hasher.HeaderAlgorithm),
+		replay.SignedData(timestamp, nonce, data), hashFromHeader)
+	if errors.Is(err, hasher.ErrUnknownAlgorithm) {
+		c.JSON(http.StatusBadRequest, gin.H{"Error": err.Error()})
+		zap.L().Error("Unsupported hash algorithm", zap.Error(err))
+		return nil, false
+	}
+	if errors.Is(err, keyring.ErrSignatureMismatch) {
+		c.JSON(http.StatusBadRequest, gin.H{"Error": "Signature hash does not match"})
+		zap.L().Error("Signature hash does not match",
+			zap.String("key_id", c.GetHeader(keyring.HeaderKeyID)))
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error": "Failed calculate sha256"})
+		zap.L().Error("Failed calculate sha256: ", zap.Error(err))
+		return nil, false
+	}
+
+	zap.L().Debug("Request signature verified", zap.String("key_id", keyID))
+	return hashFromHeader, true
+}
+
+// verifyUpdateSignature проверяет подпись запроса на изменение метрик: ключом Ed25519
+// агента, если задан каталог ключей агентов, иначе общим секретом HMAC.
+// Возвращает подпись HMAC для ответа; при ошибке отправляет ответ и возвращает false.
+func (h *ServiceHandler) verifyUpdateSignature(c *gin.Context, data []byte) ([]byte, bool) {
+	if !h.agents.Enabled() {
+		return h.verifyRequestHash(c, data)
+	}
+	return nil, h.verifyAgentSignature(c, data)
+}
+
+// verifyAgentSignature проверяет подпись Ed25519 из заголовка X-Signature ключом агента
+// из заголовка X-Agent-Id. Время и nonce запроса входят в подписанные данные.
+// Идентификатор агента сохраняется в контексте запроса.
+func (h *ServiceHandler) verifyAgentSignature(c *gin.Context, data []byte) bool {
+	agentID := c.GetHeader(agentkey.HeaderAgentID)
+	signature, err := base64.StdEncoding.DecodeString(c.GetHeader(agentkey.HeaderSignature))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"Error": "Failed to decode signature"})
+		zap.L().Error("Failed to decode agent signature",
+			zap.String("agent_id", agentID),
+			zap.Error(err))
+		return false
+	}
+
+	signed := replay.SignedData(c.GetHeader(replay.HeaderTimestamp), c.GetHeader(replay.HeaderNonce), data)
+	if err := h.agents.Verify(agentID, signed, signature); err != nil {
+		code := http.StatusUnauthorized
+		if errors.Is(err, agentkey.ErrMissing) {
+			code = http.StatusBadRequest
+		}
+		c.JSON(code, gin.H{"Error": err.Error()})
+		zap.L().Warn("Agent signature verification failed",
+			zap.String("agent_id", agentID),
+			zap.String("client_ip", c.ClientIP()),
+			zap.Error(err))
+		return false
+	}
+
+	c.Request = c.Request.WithContext(agentkey.WithAgentID(c.Request.Context(), agentID))
+	zap.L().Debug("Request signed by agent", zap.String("agent_id", agentID))
+	return true
+}
+
+// checkReplay проверяет время и nonce подписанного запроса на изменение метрик.
+// Вызывается после проверки подписи, чтобы неподписанные запросы не занимали кеш nonce.
+// При ошибке отправляет ответ и возвращает false.
+func (h *ServiceHandler) checkReplay(c *gin.Context) bool {
+	nonce := c.GetHeader(replay.HeaderNonce)
+	if err := h.replayGuard.Check(c.GetHeader(replay.HeaderTimestamp), nonce); err != nil {
+		c.JSON(replayStatus(err), gin.H{"Error": err.Error()})
+		zap.L().Warn("Request rejected by replay protection",
+			zap.String("nonce", nonce),
+			zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// replayStatus возвращает HTTP статус для ошибки защиты от повтора
+func replayStatus(err error) int {
+	switch {
+	case errors.Is(err, replay.ErrReplayed):
+		return http.StatusConflict
+	case errors.Is(err, replay.ErrCacheFull):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// replayCode возвращает код gRPC для ошибки защиты от повтора
+func replayCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, replay.ErrReplayed):
+		return codes.AlreadyExists
+	case errors.Is(err, replay.ErrCacheFull):
+		return codes.Unavailable
+	default:
+		return codes.Unauthenticated
+	}
+}
@@ -1,7 +1,6 @@
 package services
 
 import (
-	"crypto/hmac"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -11,7 +10,7 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/MPoline/alert_service_yp/internal/hasher"
+	"github.com/MPoline/alert_service_yp/internal/audit"
 	"github.com/MPoline/alert_service_yp/internal/models"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -38,13 +37,19 @@ import (
 //
 // Заголовки:
 //   - HashSHA256: обязательная подпись тела запроса (base64)
+//   - X-Hash-Alg: алгоритм подписи (sha256, sha512, blake2b), по умолчанию настройка сервера
+//   - X-Timestamp, X-Nonce: время и nonce запроса, входят в подпись (обязательны при защите от повтора)
+//   - X-Agent-Id, X-Signature: идентификатор агента и подпись Ed25519 (base64),
+//     заменяют HashSHA256, если на сервере задан каталог ключей агентов
 //   - Content-Type: application/json
 //
 // Возможные ответы:
 //   - 200 OK: успешное обновление
 //     Тело: обновленная метрика в JSON
 //   - 400 Bad Request: неверный формат, ошибка валидации
+//   - 401 Unauthorized: неизвестный агент или неверная подпись Ed25519
 //   - 404 Not Found: обязательные параметры отсутствуют
+//   - 409 Conflict: повторная отправка запроса с тем же nonce
 //   - 500 Internal Server Error: ошибка сервера
 //
 // Пример:
@@ -64,8 +69,6 @@ func (h *ServiceHandler) UpdateMetricFromJSON(c *gin.Context) {
 		req models.Metrics
 	)
 
-	ctx := c.Request.Context()
-
 	data, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		zap.L().Error("Error read request: ", zap.Error(err))
@@ -78,28 +81,12 @@ func (h *ServiceHandler) UpdateMetricFromJSON(c *gin.Context) {
 		return
 	}
 
-	hasherInstance := hasher.InitHasher("SHA256")
-	hash, err := hasherInstance.CalculateHash(data, []byte(h.key))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"Error": "Failed calculate sha256"})
-		zap.L().Error("Failed calculate sha256: ", zap.Error(err))
-		return
-	}
-
-	hashFromHeader, err := base64.StdEncoding.DecodeString(c.Request.Header.Get("HashSHA256"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"Error": "Failed to decode hash"})
-		zap.L().Error("Failed to decode hash: ", zap.Error(err))
+	hash, ok := h.verifyUpdateSignature(c, data)
+	if !ok || !h.checkReplay(c) {
 		return
 	}
 
-	if !(hmac.Equal(hash, hashFromHeader)) {
-		c.JSON(http.StatusBadRequest, gin.H{"Error": "Signature hash does not match"})
-		zap.L().Error("Signature hash does not match")
-		return
-	}
-
-	err = h.storage.UpdateMetric(ctx, req)
+	err = h.storage.UpdateMetric(auditContext(c, audit.TransportHTTPJSON), req)
 
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidMetricName) || errors.Is(err, models.ErrInvalidMetricType) {
@@ -162,8 +149,6 @@ func (h *ServiceHandler) UpdateMetricFromURL(c *gin.Context) {
 	metricName := c.Param("name")
 	metricValue := c.Param("value")
 
-	ctx := c.Request.Context()
-
 	if metricType == "" {
 		c.JSON(http.StatusNotFound, gin.H{"Error": "Metric type is required"})
 		zap.L().Info("Metric type is required")
@@ -208,7 +193,7 @@ func (h *ServiceHandler) UpdateMetricFromURL(c *gin.Context) {
 		}
 	}
 
-	err := h.storage.UpdateMetric(ctx, req)
+	err := h.storage.UpdateMetric(auditContext(c, audit.TransportHTTPURL), req)
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidMetricType) {
 			c.JSON(http.StatusBadRequest, gin.H{"Error": "InvalidMetricType"})
@@ -1,7 +1,6 @@
 package services
 
 import (
-	"crypto/hmac"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -10,7 +9,8 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/MPoline/alert_service_yp/internal/hasher"
+	"github.com/MPoline/alert_service_yp/internal/agentkey"
+	"github.com/MPoline/alert_service_yp/internal/audit"
 	"github.com/MPoline/alert_service_yp/internal/models"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -38,13 +38,19 @@ import (
 //
 // Заголовки:
 //   - HashSHA256: обязательная подпись тела запроса (base64)
+//   - X-Hash-Alg: алгоритм подписи (sha256, sha512, blake2b), по умолчанию настройка сервера
+//   - X-Timestamp, X-Nonce: время и nonce запроса, входят в подпись (обязательны при защите от повтора)
+//   - X-Agent-Id, X-Signature: идентификатор агента и подпись Ed25519 (base64),
+//     заменяют HashSHA256, если на сервере задан каталог ключей агентов
 //   - Content-Type: application/json
 //
 // Возможные ответы:
 //   - 200 OK: успешное обновление
 //     Тело: обновленные метрики в JSON
 //   - 400 Bad Request: неверный формат, ошибка валидации или подписи
+//   - 401 Unauthorized: неизвестный агент или неверная подпись Ed25519
 //   - 404 Not Found: обязательные параметры отсутствуют
+//   - 409 Conflict: повторная отправка запроса с тем же nonce
 //   - 500 Internal Server Error: ошибка сервера
 //
 // Пример:
@@ -72,8 +78,6 @@ import (
 func (h *ServiceHandler) UpdateSliceOfMetrics(c *gin.Context) {
 	var req models.SliceMetrics
 
-	ctx := c.Request.Context()
-
 	data, err := io.ReadAll(c.Request.Body)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to read request"})
@@ -81,32 +85,8 @@ func (h *ServiceHandler) UpdateSliceOfMetrics(c *gin.Context) {
 		return
 	}
 
-	// Используем ключ из ServiceHandler вместо глобального флага
-	hasherInstance := hasher.InitHasher("SHA256")
-	hash, err := hasherInstance.CalculateHash(data, []byte(h.key))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"Error": "Failed calculate sha256"})
-		zap.L().Error("Failed calculate sha256: ", zap.Error(err))
-		return
-	}
-
-	zap.L().Info("===================================")
-	hashStr := base64.StdEncoding.EncodeToString(hash)
-	hashHeader := c.Request.Header.Get("HashSHA256")
-	zap.L().Info("hash request: ", zap.String("hashStr", hashStr))
-	zap.L().Info("hash from header: ", zap.String("hash from header", hashHeader))
-	zap.L().Info("===================================")
-
-	hashFromHeader, err := base64.StdEncoding.DecodeString(c.Request.Header.Get("HashSHA256"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"Error": "Failed to decode hash"})
-		zap.L().Error("Failed to decode hash: ", zap.Error(err))
-		return
-	}
-
-	if !(hmac.Equal(hash, hashFromHeader)) {
-		c.JSON(http.StatusBadRequest, gin.H{"Error": "Signature hash does not match"})
-		zap.L().Error("Signature hash does not match")
+	hash, ok := h.verifyUpdateSignature(c, data)
+	if !ok || !h.checkReplay(c) {
 		return
 	}
 
@@ -118,7 +98,7 @@ func (h *ServiceHandler) UpdateSliceOfMetrics(c *gin.Context) {
 	}
 
 	// Используем переданное хранилище вместо глобальной переменной
-	err = h.storage.UpdateSliceOfMetrics(ctx, req)
+	err = h.storage.UpdateSliceOfMetrics(auditContext(c, audit.TransportHTTPBatch), req)
 
 	if err != nil {
 		if errors.Is(err, models.ErrInvalidMetricName) || errors.Is(err, models.ErrInvalidMetricType) {
@@ -134,6 +114,12 @@ func (h *ServiceHandler) UpdateSliceOfMetrics(c *gin.Context) {
 		}
 	}
 
+	if agentID := agentkey.AgentIDFromContext(c.Request.Context()); agentID != "" {
+		zap.L().Info("Metrics batch received from agent",
+			zap.String("agent_id", agentID),
+			zap.Int("metrics_count", len(req.Metrics)))
+	}
+
 	respBytes, err := json.Marshal(req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"Error": "Failed to encode response"})
@@ -19,11 +19,22 @@ func NewDBStorage() *DBStorage {
 		zap.L().Fatal("Error opening database: ", zap.Error(err))
 	}
 
-	err = database.CreateMetricsTable(context.Background(), dbConn)
+	// Миграции выполняются под advisory lock, поэтому экземпляры сервера,
+	// запущенные одновременно, не применяют их дважды
+	err = database.WithRetry(context.Background(), func(ctx context.Context) error {
+		_, err := database.MigrateUp(ctx, dbConn)
+		return err
+	})
 	if err != nil {
-		zap.L().Fatal("Error create table metric: ", zap.Error(err))
+		zap.L().Fatal("Error migrating database schema: ", zap.Error(err))
 	}
 
+	return NewDBStorageWithConn(dbConn)
+}
+
+// NewDBStorageWithConn создает хранилище поверх открытого пула соединений
+// со схемой, приведенной к актуальной версии
+func NewDBStorageWithConn(dbConn *sql.DB) *DBStorage {
 	return &DBStorage{
 		dbConn: dbConn,
 	}
@@ -33,6 +44,11 @@ func (s DBStorage) Close() {
 	database.CloseDBConnection(s.dbConn)
 }
 
+// Ping проверяет доступность базы данных соединением из пула хранилища
+func (s DBStorage) Ping(ctx context.Context) error {
+	return s.dbConn.PingContext(ctx)
+}
+
 func (s DBStorage) GetAllMetrics(ctx context.Context) ([]models.Metrics, error) {
 	select {
 	case <-ctx.Done():
@@ -76,17 +92,7 @@ func (s DBStorage) UpdateMetric(ctx context.Context, metric models.Metrics) erro
 		return err
 	}
 
-	if metric.MType == "counter" {
-		m, err := s.GetMetric(ctx, metric.MType, metric.ID)
-
-		if err == nil {
-			*metric.Delta += *m.Delta
-		} else if err.Error() != "MetricNotFound" {
-			zap.L().Error("Error create/update metric from table: ", zap.Error(err))
-			return err
-		}
-	}
-
+	// Дельта counter прибавляется к сохраненному значению в SQL запросе
 	err = database.CreateOrUpdateMetric(ctx, s.dbConn, metric)
 	if err != nil {
 		zap.L().Error("Error create/update metric from table: ", zap.Error(err))
@@ -96,20 +102,32 @@ func (s DBStorage) UpdateMetric(ctx context.Context, metric models.Metrics) erro
 	return nil
 }
 
-func (s DBStorage) UpdateSliceOfMetrics(ctx context.Context, sliceMitrics models.SliceMetrics) error {
-	for _, metric := range sliceMitrics.Metrics {
+// ApplyMetrics записывает метрики в транзакции и возвращает их изменения.
+// Прежние значения gauge читаются в той же транзакции под блокировкой строк,
+// прежние значения counter вычисляются как накопленное значение минус дельта.
+func (s DBStorage) ApplyMetrics(ctx context.Context, metrics []models.Metrics) ([]models.MetricUpdate, error) {
+	for _, metric := range metrics {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return nil, ctx.Err()
 		default:
 		}
 
 		if ok, err := metric.IsValid(); !ok {
 			zap.L().Info("Error in Metric Parametrs: ", zap.Error(err))
-			return err
+			return nil, err
 		}
 	}
 
+	updates, err := database.ApplyMetrics(ctx, s.dbConn, metrics)
+	if err != nil {
+		zap.L().Error("Error create/update metric from table: ", zap.Error(err))
+		return nil, err
+	}
+	return updates, nil
+}
+
+func (s DBStorage) UpdateSliceOfMetrics(ctx context.Context, sliceMitrics models.SliceMetrics) error {
 	for _, metric := range sliceMitrics.Metrics {
 		select {
 		case <-ctx.Done():
@@ -117,18 +135,14 @@ func (s DBStorage) UpdateSliceOfMetrics(ctx context.Context, sliceMitrics models
 		default:
 		}
 
-		if metric.MType == "counter" {
-			m, err := s.GetMetric(ctx, metric.MType, metric.ID)
-
-			if err == nil {
-				*metric.Delta += *m.Delta
-			} else if err.Error() != "MetricNotFound" {
-				zap.L().Error("Error create/update metric from table: ", zap.Error(err))
-				return err
-			}
+		if ok, err := metric.IsValid(); !ok {
+			zap.L().Info("Error in Metric Parametrs: ", zap.Error(err))
+			return err
 		}
 	}
 
+	// Повторы метрик объединяются, а дельты counter прибавляются
+	// к сохраненным значениям в SQL запросах одной транзакции
 	err := database.CreateOrUpdateSliceOfMetrics(ctx, s.dbConn, sliceMitrics)
 	if err != nil {
 		zap.L().Error("Error create/update metric from table: ", zap.Error(err))
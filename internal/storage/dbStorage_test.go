@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MPoline/alert_service_yp/internal/models"
+	"github.com/MPoline/alert_service_yp/internal/server/flags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDBStorageConcurrentCounters проверяет, что одновременные обновления counter
+// не теряют приращений. Требует PostgreSQL: строка подключения задается
+// переменной окружения TEST_DATABASE_DSN, без нее тест пропускается.
+func TestDBStorageConcurrentCounters(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	flags.FlagDatabaseDSN = dsn
+
+	s := NewDBStorage()
+	defer s.Close()
+
+	ctx := context.Background()
+	id := fmt.Sprintf("ConcurrentCounter%d", time.Now().UnixNano())
+	defer s.dbConn.ExecContext(ctx, `DELETE FROM metrics WHERE id = $1`, id)
+
+	const (
+		workers    = 8
+		iterations = 25
+	)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				one := int64(1)
+				assert.NoError(t, s.UpdateMetric(ctx, models.Metrics{ID: id, MType: "counter", Delta: &one}))
+
+				// Повторы в батче складываются, а не перезаписывают друг друга
+				a, b := int64(1), int64(1)
+				assert.NoError(t, s.UpdateSliceOfMetrics(ctx, models.SliceMetrics{Metrics: []models.Metrics{
+					{ID: id, MType: "counter", Delta: &a},
+					{ID: id, MType: "counter", Delta: &b},
+				}}))
+			}
+		}()
+	}
+	wg.Wait()
+
+	metric, err := s.GetMetric(ctx, "counter", id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(workers*iterations*3), *metric.Delta)
+}
+
+// TestDBStorageApplyMetrics проверяет, что прежние значения читаются атомарно
+// с записью. Требует PostgreSQL, как и TestDBStorageConcurrentCounters.
+func TestDBStorageApplyMetrics(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	flags.FlagDatabaseDSN = dsn
+
+	s := NewDBStorage()
+	defer s.Close()
+
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+	counterID := fmt.Sprintf("ApplyCounter%d", suffix)
+	gaugeID := fmt.Sprintf("ApplyGauge%d", suffix)
+	defer s.dbConn.ExecContext(ctx, `DELETE FROM metrics WHERE id = ANY($1)`, []string{counterID, gaugeID})
+
+	value := 1.5
+	updates, err := s.ApplyMetrics(ctx, []models.Metrics{{ID: gaugeID, MType: "gauge", Value: &value}})
+	require.NoError(t, err)
+	require.Len(t, updates, 1)
+	assert.Nil(t, updates[0].Old, "gauge did not exist")
+	assert.Equal(t, 1.5, *updates[0].New.Value)
+
+	newValue := 2.5
+	updates, err = s.ApplyMetrics(ctx, []models.Metrics{{ID: gaugeID, MType: "gauge", Value: &newValue}})
+	require.NoError(t, err)
+	require.Len(t, updates, 1)
+	require.NotNil(t, updates[0].Old)
+	assert.Equal(t, 1.5, *updates[0].Old.Value)
+	assert.Equal(t, 2.5, *updates[0].New.Value)
+
+	// Одновременные записи видят разные прежние значения counter
+	const writers = 16
+	olds := make(chan int64, writers)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			one := int64(1)
+			updates, err := s.ApplyMetrics(ctx, []models.Metrics{{ID: counterID, MType: "counter", Delta: &one}})
+			if assert.NoError(t, err) && assert.Len(t, updates, 1) {
+				assert.Equal(t, *updates[0].Old.Delta+1, *updates[0].New.Delta)
+				assert.Equal(t, *updates[0].New.Delta, one, "stored total is written back")
+				olds <- *updates[0].Old.Delta
+			}
+		}()
+	}
+	wg.Wait()
+	close(olds)
+
+	seen := make(map[int64]bool, writers)
+	for old := range olds {
+		assert.False(t, seen[old], "old value %d reported twice", old)
+		seen[old] = true
+	}
+	assert.Len(t, seen, writers)
+}
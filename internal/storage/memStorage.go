@@ -57,6 +57,11 @@ func (s *MemStorage) IncrementCounter(name string, value int64) {
 	s.Counters[name] += value
 }
 
+// Ping всегда успешен: хранилище в памяти готово к работе сразу после создания
+func (s *MemStorage) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
 func (s *MemStorage) GetAllMetrics(ctx context.Context) ([]models.Metrics, error) {
 	var allMetrics []models.Metrics
 
@@ -191,6 +196,69 @@ func (s *MemStorage) UpdateSliceOfMetrics(ctx context.Context, sliceMitrics mode
 	return nil
 }
 
+// ApplyMetrics записывает метрики под одной блокировкой и возвращает их изменения
+// в порядке первого появления метрики в батче
+func (s *MemStorage) ApplyMetrics(ctx context.Context, metrics []models.Metrics) ([]models.MetricUpdate, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	for _, metric := range metrics {
+		if ok, err := metric.IsValid(); !ok {
+			zap.L().Info("Error in Metric Parametrs: ", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	s.Mu.Lock()
+	defer s.Mu.Unlock()
+
+	type metricKey struct{ mtype, id string }
+	index := make(map[metricKey]int, len(metrics))
+	updates := make([]models.MetricUpdate, 0, len(metrics))
+
+	for _, metric := range metrics {
+		key := metricKey{metric.MType, metric.ID}
+		if _, ok := index[key]; !ok {
+			index[key] = len(updates)
+			updates = append(updates, models.MetricUpdate{Old: s.storedMetric(metric.MType, metric.ID)})
+		}
+
+		switch metric.MType {
+		case "gauge":
+			s.Gauges[metric.ID] = *metric.Value
+		case "counter":
+			s.Counters[metric.ID] += *metric.Delta
+		}
+	}
+
+	for key, i := range index {
+		updates[i].New = *s.storedMetric(key.mtype, key.id)
+	}
+	return updates, nil
+}
+
+// storedMetric возвращает сохраненное значение метрики. Отсутствующий counter
+// возвращается с нулевым значением, отсутствующий gauge - как nil.
+// Вызывается под s.Mu.
+func (s *MemStorage) storedMetric(mtype, id string) *models.Metrics {
+	metric := &models.Metrics{ID: id, MType: mtype}
+	switch mtype {
+	case "gauge":
+		value, ok := s.Gauges[id]
+		if !ok {
+			return nil
+		}
+		metric.Value = &value
+	case "counter":
+		delta := s.Counters[id]
+		metric.Delta = &delta
+	}
+	return metric
+}
+
 func (s *MemStorage) SaveToFile(filePath string) error {
 	s.Mu.Lock()
 	defer s.Mu.Unlock()
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/MPoline/alert_service_yp/internal/models"
 )
@@ -11,9 +12,20 @@ type Storage interface {
 	GetMetric(ctx context.Context, metricType string, metricName string) (models.Metrics, error)
 	UpdateMetric(ctx context.Context, metric models.Metrics) error
 	UpdateSliceOfMetrics(ctx context.Context, sliceMitrics models.SliceMetrics) error
+	// Ping проверяет готовность хранилища к работе
+	Ping(ctx context.Context) error
 	Close()
 }
 
+// Updater реализуют хранилища, которые при записи сообщают прежние и сохраненные
+// значения метрик. Прежнее значение читается под той же блокировкой или в той же
+// транзакции, что и запись, поэтому одновременные записи его не искажают.
+type Updater interface {
+	// ApplyMetrics записывает метрики как UpdateSliceOfMetrics и возвращает изменение
+	// каждой метрики. Повторы одной метрики объединяются в одно изменение.
+	ApplyMetrics(ctx context.Context, metrics []models.Metrics) ([]models.MetricUpdate, error)
+}
+
 // NewStorage создает и возвращает экземпляр хранилища указанного типа
 func NewStorage(storageType string) Storage {
 	switch storageType {
@@ -26,9 +38,21 @@ func NewStorage(storageType string) Storage {
 	}
 }
 
+// Unwrap возвращает хранилище, обернутое декораторами (WatchedStorage,
+// журнал аудита). Декоратор сообщает обернутое хранилище методом Unwrap.
+func Unwrap(s Storage) Storage {
+	for {
+		wrapper, ok := s.(interface{ Unwrap() Storage })
+		if !ok {
+			return s
+		}
+		s = wrapper.Unwrap()
+	}
+}
+
 // SaveToFile сохраняет данные в файл (только для MemStorage)
 func SaveToFile(s Storage, filePath string) error {
-	if ms, ok := s.(*MemStorage); ok {
+	if ms, ok := Unwrap(s).(*MemStorage); ok {
 		return ms.SaveToFile(filePath)
 	}
 	return nil
@@ -36,8 +60,16 @@ func SaveToFile(s Storage, filePath string) error {
 
 // LoadFromFile загружает данные из файла (только для MemStorage)
 func LoadFromFile(s Storage, filePath string) error {
-	if ms, ok := s.(*MemStorage); ok {
+	if ms, ok := Unwrap(s).(*MemStorage); ok {
 		return ms.LoadFromFile(filePath)
 	}
 	return nil
 }
+
+// DBConn возвращает пул соединений хранилища в базе данных (только для DBStorage)
+func DBConn(s Storage) *sql.DB {
+	if ds, ok := Unwrap(s).(*DBStorage); ok {
+		return ds.dbConn
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/MPoline/alert_service_yp/internal/models"
+	"go.uber.org/zap"
+)
+
+// WatchedStorage - декоратор хранилища, уведомляющий подписчиков об обновлениях метрик.
+// Подписчики получают актуальные значения метрик после применения обновления
+// (для counter - накопленное значение, а не переданную дельту).
+type WatchedStorage struct {
+	Storage
+
+	mu          sync.RWMutex
+	subscribers map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	ch chan models.Metrics
+}
+
+// NewWatchedStorage оборачивает хранилище для отслеживания обновлений
+func NewWatchedStorage(s Storage) *WatchedStorage {
+	return &WatchedStorage{
+		Storage:     s,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// Unwrap возвращает отслеживаемое хранилище
+func (w *WatchedStorage) Unwrap() Storage {
+	return w.Storage
+}
+
+// Subscribe подписывается на обновления метрик. Обновления, которые подписчик
+// не успевает принять (буфер заполнен), пропускаются.
+// Возвращает канал обновлений и функцию отписки, закрывающую канал.
+func (w *WatchedStorage) Subscribe(buffer int) (<-chan models.Metrics, func()) {
+	sub := &subscriber{ch: make(chan models.Metrics, buffer)}
+
+	w.mu.Lock()
+	w.subscribers[sub] = struct{}{}
+	w.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			w.mu.Lock()
+			delete(w.subscribers, sub)
+			w.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+}
+
+// UpdateMetric обновляет метрику и уведомляет подписчиков
+func (w *WatchedStorage) UpdateMetric(ctx context.Context, metric models.Metrics) error {
+	if err := w.Storage.UpdateMetric(ctx, metric); err != nil {
+		return err
+	}
+
+	w.notify(ctx, []models.Metrics{metric})
+	return nil
+}
+
+// UpdateSliceOfMetrics обновляет метрики батчем и уведомляет подписчиков
+func (w *WatchedStorage) UpdateSliceOfMetrics(ctx context.Context, sliceMitrics models.SliceMetrics) error {
+	if err := w.Storage.UpdateSliceOfMetrics(ctx, sliceMitrics); err != nil {
+		return err
+	}
+
+	w.notify(ctx, sliceMitrics.Metrics)
+	return nil
+}
+
+// notify читает актуальные значения обновленных метрик и рассылает их подписчикам.
+// Без подписчиков хранилище повторно не читается.
+func (w *WatchedStorage) notify(ctx context.Context, updated []models.Metrics) {
+	w.mu.RLock()
+	hasSubscribers := len(w.subscribers) > 0
+	w.mu.RUnlock()
+	if !hasSubscribers {
+		return
+	}
+
+	type metricKey struct{ mtype, id string }
+	seen := make(map[metricKey]bool, len(updated))
+
+	for _, m := range updated {
+		key := metricKey{m.MType, m.ID}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		current, err := w.Storage.GetMetric(ctx, m.MType, m.ID)
+		if err != nil {
+			zap.L().Warn("Failed to read updated metric for watchers",
+				zap.String("metric_id", m.ID),
+				zap.Error(err))
+			continue
+		}
+
+		w.mu.RLock()
+		for sub := range w.subscribers {
+			select {
+			case sub.ch <- current:
+			default:
+				zap.L().Debug("Watcher is too slow, update dropped",
+					zap.String("metric_id", m.ID))
+			}
+		}
+		w.mu.RUnlock()
+	}
+}
@@ -0,0 +1,215 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue выпускает сертификат и записывает его и ключ в dir
+func (ca *testCA) issue(t *testing.T, dir, name string, serial int64, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func (ca *testCA) write(t *testing.T, dir, name string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, ca.pem, 0600))
+	return path
+}
+
+func newTLSServer(t *testing.T, r *Reloader) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(req.TLS.PeerCertificates) > 0 {
+			io.WriteString(w, req.TLS.PeerCertificates[0].Subject.CommonName)
+		}
+	}))
+	server.TLS = r.ServerConfig()
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func get(server *httptest.Server, config *tls.Config) (string, *tls.ConnectionState, error) {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	return string(body), resp.TLS, err
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "test-ca")
+	caFile := ca.write(t, dir, "ca.crt")
+
+	serverCert, serverKey := ca.issue(t, dir, "localhost", 2, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, dir, "agent", 3, x509.ExtKeyUsageClientAuth)
+
+	serverReloader, err := NewReloader(serverCert, serverKey, caFile)
+	require.NoError(t, err)
+	server := newTLSServer(t, serverReloader)
+
+	t.Run("client certificate accepted", func(t *testing.T) {
+		clientReloader, err := NewReloader(clientCert, clientKey, caFile)
+		require.NoError(t, err)
+
+		body, _, err := get(server, clientReloader.ClientConfig("localhost"))
+		require.NoError(t, err)
+		assert.Equal(t, "agent", body)
+	})
+
+	t.Run("missing client certificate rejected", func(t *testing.T) {
+		clientReloader, err := NewReloader("", "", caFile)
+		require.NoError(t, err)
+
+		_, _, err = get(server, clientReloader.ClientConfig("localhost"))
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown server CA rejected", func(t *testing.T) {
+		otherCAFile := newTestCA(t, "other-ca").write(t, dir, "other-ca.crt")
+		clientReloader, err := NewReloader(clientCert, clientKey, otherCAFile)
+		require.NoError(t, err)
+
+		_, _, err = get(server, clientReloader.ClientConfig("localhost"))
+		assert.Error(t, err)
+	})
+
+	t.Run("wrong server name rejected", func(t *testing.T) {
+		clientReloader, err := NewReloader(clientCert, clientKey, caFile)
+		require.NoError(t, err)
+
+		_, _, err = get(server, clientReloader.ClientConfig("example.com"))
+		assert.Error(t, err)
+	})
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "test-ca")
+	caFile := ca.write(t, dir, "ca.crt")
+
+	serverCert, serverKey := ca.issue(t, dir, "localhost", 2, x509.ExtKeyUsageServerAuth)
+	serverReloader, err := NewReloader(serverCert, serverKey, "")
+	require.NoError(t, err)
+	server := newTLSServer(t, serverReloader)
+
+	clientReloader, err := NewReloader("", "", caFile)
+	require.NoError(t, err)
+
+	_, state, err := get(server, clientReloader.ClientConfig("localhost"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), state.PeerCertificates[0].SerialNumber.Int64())
+
+	// Сертификат заменен на диске - новые соединения получают новый сертификат
+	ca.issue(t, dir, "localhost", 4, x509.ExtKeyUsageServerAuth)
+	require.NoError(t, serverReloader.Reload())
+
+	_, state, err = get(server, clientReloader.ClientConfig("localhost"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), state.PeerCertificates[0].SerialNumber.Int64())
+
+	// Поврежденный файл не сбрасывает ранее загруженный сертификат
+	require.NoError(t, os.WriteFile(serverCert, []byte("broken"), 0600))
+	assert.Error(t, serverReloader.Reload())
+
+	_, state, err = get(server, clientReloader.ClientConfig("localhost"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), state.PeerCertificates[0].SerialNumber.Int64())
+}
+
+func TestNewReloaderErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := NewReloader(filepath.Join(dir, "cert.pem"), "", "")
+	assert.Error(t, err, "certificate without key")
+
+	_, err = NewReloader("", "", filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err, "missing CA file")
+
+	emptyCA := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(emptyCA, []byte("no certificates"), 0600))
+	_, err = NewReloader("", "", emptyCA)
+	assert.Error(t, err, "CA file without certificates")
+}